@@ -0,0 +1,104 @@
+package pen
+
+import (
+	"os"
+	"sync/atomic"
+)
+
+// Append all entries with one write, they get consecutive offsets, returns the offset of every entry.
+// The entries are copied into one buffer, check AppendBatchV to avoid the copy.
+// With O_APPEND, FileCRC, FixedSize, CompactHeader, Transforms, MaxSegmentBytes or OnAppend the entries are just appended one by one
+// (with OnAppend every one of them is synced before its callback).
+func (fw *Writer) AppendBatch(entries [][]byte) ([]uint32, error) {
+	return fw.appendBatch(entries, writeCopy)
+}
+
+// Same as AppendBatch, but the headers, the payloads and the padding are written with one pwritev(2) without copying the payloads into one buffer,
+// on platforms without pwritev it is the same as AppendBatch.
+func (fw *Writer) AppendBatchV(entries [][]byte) ([]uint32, error) {
+	return fw.appendBatch(entries, writeVectored)
+}
+
+func (fw *Writer) appendBatch(entries [][]byte, write func(*os.File, [][]byte, int64) error) ([]uint32, error) {
+	offsets := make([]uint32, len(entries))
+	if fw.appendMode || fw.fileCRC || fw.fixedSize > 0 || fw.opts.CompactHeader || len(fw.opts.Transforms) > 0 || fw.opts.MaxSegmentBytes > 0 || fw.opts.OnAppend != nil {
+		for i, e := range entries {
+			r, err := fw.append(e)
+			if err != nil {
+				return nil, err
+			}
+			offsets[i] = r.Offset
+		}
+		if fw.opts.GroupCommitWindow > 0 && len(entries) > 0 {
+			err := fw.waitGroupCommit()
+			if err != nil {
+				return nil, err
+			}
+		}
+		return offsets, nil
+	}
+	if len(entries) == 0 {
+		return offsets, nil
+	}
+
+	headers := make([]byte, 16*len(entries))
+	padding := make([]byte, PAD)
+	for i := range padding {
+		padding[i] = fw.opts.PadByte
+	}
+	iovs := make([][]byte, 0, 3*len(entries))
+	total := uint32(0)
+	for i, e := range entries {
+		header := headers[16*i : 16*i+16]
+		putHeader(header, e, MAGIC)
+		iovs = append(iovs, header, e)
+
+		size := uint32(16 + len(e))
+		padded := (size + PAD - 1) / PAD
+		// the last entry is not padded (unless PadByte is set), same as Append
+		if (i < len(entries)-1 || fw.opts.PadByte != 0) && padded*PAD > size {
+			iovs = append(iovs, padding[:padded*PAD-size])
+		}
+		offsets[i] = total
+		total += padded
+	}
+
+	start := atomic.AddUint32(&fw.offset, total) - total
+	for i := range offsets {
+		offsets[i] += start
+	}
+	err := write(fw.file, iovs, byteOffset(start))
+	fw.written.finish(start, start+total)
+	if err == nil && fw.opts.GroupCommitWindow > 0 {
+		err = fw.waitGroupCommit()
+	}
+	if err != nil {
+		return nil, err
+	}
+	return offsets, nil
+}
+
+func writeCopy(file *os.File, iovs [][]byte, off int64) error {
+	size := 0
+	for _, b := range iovs {
+		size += len(b)
+	}
+	blob := make([]byte, 0, size)
+	for _, b := range iovs {
+		blob = append(blob, b...)
+	}
+	_, err := file.WriteAt(blob, off)
+	return err
+}
+
+// iovs without the first n bytes
+func skipBytes(iovs [][]byte, n int) [][]byte {
+	for len(iovs) > 0 && n >= len(iovs[0]) {
+		n -= len(iovs[0])
+		iovs = iovs[1:]
+	}
+	if len(iovs) > 0 {
+		iovs = append([][]byte{iovs[0][n:]}, iovs[1:]...)
+	}
+	return iovs
+}
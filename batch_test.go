@@ -0,0 +1,111 @@
+package pen
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestAppendBatch(t *testing.T) {
+	for _, name := range []string{"copy", "pwritev"} {
+		t.Run(name, func(t *testing.T) {
+			fw, reader, done := newTestWriterReader(t, 64)
+			defer done()
+
+			batch := fw.AppendBatch
+			if name == "pwritev" {
+				batch = fw.AppendBatchV
+			}
+
+			first, _, err := fw.Append([]byte("first"))
+			if err != nil {
+				t.Fatal(err)
+			}
+			entries := [][]byte{}
+			for i := 0; i < 2000; i++ {
+				entries = append(entries, []byte(RandStringRunes(i%200)))
+			}
+			offsets, err := batch(entries)
+			if err != nil {
+				t.Fatal(err)
+			}
+			last, _, err := fw.Append([]byte("last"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			for i, off := range offsets {
+				data, _, err := reader.Read(off)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if !bytes.Equal(data, entries[i]) {
+					t.Fatalf("entry %d mismatch", i)
+				}
+			}
+
+			n := 0
+			err = reader.Scan(0, func(data []byte, offset, next uint32) error {
+				switch {
+				case offset == first || offset == last:
+				case offset != offsets[n] || !bytes.Equal(data, entries[n]):
+					return fmt.Errorf("entry %d mismatch at %d", n, offset)
+				default:
+					n++
+				}
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(entries) {
+				t.Fatalf("expected %d entries got %d", len(entries), n)
+			}
+		})
+	}
+}
+
+func TestSkipBytes(t *testing.T) {
+	iovs := [][]byte{[]byte("ab"), []byte("cde"), []byte("f")}
+	for n := 0; n <= 6; n++ {
+		got := []byte{}
+		for _, b := range skipBytes(iovs, n) {
+			got = append(got, b...)
+		}
+		if string(got) != "abcdef"[n:] {
+			t.Fatalf("skip %d: got %q", n, got)
+		}
+	}
+}
+
+func benchmarkAppendBatch(b *testing.B, vectored bool) {
+	fw, _, done := newTestWriterReader(b, 0)
+	defer done()
+
+	entries := [][]byte{}
+	for i := 0; i < 100; i++ {
+		entries = append(entries, make([]byte, 64*1024))
+	}
+	batch := fw.AppendBatch
+	if vectored {
+		batch = fw.AppendBatchV
+	}
+	b.SetBytes(100 * 64 * 1024)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := batch(entries); err != nil {
+			b.Fatal(err)
+		}
+		if err := fw.TruncateTo(0); err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkAppendBatch(b *testing.B) {
+	benchmarkAppendBatch(b, false)
+}
+
+func BenchmarkAppendBatchV(b *testing.B) {
+	benchmarkAppendBatch(b, true)
+}
@@ -0,0 +1,80 @@
+package pen
+
+import (
+	"container/list"
+	"sync"
+)
+
+// LRU of entries by offset, used by Log and ReaderOptions.CacheSize, the entries are never invalidated,
+// because the offsets in append only file never change meaning. It is *safe* to use it concurrently.
+type entryCache struct {
+	lock   sync.Mutex
+	size   int
+	lru    *list.List
+	byOff  map[uint32]*list.Element
+	hits   uint64
+	misses uint64
+}
+
+type cacheEntry struct {
+	offset uint32
+	next   uint32
+	data   []byte
+}
+
+func newEntryCache(size int) *entryCache {
+	return &entryCache{
+		size:  size,
+		lru:   list.New(),
+		byOff: map[uint32]*list.Element{},
+	}
+}
+
+// returns a copy of the cached data, so the caller can not corrupt the cache
+func (c *entryCache) get(offset uint32) ([]byte, uint32, bool) {
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	el, ok := c.byOff[offset]
+	if !ok {
+		c.misses++
+		return nil, 0, false
+	}
+	c.hits++
+	c.lru.MoveToFront(el)
+	e := el.Value.(*cacheEntry)
+	return append([]byte{}, e.data...), e.next, true
+}
+
+// the data is owned by the cache after this
+func (c *entryCache) add(offset, next uint32, data []byte) {
+	if c.size == 0 {
+		return
+	}
+	c.lock.Lock()
+	defer c.lock.Unlock()
+	if el, ok := c.byOff[offset]; ok {
+		c.lru.MoveToFront(el)
+		return
+	}
+	c.byOff[offset] = c.lru.PushFront(&cacheEntry{offset: offset, next: next, data: data})
+	for c.lru.Len() > c.size {
+		last := c.lru.Back()
+		c.lru.Remove(last)
+		delete(c.byOff, last.Value.(*cacheEntry).offset)
+	}
+}
+
+// Open reader with LRU cache of the last cacheEntries read entries, same as NewReaderWithOptions with ReaderOptions{CacheSize: cacheEntries}
+func NewCachingReader(filename string, blockSize int, cacheEntries int) (*Reader, error) {
+	return NewReaderWithOptions(filename, blockSize, ReaderOptions{CacheSize: cacheEntries})
+}
+
+// Returns the amount of Read calls served from the cache and the ones that had to read the file, both are 0 without ReaderOptions.CacheSize
+func (ar *Reader) CacheStats() (hits uint64, misses uint64) {
+	if ar.cache == nil {
+		return 0, 0
+	}
+	ar.cache.lock.Lock()
+	defer ar.cache.lock.Unlock()
+	return ar.cache.hits, ar.cache.misses
+}
@@ -0,0 +1,72 @@
+package pen
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestCachingReader(t *testing.T) {
+	fw, r, done := newTestWriterReader(t, 0)
+	defer done()
+
+	offsets := []uint32{}
+	for i := 0; i < 10; i++ {
+		off, _, err := fw.Append([]byte(fmt.Sprintf("%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+
+	reader, err := NewCachingReader(r.file.Name(), 0, 5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	_, err = NewReaderWithOptions(r.file.Name(), 0, ReaderOptions{CacheSize: -1})
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+
+	for round := 0; round < 3; round++ {
+		for i := 0; i < 5; i++ {
+			data, next, err := reader.Read(offsets[i])
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(data) != fmt.Sprintf("%d", i) || next != offsets[i+1] {
+				t.Fatalf("unexpected %s %d", data, next)
+			}
+			// the cache has its own copy
+			data[0] = 'x'
+		}
+	}
+	hits, misses := reader.CacheStats()
+	if hits != 10 || misses != 5 {
+		t.Fatalf("expected 10 hits and 5 misses, got %d %d", hits, misses)
+	}
+
+	// evict the first entry
+	_, _, err = reader.Read(offsets[5])
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = reader.Read(offsets[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	hits, misses = reader.CacheStats()
+	if hits != 10 || misses != 7 {
+		t.Fatalf("expected 10 hits and 7 misses, got %d %d", hits, misses)
+	}
+
+	// errors are not cached
+	_, _, err = reader.Read(offsets[9] + 100)
+	if err == nil {
+		t.Fatal("expected error")
+	}
+	hits, misses = r.CacheStats()
+	if hits != 0 || misses != 0 {
+		t.Fatalf("expected no stats without cache, got %d %d", hits, misses)
+	}
+}
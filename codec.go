@@ -0,0 +1,158 @@
+package pen
+
+import (
+	"errors"
+	"fmt"
+	"reflect"
+	"sync"
+)
+
+// returned by NewTypedReader and NewTypedWriter if no codec was registered for the type
+var ErrNoCodec = errors.New("no codec registered for the type")
+
+type codec[T any] struct {
+	encode func(T) ([]byte, error)
+	decode func([]byte) (T, error)
+}
+
+// reflect.Type -> codec[T]
+var codecs sync.Map
+
+// Register the binary codec used by TypedReader[T] and TypedWriter[T], decode must be the inverse of encode. Registering again replaces the codec.
+// example, with encoding/binary for fixed layout struct:
+//	type Point struct {
+//		X, Y int32
+//	}
+//
+//	RegisterCodec(func(p Point) ([]byte, error) {
+//		b := make([]byte, 8)
+//		binary.LittleEndian.PutUint32(b[0:], uint32(p.X))
+//		binary.LittleEndian.PutUint32(b[4:], uint32(p.Y))
+//		return b, nil
+//	}, func(b []byte) (Point, error) {
+//		if len(b) != 8 {
+//			return Point{}, EINVAL
+//		}
+//		return Point{X: int32(binary.LittleEndian.Uint32(b[0:])), Y: int32(binary.LittleEndian.Uint32(b[4:]))}, nil
+//	})
+//
+//	w, _ := NewTypedWriter[Point](writer)
+//	offset, _, err := w.Append(Point{X: 1, Y: 2})
+//	...
+//	r, _ := NewTypedReader[Point](reader)
+//	p, _, err := r.Read(offset)
+func RegisterCodec[T any](encode func(T) ([]byte, error), decode func([]byte) (T, error)) {
+	codecs.Store(typeOf[T](), codec[T]{encode: encode, decode: decode})
+}
+
+func typeOf[T any]() reflect.Type {
+	return reflect.TypeOf((*T)(nil)).Elem()
+}
+
+func codecFor[T any]() (codec[T], error) {
+	c, ok := codecs.Load(typeOf[T]())
+	if !ok {
+		return codec[T]{}, ErrNoCodec
+	}
+	return c.(codec[T]), nil
+}
+
+// Reader that decodes the entries into T with the codec registered with RegisterCodec[T]
+type TypedReader[T any] struct {
+	r     *Reader
+	codec codec[T]
+}
+
+// Create TypedReader on top of r, returns ErrNoCodec if there is no codec for T
+func NewTypedReader[T any](r *Reader) (*TypedReader[T], error) {
+	c, err := codecFor[T]()
+	if err != nil {
+		return nil, err
+	}
+	return &TypedReader[T]{r: r, codec: c}, nil
+}
+
+// Read and decode the entry at offset, the decode errors are returned with the offset
+func (tr *TypedReader[T]) Read(offset uint32) (T, uint32, error) {
+	data, next, err := tr.r.Read(offset)
+	if err != nil {
+		var zero T
+		return zero, 0, err
+	}
+	v, err := tr.decode(data, offset)
+	if err != nil {
+		return v, 0, err
+	}
+	return v, next, nil
+}
+
+// Scan and decode every entry, the decode errors are returned with the offset of the bad entry
+func (tr *TypedReader[T]) Scan(offset uint32, cb func(T, uint32, uint32) error) error {
+	return tr.r.Scan(offset, func(data []byte, offset, next uint32) error {
+		v, err := tr.decode(data, offset)
+		if err != nil {
+			return err
+		}
+		return cb(v, offset, next)
+	})
+}
+
+func (tr *TypedReader[T]) decode(data []byte, offset uint32) (T, error) {
+	v, err := tr.codec.decode(data)
+	if err != nil {
+		return v, fmt.Errorf("pen: decode at offset %d: %w", offset, err)
+	}
+	return v, nil
+}
+
+// Writer that encodes T with the codec registered with RegisterCodec[T]
+type TypedWriter[T any] struct {
+	w     *Writer
+	codec codec[T]
+}
+
+// Create TypedWriter on top of w, returns ErrNoCodec if there is no codec for T
+func NewTypedWriter[T any](w *Writer) (*TypedWriter[T], error) {
+	c, err := codecFor[T]()
+	if err != nil {
+		return nil, err
+	}
+	return &TypedWriter[T]{w: w, codec: c}, nil
+}
+
+// Encode v and Append it
+func (tw *TypedWriter[T]) Append(v T) (uint32, uint32, error) {
+	data, err := tw.codec.encode(v)
+	if err != nil {
+		return 0, 0, err
+	}
+	return tw.w.Append(data)
+}
+
+// Scan the whole file and decode every entry into the returned slice (e.g. loading a state log on startup), corruption is skipped like in Scan,
+// and the first decode error is returned with the offset of the bad entry. The data passed to decode is owned by it (Scan never reuses it).
+func DecodeAll[T any](r *Reader, decode func([]byte) (T, error)) ([]T, error) {
+	return DecodeAllLimit(r, 0, decode)
+}
+
+// Same as DecodeAll, but returns EOVERFLOW if the total length of the data is bigger than maxBytes (0 is no limit), so a huge file can not use unbounded memory
+func DecodeAllLimit[T any](r *Reader, maxBytes int64, decode func([]byte) (T, error)) ([]T, error) {
+	out := []T{}
+	total := int64(0)
+	err := r.Scan(0, func(data []byte, offset, next uint32) error {
+		total += int64(len(data))
+		if maxBytes > 0 && total > maxBytes {
+			return EOVERFLOW
+		}
+		v, err := decode(data)
+		if err != nil {
+			return fmt.Errorf("pen: decode at offset %d: %w", offset, err)
+		}
+		out = append(out, v)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
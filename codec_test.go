@@ -0,0 +1,137 @@
+package pen
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+type codecPoint struct {
+	X, Y int32
+}
+
+func TestTypedReaderWriter(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	if _, err := NewTypedReader[codecPoint](reader); err != ErrNoCodec {
+		t.Fatalf("expected ErrNoCodec got %v", err)
+	}
+
+	RegisterCodec(func(p codecPoint) ([]byte, error) {
+		b := make([]byte, 8)
+		binary.LittleEndian.PutUint32(b[0:], uint32(p.X))
+		binary.LittleEndian.PutUint32(b[4:], uint32(p.Y))
+		return b, nil
+	}, func(b []byte) (codecPoint, error) {
+		if len(b) != 8 {
+			return codecPoint{}, EINVAL
+		}
+		return codecPoint{X: int32(binary.LittleEndian.Uint32(b[0:])), Y: int32(binary.LittleEndian.Uint32(b[4:]))}, nil
+	})
+
+	tw, err := NewTypedWriter[codecPoint](fw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr, err := NewTypedReader[codecPoint](reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offsets := []uint32{}
+	for i := 0; i < 10; i++ {
+		off, _, err := tw.Append(codecPoint{X: int32(i), Y: int32(-i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+
+	p, _, err := tr.Read(offsets[3])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p != (codecPoint{X: 3, Y: -3}) {
+		t.Fatalf("unexpected %v", p)
+	}
+
+	n := 0
+	err = tr.Scan(0, func(p codecPoint, offset, next uint32) error {
+		if p != (codecPoint{X: int32(n), Y: int32(-n)}) || offset != offsets[n] {
+			t.Fatalf("unexpected %v at %d", p, offset)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Fatalf("expected 10 got %d", n)
+	}
+
+	bad, _, err := fw.Append([]byte("bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = tr.Read(bad)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("offset %d", bad)) || !errors.Is(err, EINVAL) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	err = tr.Scan(0, func(p codecPoint, offset, next uint32) error {
+		return nil
+	})
+	if !errors.Is(err, EINVAL) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestDecodeAll(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	decode := func(b []byte) (int, error) {
+		return strconv.Atoi(string(b))
+	}
+	values, err := DecodeAll(reader, decode)
+	if err != nil || len(values) != 0 {
+		t.Fatalf("unexpected %v %v", values, err)
+	}
+
+	offsets := []uint32{}
+	for i := 0; i < 10; i++ {
+		off, _, err := fw.Append([]byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	_, err = fw.file.WriteAt([]byte{'x'}, byteOffset(offsets[4])+16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	values, err = DecodeAll(reader, decode)
+	if err != nil || fmt.Sprintf("%v", values) != "[0 1 2 3 5 6 7 8 9]" {
+		t.Fatalf("unexpected %v %v", values, err)
+	}
+
+	if _, err := DecodeAllLimit(reader, 8, decode); err != EOVERFLOW {
+		t.Fatalf("expected EOVERFLOW got %v", err)
+	}
+	if values, err := DecodeAllLimit(reader, 9, decode); err != nil || len(values) != 9 {
+		t.Fatalf("unexpected %v %v", values, err)
+	}
+
+	bad, _, err := fw.Append([]byte("bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = DecodeAll(reader, decode)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("offset %d", bad)) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
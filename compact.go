@@ -0,0 +1,74 @@
+package pen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// magic of the compact entries written with WriterOptions.CompactHeader
+var COMPACT_MAGIC = []byte{0xc, 0xb}
+
+// returned by the functions that work on the 16 byte header (ReadRaw, PayloadChecksum) for a valid compact entry, which does not have it, use Read
+var ErrCompactEntry = errors.New("compact entry has no 16 byte header")
+
+// max data length of compact entry, bigger entries are written with the normal header
+const compactMaxLen = 16 * 1024
+
+// compact entry, for small data the overhead is 7 bytes instead of 16:
+//   2 bytes COMPACT_MAGIC
+//   uvarint len(data)
+//   data
+//   4 bytes LE HASH(magic, len and data)
+func compactBlob(encoded []byte) []byte {
+	blob := make([]byte, len(COMPACT_MAGIC)+binary.MaxVarintLen64+len(encoded)+4)
+	n := copy(blob, COMPACT_MAGIC)
+	n += binary.PutUvarint(blob[n:], uint64(len(encoded)))
+	n += copy(blob[n:], encoded)
+	binary.LittleEndian.PutUint32(blob[n:], uint32(Hash(blob[:n])))
+	return blob[:n+4]
+}
+
+// parse compact entry at offset, block is what was already read from there (eof is true if the file ends in it)
+// returns EBADSLT if it is not valid compact entry, and ErrTruncated if it could be one, but the file ends before it
+func readCompact(reader io.ReaderAt, offset uint64, block []byte, eof bool) ([]byte, int, error) {
+	length, vn := binary.Uvarint(block[len(COMPACT_MAGIC):])
+	if vn <= 0 || length > compactMaxLen {
+		return nil, 0, EBADSLT
+	}
+	start := len(COMPACT_MAGIC) + vn
+	size := start + int(length) + 4
+
+	entry := block
+	if size > len(block) {
+		if eof {
+			return nil, 0, ErrTruncated
+		}
+		// the entries are small, so Alloc is not used for them
+		entry = make([]byte, size)
+		n, err := readFullAt(reader, entry, int64(offset))
+		if n < size {
+			if err == io.EOF {
+				return nil, 0, ErrTruncated
+			}
+			return nil, 0, EBADSLT
+		}
+	}
+	if binary.LittleEndian.Uint32(entry[size-4:]) != uint32(Hash(entry[:size-4])) {
+		return nil, 0, EBADSLT
+	}
+	return entry[start : start+int(length)], size, nil
+}
+
+// check if header (the first 16 bytes at offset, or less at the end of the file) is the start of valid compact entry, returns the offset after it
+func compactAt(reader io.ReaderAt, offset uint32, header []byte) (uint32, bool) {
+	if len(header) <= len(COMPACT_MAGIC) || !bytes.Equal(header[:len(COMPACT_MAGIC)], COMPACT_MAGIC) {
+		return 0, false
+	}
+	_, size, err := readCompact(reader, uint64(byteOffset(offset)), header, len(header) < 16)
+	if err != nil {
+		return 0, false
+	}
+	return nextOffsetSize(offset, size), true
+}
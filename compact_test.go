@@ -0,0 +1,182 @@
+package pen
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCompactHeader(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "forward")
+
+	w, err := NewWriterWithOptions(fn, WriterOptions{CompactHeader: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sizes := []int{0, 1, 40, 57, 58, 100, 2828, compactMaxLen, compactMaxLen + 1, 100000}
+	offsets := []uint32{}
+	for _, size := range sizes {
+		data := bytes.Repeat([]byte{byte(size)}, size)
+		off, next, err := w.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+		// 7 bytes of overhead up to 127 bytes
+		if size <= 57 && next != off+1 {
+			t.Fatalf("%d: expected compact entry to take 1 PAD got %d", size, next-off)
+		}
+	}
+	err = w.Overwrite(0, []byte("a"))
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+	w.Close()
+
+	// normal entries after the compact ones, including one with length that starts like COMPACT_MAGIC
+	w, err = NewWriter(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	for _, size := range []int{5, 0x0b0c} {
+		off, _, err := w.Append(bytes.Repeat([]byte{byte(size)}, size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes = append(sizes, size)
+		offsets = append(offsets, off)
+	}
+
+	for _, blockSize := range []int{16, 64, 4096} {
+		r, err := NewReader(fn, blockSize)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, off := range offsets {
+			data, next, err := r.Read(off)
+			if err != nil {
+				t.Fatalf("%d: %v", sizes[i], err)
+			}
+			if !bytes.Equal(data, bytes.Repeat([]byte{byte(sizes[i])}, sizes[i])) {
+				t.Fatalf("%d: unexpected data", sizes[i])
+			}
+			if i+1 < len(offsets) && next != offsets[i+1] {
+				t.Fatalf("%d: expected next %d got %d", sizes[i], offsets[i+1], next)
+			}
+
+			// only the entries written compact have no header
+			compact := i < 8
+			_, _, err = r.PayloadChecksum(off)
+			if compact != (err == ErrCompactEntry) || (!compact && err != nil) {
+				t.Fatalf("%d: unexpected PayloadChecksum error %v", sizes[i], err)
+			}
+			_, _, _, _, rawNext, err := r.ReadRaw(off)
+			if compact != (err == ErrCompactEntry) || (!compact && err != nil) || rawNext != next {
+				t.Fatalf("%d: unexpected ReadRaw %d %v", sizes[i], rawNext, err)
+			}
+			same, _, err := r.CompareAt(off, data)
+			if err != nil || !same {
+				t.Fatalf("%d: unexpected CompareAt %v %v", sizes[i], same, err)
+			}
+		}
+		n := 0
+		errs, err := r.ScanCollectErrors(0, func(data []byte, offset, next uint32) error {
+			if offset != offsets[n] || len(data) != sizes[n] {
+				t.Fatalf("unexpected entry at %d", offset)
+			}
+			n++
+			return nil
+		})
+		if err != nil || len(errs) != 0 || n != len(offsets) {
+			t.Fatalf("unexpected %d %v %v", n, errs, err)
+		}
+		_, garbage, err := r.TailState()
+		if err != nil || garbage != 0 {
+			t.Fatalf("unexpected %d %v", garbage, err)
+		}
+		r.Close()
+	}
+
+	// corrupted compact entry is skipped, torn one at the end is truncated
+	_, err = w.file.WriteAt([]byte{0xff}, byteOffset(offsets[2])+5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	w, err = NewWriterWithOptions(fn, WriterOptions{CompactHeader: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	off, _, err := w.Append([]byte("hello world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.file.Truncate(byteOffset(off) + 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	r, err := NewReader(fn, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	_, _, err = r.Read(offsets[2])
+	if err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+	_, _, err = r.Read(off)
+	if err != ErrTruncated {
+		t.Fatalf("expected ErrTruncated got %v", err)
+	}
+	n := 0
+	err = r.ScanWithOptions(0, ScanOptions{ReportTruncated: true}, func(data []byte, offset, next uint32) error {
+		n++
+		return nil
+	})
+	if err != ErrTruncated || n != len(offsets)-1 {
+		t.Fatalf("unexpected %d %v", n, err)
+	}
+}
+
+func BenchmarkCompactHeaderSize(b *testing.B) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	defer func(pad uint32) {
+		PAD = pad
+	}(PAD)
+
+	for _, pad := range []uint32{8, 16, 64} {
+		for _, compact := range []bool{false, true} {
+			b.Run(fmt.Sprintf("pad=%d/compact=%v", pad, compact), func(b *testing.B) {
+				PAD = pad
+				fn := path.Join(dir, fmt.Sprintf("%d_%v", pad, compact))
+				os.Remove(fn)
+				w, err := NewWriterWithOptions(fn, WriterOptions{CompactHeader: compact})
+				if err != nil {
+					b.Fatal(err)
+				}
+				defer w.Close()
+				for i := 0; i < b.N; i++ {
+					// small entries, 1 to 128 bytes
+					_, _, err := w.Append(make([]byte, 1+i%128))
+					if err != nil {
+						b.Fatal(err)
+					}
+				}
+				b.ReportMetric(float64(byteOffset(w.offset))/float64(b.N), "disk-bytes/entry")
+			})
+		}
+	}
+}
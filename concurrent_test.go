@@ -0,0 +1,136 @@
+package pen
+
+import (
+	"bytes"
+	"io"
+	"sync"
+	"testing"
+)
+
+func TestConcurrentReadersDuringWrites(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 64)
+	defer done()
+
+	expected := [][]byte{}
+	for i := 0; i < 2000; i++ {
+		expected = append(expected, []byte(RandStringRunes((i%20)*200)))
+	}
+
+	var wg sync.WaitGroup
+	for k := 0; k < 4; k++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				n := 0
+				prevNext := uint32(0)
+				err := reader.Scan(0, func(data []byte, offset, next uint32) error {
+					if offset != prevNext {
+						t.Errorf("entry %d: expected offset %d got %d, an entry was skipped", n, prevNext, offset)
+					}
+					if n >= len(expected) || !bytes.Equal(data, expected[n]) {
+						t.Errorf("entry %d: data mismatch", n)
+					}
+					prevNext = next
+					n++
+					return nil
+				})
+				if err != nil {
+					t.Error(err)
+				}
+				if t.Failed() || n == len(expected) {
+					return
+				}
+			}
+		}()
+	}
+
+	for _, data := range expected {
+		_, _, err := fw.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	wg.Wait()
+}
+
+// the first read at hidden returns zeros, as if the entry was not written yet
+type inflightReaderAt struct {
+	r      io.ReaderAt
+	hidden int64
+	once   sync.Once
+}
+
+func (r *inflightReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	hide := false
+	if off == r.hidden {
+		r.once.Do(func() {
+			hide = true
+		})
+	}
+	n, err := r.r.ReadAt(p, off)
+	if hide {
+		for i := range p[:n] {
+			p[i] = 0
+		}
+	}
+	return n, err
+}
+
+func TestScanRecheckInflightEntry(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	offsets := []uint32{}
+	for i := 0; i < 5; i++ {
+		off, _, err := fw.Append(make([]byte, 200))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+
+	r := &inflightReaderAt{r: reader.file, hidden: byteOffset(offsets[2])}
+	seen := []uint32{}
+	err := ScanFromReader(r, 0, 16, func(data []byte, offset, next uint32) error {
+		seen = append(seen, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != len(offsets) {
+		t.Fatalf("expected %v got %v", offsets, seen)
+	}
+	for i := range seen {
+		if seen[i] != offsets[i] {
+			t.Fatalf("expected %v got %v", offsets, seen)
+		}
+	}
+}
+
+func TestScanNoCopyAfterSkip(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 4096)
+	defer done()
+
+	for i := 0; i < 5; i++ {
+		_, _, err := fw.Append([]byte{byte('0' + i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, err := fw.file.WriteAt([]byte{'x'}, byteOffset(1)+16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the recheck of the skipped entry must not leave its bytes in the reused buffer
+	seen := []byte{}
+	err = reader.ScanNoCopy(0, func(data []byte, offset, next uint32) error {
+		seen = append(seen, data...)
+		return nil
+	})
+	if err != nil || string(seen) != "0234" {
+		t.Fatalf("unexpected %q %v", seen, err)
+	}
+}
@@ -0,0 +1,53 @@
+package pen
+
+import "math"
+
+// how many entries ApproxCount measures in every probed region
+var approxSampleEntries = 64
+
+// Estimate the number of entries from the size of the file and the average size of the entries (with padding) in 3 regions,
+// at the start, the middle and near the end of the file, each region is resynced to the first valid entry after it (same as Scan),
+// so it reads only a few hundred entries however big the file is. It is *approximate*, files with very different entry sizes in different parts
+// are over or under estimated, use Count for the exact number. With ReaderOptions.FixedSize it is exact (the number of records).
+func (ar *Reader) ApproxCount() (uint64, error) {
+	size, err := ar.size()
+	if err != nil || size == 0 {
+		return 0, err
+	}
+	if ar.opts.FixedSize > 0 {
+		return uint64(size / fixedRecordSize(ar.opts.FixedSize)), nil
+	}
+
+	end := highWaterOffset(size)
+	units, entries := uint64(0), 0
+	for _, start := range []uint32{0, end / 2, end - end/8} {
+		n := 0
+		err := ar.ScanNoCopy(start, func(data []byte, offset, next uint32) error {
+			units += uint64(next - offset)
+			entries++
+			n++
+			if n >= approxSampleEntries {
+				return errStopScan
+			}
+			return nil
+		})
+		if err != nil && err != errStopScan {
+			return 0, err
+		}
+	}
+	if entries == 0 {
+		return 0, nil
+	}
+	average := float64(units) * float64(PAD) / float64(entries)
+	return uint64(math.Round(float64(size) / average)), nil
+}
+
+// Exact number of valid entries (the ones Scan delivers), it is a full scan of the file, use ApproxCount for a quick estimate.
+func (ar *Reader) Count() (uint64, error) {
+	count := uint64(0)
+	err := ar.ScanNoCopy(0, func(data []byte, offset, next uint32) error {
+		count++
+		return nil
+	})
+	return count, err
+}
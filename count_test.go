@@ -0,0 +1,33 @@
+package pen
+
+import "testing"
+
+func TestApproxCount(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	for _, f := range []func() (uint64, error){reader.ApproxCount, reader.Count} {
+		n, err := f()
+		if err != nil || n != 0 {
+			t.Fatalf("expected 0 got %d %v", n, err)
+		}
+	}
+
+	for i := 0; i < 5000; i++ {
+		_, _, err := fw.Append([]byte(RandStringRunes(50 + (i*7)%100)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	count, err := reader.Count()
+	if err != nil || count != 5000 {
+		t.Fatalf("expected 5000 got %d %v", count, err)
+	}
+	approx, err := reader.ApproxCount()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if approx < 4000 || approx > 6000 {
+		t.Fatalf("expected about 5000 got %d", approx)
+	}
+}
@@ -0,0 +1,21 @@
+package pen
+
+import "fmt"
+
+// Scan entries stored as deltas against the previous entry, calling cb with the reconstructed payloads.
+// apply gets the previously reconstructed payload (nil for the first entry) and the stored entry and returns the full payload,
+// keyframes (full payloads) are detected by apply itself, e.g. from a flag byte in the entry, in which case it ignores prev.
+// So offset must be a keyframe, random Read of a delta entry is not possible without replaying from the last keyframe before it.
+// apply must not modify the stored entry if it returns it (or part of it), the reconstructed payload is kept for the next entry,
+// so the callback must not modify it either. The apply errors are returned with the offset of the bad entry.
+func (ar *Reader) ScanDeltaDecode(offset uint32, apply func(prev, delta []byte) ([]byte, error), cb func([]byte, uint32, uint32) error) error {
+	var prev []byte
+	return ar.Scan(offset, func(data []byte, offset, next uint32) error {
+		full, err := apply(prev, data)
+		if err != nil {
+			return fmt.Errorf("pen: delta at offset %d: %w", offset, err)
+		}
+		prev = full
+		return cb(full, offset, next)
+	})
+}
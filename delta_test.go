@@ -0,0 +1,77 @@
+package pen
+
+import (
+	"bytes"
+	"errors"
+	"testing"
+)
+
+// flag 0 is a keyframe, flag 1 is a delta of [position, byte] pairs replacing bytes of prev
+func applyTestDelta(prev, delta []byte) ([]byte, error) {
+	if len(delta) == 0 {
+		return nil, EINVAL
+	}
+	if delta[0] == 0 {
+		return delta[1:], nil
+	}
+	if prev == nil || len(delta)%2 != 1 {
+		return nil, EINVAL
+	}
+	out := append([]byte{}, prev...)
+	for i := 1; i < len(delta); i += 2 {
+		if int(delta[i]) >= len(out) {
+			return nil, EINVAL
+		}
+		out[delta[i]] = delta[i+1]
+	}
+	return out, nil
+}
+
+func TestScanDeltaDecode(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	var expected [][]byte
+	var offsets []uint32
+	current := []byte("aaaaaaaaaa")
+	for i := 0; i < 50; i++ {
+		var entry []byte
+		if i%10 == 0 {
+			current = bytes.Repeat([]byte{byte('a' + i/10)}, 10)
+			entry = append([]byte{0}, current...)
+		} else {
+			current = append([]byte{}, current...)
+			current[i%10] = byte('0' + i%10)
+			entry = []byte{1, byte(i % 10), byte('0' + i%10)}
+		}
+		expected = append(expected, current)
+		off, _, err := fw.Append(entry)
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+
+	for _, start := range []int{0, 20} {
+		n := start
+		err := reader.ScanDeltaDecode(offsets[start], applyTestDelta, func(data []byte, offset, next uint32) error {
+			if offset != offsets[n] || !bytes.Equal(data, expected[n]) {
+				t.Fatalf("entry %d: expected %s got %s", n, expected[n], data)
+			}
+			n++
+			return nil
+		})
+		if err != nil || n != len(expected) {
+			t.Fatalf("scanned %d err %v", n, err)
+		}
+	}
+
+	// starting from a delta entry fails in apply
+	err := reader.ScanDeltaDecode(offsets[1], applyTestDelta, func(data []byte, offset, next uint32) error {
+		t.Fatal("unexpected entry")
+		return nil
+	})
+	if !errors.Is(err, EINVAL) {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+}
@@ -0,0 +1,111 @@
+package pen
+
+import (
+	"os"
+	"sync"
+	"sync/atomic"
+)
+
+// tracks the prefix of the file that is completely written, the concurrent appends can finish out of order
+type writtenTracker struct {
+	lock   sync.Mutex
+	prefix uint32
+	// start -> end of the writes that finished after the prefix
+	done map[uint32]uint32
+}
+
+// the write of [start, end) finished (or failed, the readers skip the garbage anyway)
+func (t *writtenTracker) finish(start, end uint32) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	if start > t.prefix {
+		if t.done == nil {
+			t.done = map[uint32]uint32{}
+		}
+		t.done[start] = end
+		return
+	}
+	if end > t.prefix {
+		t.prefix = end
+	}
+	for {
+		next, ok := t.done[t.prefix]
+		if !ok {
+			return
+		}
+		delete(t.done, t.prefix)
+		t.prefix = next
+	}
+}
+
+// everything before offset is written and nothing after it (serialized appends, truncate, new segment)
+func (t *writtenTracker) reset(offset uint32) {
+	t.lock.Lock()
+	t.prefix = offset
+	t.done = nil
+	t.lock.Unlock()
+}
+
+func (t *writtenTracker) get() uint32 {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+	return t.prefix
+}
+
+// Every entry before this offset is completely written, so a Reader of the same file (in this process, or another one on the same machine)
+// never sees torn entry before it, even with appends from many goroutines that finish out of order. It is not necessarily on disk, check DurableOffset.
+// With WriterOptions.MultiProcess it only tracks the appends of this Writer, the entries of the other processes before it could still be incomplete.
+func (fw *Writer) WrittenOffset() uint32 {
+	return fw.written.get()
+}
+
+// Every entry before this offset was written and synced (with Sync, GroupCommitWindow or Rotate), so it survives crash.
+// When the writer is opened it is the end of the existing file. Use it with Reader.SetHighWater so a consumer reads only durable entries:
+//	// producer
+//	w.Append(data)
+//	w.Sync()
+//
+//	// consumer in the same process
+//	r.SetHighWater(w.DurableOffset())
+//	r.Scan(from, process) // stops before the first entry that is not durable
+func (fw *Writer) DurableOffset() uint32 {
+	return atomic.LoadUint32(&fw.durable)
+}
+
+// sync the file and move the durable offset to what was written before the sync
+func (fw *Writer) syncFile(file *os.File) error {
+	written := fw.written.get()
+	err := file.Sync()
+	if err != nil {
+		return err
+	}
+	for {
+		durable := atomic.LoadUint32(&fw.durable)
+		if durable >= written || atomic.CompareAndSwapUint32(&fw.durable, durable, written) {
+			return nil
+		}
+	}
+}
+
+// the durable offset after truncate or rotate
+func (fw *Writer) resetDurable(offset uint32) {
+	fw.written.reset(offset)
+	for {
+		durable := atomic.LoadUint32(&fw.durable)
+		if durable <= offset || atomic.CompareAndSwapUint32(&fw.durable, durable, offset) {
+			return
+		}
+	}
+}
+
+// Make Read and Scan stop at offset (e.g. Writer.DurableOffset), as if the file ended there: Read returns io.EOF for the entries that do not end before it,
+// and Scan stops at the first of them. Use math.MaxUint32 to remove the limit. It is *safe* to call it concurrently with Read and Scan.
+func (ar *Reader) SetHighWater(offset uint32) {
+	atomic.StoreUint64(&ar.highWater, uint64(offset)+1)
+}
+
+// true if the entry [offset, next) is after the high water set with SetHighWater
+func (ar *Reader) afterHighWater(offset, next uint32) bool {
+	hw := atomic.LoadUint64(&ar.highWater)
+	return hw != 0 && (uint64(offset) >= hw-1 || uint64(next) > hw-1)
+}
@@ -0,0 +1,130 @@
+package pen
+
+import (
+	"fmt"
+	"io"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestWrittenTracker(t *testing.T) {
+	tracker := writtenTracker{}
+	tracker.reset(10)
+	tracker.finish(15, 20)
+	tracker.finish(12, 15)
+	if tracker.get() != 10 {
+		t.Fatalf("expected 10 got %d", tracker.get())
+	}
+	tracker.finish(10, 12)
+	if tracker.get() != 20 {
+		t.Fatalf("expected 20 got %d", tracker.get())
+	}
+	tracker.reset(5)
+	tracker.finish(5, 6)
+	if tracker.get() != 6 || len(tracker.done) != 0 {
+		t.Fatalf("expected 6 got %d", tracker.get())
+	}
+}
+
+func TestDurableOffset(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	first, next, err := fw.Append([]byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fw.WrittenOffset() != next || fw.DurableOffset() != 0 {
+		t.Fatalf("unexpected written %d durable %d", fw.WrittenOffset(), fw.DurableOffset())
+	}
+
+	reader.SetHighWater(fw.DurableOffset())
+	if _, _, err := reader.Read(first); err != io.EOF {
+		t.Fatalf("expected io.EOF got %v", err)
+	}
+	err = fw.Sync()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fw.DurableOffset() != next {
+		t.Fatalf("expected %d got %d", next, fw.DurableOffset())
+	}
+	reader.SetHighWater(fw.DurableOffset())
+	if data, _, err := reader.Read(first); err != nil || string(data) != "first" {
+		t.Fatalf("unexpected %q %v", data, err)
+	}
+
+	err = fw.TruncateTo(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fw.DurableOffset() != 0 || fw.WrittenOffset() != 0 {
+		t.Fatalf("expected 0 after truncate got %d %d", fw.DurableOffset(), fw.WrittenOffset())
+	}
+	reader.SetHighWater(math.MaxUint32)
+}
+
+// producers and consumer in the same process, the consumer never sees torn entry
+func TestDurableOffsetProducerConsumer(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	const producers = 4
+	const perProducer = 500
+	var wg sync.WaitGroup
+	for p := 0; p < producers; p++ {
+		wg.Add(1)
+		go func(p int) {
+			defer wg.Done()
+			for i := 0; i < perProducer; i++ {
+				_, _, err := fw.Append([]byte(fmt.Sprintf("%d/%d/%s", p, i, RandStringRunes(i%500))))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if i%50 == 0 {
+					if err := fw.Sync(); err != nil {
+						t.Error(err)
+						return
+					}
+				}
+			}
+		}(p)
+	}
+	finished := make(chan struct{})
+	go func() {
+		wg.Wait()
+		fw.Sync()
+		close(finished)
+	}()
+
+	seen := 0
+	from := uint32(0)
+	consume := func() {
+		reader.SetHighWater(fw.DurableOffset())
+		errs, err := reader.ScanCollectErrors(from, func(data []byte, offset, next uint32) error {
+			seen++
+			from = next
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(errs) != 0 {
+			t.Fatalf("consumer saw torn entries %v", errs)
+		}
+	}
+	for {
+		select {
+		case <-finished:
+			consume()
+			if seen != producers*perProducer {
+				t.Fatalf("expected %d got %d", producers*perProducer, seen)
+			}
+			return
+		default:
+			consume()
+		}
+	}
+}
@@ -0,0 +1,65 @@
+package pen
+
+import (
+	"archive/tar"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Write every payload followed by newline, for tools like jq. The payloads are assumed to be JSON, the ones that contain newline (e.g. indented JSON)
+// are compacted with json.Compact, and if that fails (it is not JSON) the error is returned with the offset, use ExportTar for arbitrary payloads.
+// The entries are read with ScanNoCopy and written through bufio.Writer, so nothing is buffered besides the current entry.
+func (ar *Reader) ExportNDJSON(w io.Writer) error {
+	bw := bufio.NewWriter(w)
+	var compacted bytes.Buffer
+	err := ar.ScanNoCopy(0, func(data []byte, offset, next uint32) error {
+		if bytes.IndexByte(data, '\n') >= 0 {
+			compacted.Reset()
+			err := json.Compact(&compacted, data)
+			if err != nil {
+				return fmt.Errorf("pen: export at offset %d: %w", offset, err)
+			}
+			data = compacted.Bytes()
+		}
+		_, err := bw.Write(data)
+		if err == nil {
+			err = bw.WriteByte('\n')
+		}
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return bw.Flush()
+}
+
+// Write tar archive with every payload as a file named nameFn(offset) (the offset as 10 digit number if nameFn is nil), for tools like tar.
+// The files have mode 0644 and zero modification time. The entries are read with ScanNoCopy, so nothing is buffered besides the current entry.
+func (ar *Reader) ExportTar(w io.Writer, nameFn func(offset uint32) string) error {
+	if nameFn == nil {
+		nameFn = func(offset uint32) string {
+			return fmt.Sprintf("%010d", offset)
+		}
+	}
+	tw := tar.NewWriter(w)
+	err := ar.ScanNoCopy(0, func(data []byte, offset, next uint32) error {
+		err := tw.WriteHeader(&tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     nameFn(offset),
+			Mode:     0644,
+			Size:     int64(len(data)),
+		})
+		if err != nil {
+			return err
+		}
+		_, err = tw.Write(data)
+		return err
+	})
+	if err != nil {
+		return err
+	}
+	return tw.Close()
+}
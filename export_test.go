@@ -0,0 +1,97 @@
+package pen
+
+import (
+	"archive/tar"
+	"bytes"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestExportNDJSON(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	for _, e := range []string{`{"a":1}`, "{\n  \"b\": \"x\\ny\"\n}", `[1,2]`} {
+		_, _, err := fw.Append([]byte(e))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	var out bytes.Buffer
+	err := reader.ExportNDJSON(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != "{\"a\":1}\n{\"b\":\"x\\ny\"}\n[1,2]\n" {
+		t.Fatalf("unexpected %q", out.String())
+	}
+
+	bad, _, err := fw.Append([]byte("not\njson"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = reader.ExportNDJSON(io.Discard)
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("offset %d", bad)) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestExportTar(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	expected := map[string]string{}
+	for i := 0; i < 10; i++ {
+		d := RandStringRunes(i * 100)
+		off, _, err := fw.Append([]byte(d))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected[fmt.Sprintf("%010d", off)] = d
+	}
+
+	var out bytes.Buffer
+	err := reader.ExportTar(&out, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr := tar.NewReader(&out)
+	n := 0
+	for {
+		h, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if expected[h.Name] != string(data) {
+			t.Fatalf("mismatch for %s", h.Name)
+		}
+		n++
+	}
+	if n != 10 {
+		t.Fatalf("expected 10 files got %d", n)
+	}
+
+	out.Reset()
+	err = reader.ExportTar(&out, func(offset uint32) string {
+		return fmt.Sprintf("entries/%d.bin", offset)
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	h, err := tar.NewReader(&out).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if h.Name != "entries/0.bin" {
+		t.Fatalf("unexpected name %s", h.Name)
+	}
+}
@@ -0,0 +1,18 @@
+//go:build linux
+// +build linux
+
+package pen
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+func fadviseSequential(file *os.File, from int64) error {
+	return unix.Fadvise(int(file.Fd()), from, 0, unix.FADV_SEQUENTIAL)
+}
+
+func fadviseDontNeed(file *os.File, from int64) error {
+	return unix.Fadvise(int(file.Fd()), from, 0, unix.FADV_DONTNEED)
+}
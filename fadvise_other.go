@@ -0,0 +1,15 @@
+//go:build !linux
+// +build !linux
+
+package pen
+
+import "os"
+
+// fadvise is not available, so the advice is just ignored
+func fadviseSequential(file *os.File, from int64) error {
+	return nil
+}
+
+func fadviseDontNeed(file *os.File, from int64) error {
+	return nil
+}
@@ -0,0 +1,100 @@
+package pen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+)
+
+// magic of the file crc trailer written by WriterOptions{FileCRC: true}, it is different from MAGIC so Scan skips the trailer
+var TRAILER_MAGIC = []byte{0xc, 0x5, 0xc, 0xe}
+
+var ErrNoTrailer = errors.New("no file crc trailer")
+
+// the trailer is normal entry (with TRAILER_MAGIC) with 12 bytes of data:
+//   8 bytes LE length of the file before the trailer
+//   4 bytes LE crc32(IEEE) of the file before the trailer
+const trailerSize = 16 + 12
+
+func fileCRC(reader io.ReaderAt, size int64) (uint32, error) {
+	h := crc32.NewIEEE()
+	_, err := io.Copy(h, io.NewSectionReader(reader, 0, size))
+	if err != nil {
+		return 0, err
+	}
+	return h.Sum32(), nil
+}
+
+func (fw *Writer) writeTrailer() error {
+	fw.appendLock.Lock()
+	defer fw.appendLock.Unlock()
+
+	start := byteOffset(fw.offset)
+	crc := crc32.Update(fw.crc, crc32.IEEETable, make([]byte, start-fw.end))
+
+	data := make([]byte, 12)
+	binary.LittleEndian.PutUint64(data, uint64(start))
+	binary.LittleEndian.PutUint32(data[8:], crc)
+
+	blob := entryBlob(data, TRAILER_MAGIC)
+
+	var err error
+	if fw.appendMode {
+		_, err = fw.file.Write(append(make([]byte, start-fw.end), blob...))
+	} else {
+		_, err = fw.file.WriteAt(blob, start)
+	}
+	return err
+}
+
+// true if there is a valid trailer at offset, and it is the last thing in the file
+func (ar *Reader) trailerAt(offset uint32) bool {
+	blob := make([]byte, trailerSize+1)
+	n, _ := readFullAt(ar.reader, blob, byteOffset(offset))
+	return n == trailerSize && validTrailer(blob[:trailerSize])
+}
+
+func validTrailer(blob []byte) bool {
+	header, data := blob[:16], blob[16:]
+	return bytes.Equal(header[8:12], TRAILER_MAGIC) &&
+		binary.LittleEndian.Uint32(header[12:]) == uint32(Hash(header[:12])) &&
+		binary.LittleEndian.Uint32(header) == uint32(len(data)) &&
+		binary.LittleEndian.Uint32(header[4:]) == uint32(Hash(data))
+}
+
+// Check the crc trailer written by WriterOptions{FileCRC: true} at the end of the file, returns ErrNoTrailer if the file does not end with a trailer
+// and EBADSLT if the file does not match it (bit rot, or it was truncated or appended to without the trailer).
+func (ar *Reader) VerifyFileCRC() error {
+	size, err := ar.size()
+	if err != nil {
+		return err
+	}
+	start := size - trailerSize
+	if start < 0 {
+		return ErrNoTrailer
+	}
+
+	blob := make([]byte, trailerSize)
+	_, err = readFullAt(ar.reader, blob, start)
+	if err != nil {
+		return err
+	}
+	if !validTrailer(blob) {
+		return ErrNoTrailer
+	}
+	data := blob[16:]
+
+	if int64(binary.LittleEndian.Uint64(data)) != start {
+		return EBADSLT
+	}
+	crc, err := fileCRC(ar.reader, start)
+	if err != nil {
+		return err
+	}
+	if crc != binary.LittleEndian.Uint32(data[8:]) {
+		return EBADSLT
+	}
+	return nil
+}
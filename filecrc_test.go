@@ -0,0 +1,140 @@
+package pen
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestFileCRC(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "forward")
+
+	for _, flags := range []int{0, os.O_APPEND} {
+		os.Remove(fn)
+		for round := 0; round < 3; round++ {
+			w, err := NewWriterWithOptions(fn, WriterOptions{FileCRC: true, OpenFlags: flags})
+			if err != nil {
+				t.Fatal(err)
+			}
+			for i := 0; i < 100; i++ {
+				_, _, err := w.Append([]byte(RandStringRunes(i)))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err = w.Overwrite(0, []byte("a"))
+			if err != EINVAL {
+				t.Fatalf("expected EINVAL got %v", err)
+			}
+			err = w.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			r, err := NewReader(fn, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			err = r.VerifyFileCRC()
+			if err != nil {
+				t.Fatal(err)
+			}
+			n := 0
+			err = r.ScanWithOptions(0, ScanOptions{ReportTruncated: true}, func(data []byte, offset, next uint32) error {
+				n++
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != 100*(round+1) {
+				t.Fatalf("expected %d got %d", 100*(round+1), n)
+			}
+			_, garbage, err := r.TailState()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if garbage != 0 {
+				t.Fatalf("expected no garbage got %d", garbage)
+			}
+			r.Close()
+		}
+
+		// bit rot
+		f, err := os.OpenFile(fn, os.O_RDWR, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = f.WriteAt([]byte{0xff}, 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Close()
+
+		r, err := NewReader(fn, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = r.VerifyFileCRC()
+		if err != EBADSLT {
+			t.Fatalf("expected EBADSLT got %v", err)
+		}
+
+		// appended without the trailer
+		w, err := NewWriter(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = w.Append([]byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Close()
+		err = r.VerifyFileCRC()
+		if err != ErrNoTrailer {
+			t.Fatalf("expected ErrNoTrailer got %v", err)
+		}
+		r.Close()
+	}
+}
+
+func TestFileCRCTrailerIsNotCorruption(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "forward")
+
+	w, err := NewWriterWithOptions(fn, WriterOptions{FileCRC: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		_, _, err := w.Append([]byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+
+	r, err := NewReader(fn, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	n := 0
+	errs, err := r.ScanCollectErrors(0, func(data []byte, offset, next uint32) error {
+		n++
+		return nil
+	})
+	if err != nil || len(errs) != 0 || n != 10 {
+		t.Fatalf("unexpected %d %v %v", n, errs, err)
+	}
+}
@@ -0,0 +1,121 @@
+package pen
+
+import (
+	"errors"
+	"io"
+)
+
+// returned by FindByChecksum when no entry has the checksum
+var ErrNotFound = errors.New("entry not found")
+
+// Find the first entry whose stored data checksum (uint32(Hash(data)), see PayloadChecksum and AppendResult.DataChecksum) is checksum, and Read it.
+// Only the headers are read until a match, so it is a cheap scan for content addressed lookup, the matching entry is fully verified,
+// if its data is corrupted (or it is a checksum collision of an invalid entry) the search continues. Returns ErrNotFound if no entry matches.
+// For repeated lookups build the index once with ChecksumIndex and use FindByChecksumIn. It does not support ReaderOptions.FixedSize (EINVAL).
+func (ar *Reader) FindByChecksum(checksum uint32) ([]byte, uint32, uint32, error) {
+	var data []byte
+	var offset, next uint32
+	err := ar.scanChecksums(func(c, o, n uint32) error {
+		if c != checksum {
+			return nil
+		}
+		d, n, err := ar.Read(o)
+		if err == EBADSLT {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		data, offset, next = d, o, n
+		return errStopScan
+	})
+	if err == errStopScan {
+		return data, offset, next, nil
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	return nil, 0, 0, ErrNotFound
+}
+
+// Index of stored data checksum -> offset of all entries for FindByChecksumIn, built with the same header only scan as FindByChecksum,
+// for duplicated data the first entry wins. It uses about 8 bytes per distinct checksum plus the map overhead.
+func (ar *Reader) ChecksumIndex() (map[uint32]uint32, error) {
+	index := map[uint32]uint32{}
+	err := ar.scanChecksums(func(checksum, offset, next uint32) error {
+		if _, ok := index[checksum]; !ok {
+			index[checksum] = offset
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// Same as FindByChecksum but with the index from ChecksumIndex, so it is one Read, the entry must still have the checksum (ErrNotFound otherwise).
+func (ar *Reader) FindByChecksumIn(index map[uint32]uint32, checksum uint32) ([]byte, uint32, uint32, error) {
+	offset, ok := index[checksum]
+	if !ok {
+		return nil, 0, 0, ErrNotFound
+	}
+	data, next, err := ar.Read(offset)
+	if err == io.EOF {
+		return nil, 0, 0, ErrNotFound
+	}
+	if err != nil {
+		return nil, 0, 0, err
+	}
+	stored, _, err := ar.PayloadChecksum(offset)
+	if err != nil {
+		// entry without the normal header
+		stored = uint32(Hash(data))
+	}
+	if stored != checksum {
+		return nil, 0, 0, ErrNotFound
+	}
+	return data, offset, next, nil
+}
+
+// call cb with the stored data checksum of every entry, reading only the headers of the normal entries,
+// everything else (compact entries, corruption, reserved entries) is handled by Scan, and the checksum is computed from the data
+func (ar *Reader) scanChecksums(cb func(checksum, offset, next uint32) error) error {
+	if ar.opts.FixedSize > 0 {
+		return EINVAL
+	}
+	offset := uint32(0)
+	for {
+		checksum, next, err := ar.PayloadChecksum(offset)
+		if err == io.EOF {
+			return nil
+		}
+		if err == nil {
+			err = cb(checksum, offset, next)
+			if err != nil {
+				return err
+			}
+			offset = next
+			continue
+		}
+
+		// one entry the same way as Scan, it could resync after offset
+		found := false
+		var cbErr error
+		err = ar.Scan(offset, func(data []byte, o, next uint32) error {
+			found = true
+			offset = next
+			cbErr = cb(uint32(Hash(data)), o, next)
+			return errStopScan
+		})
+		if err != nil && err != errStopScan {
+			return err
+		}
+		if cbErr != nil {
+			return cbErr
+		}
+		if !found {
+			return nil
+		}
+	}
+}
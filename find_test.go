@@ -0,0 +1,66 @@
+package pen
+
+import (
+	"bytes"
+	"fmt"
+	"testing"
+)
+
+func TestFindByChecksum(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	if _, _, _, err := reader.FindByChecksum(uint32(Hash([]byte("x")))); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+
+	offsets := []uint32{}
+	for i := 0; i < 20; i++ {
+		off, _, err := fw.Append([]byte(fmt.Sprintf("entry %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	// duplicate of entry 7, the index and FindByChecksum return the first one
+	dup, _, err := fw.Append([]byte("entry 7"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	index, err := reader.ChecksumIndex()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(index) != 20 || index[uint32(Hash([]byte("entry 7")))] != offsets[7] {
+		t.Fatalf("unexpected index %v", index)
+	}
+
+	for _, i := range []int{0, 7, 19} {
+		expected := []byte(fmt.Sprintf("entry %d", i))
+		for _, find := range []func(uint32) ([]byte, uint32, uint32, error){reader.FindByChecksum, func(c uint32) ([]byte, uint32, uint32, error) {
+			return reader.FindByChecksumIn(index, c)
+		}} {
+			data, offset, next, err := find(uint32(Hash(expected)))
+			if err != nil || !bytes.Equal(data, expected) || offset != offsets[i] || next <= offset {
+				t.Fatalf("entry %d: unexpected %q %d %v", i, data, offset, err)
+			}
+		}
+	}
+
+	// corrupt the first entry 7, the duplicate is found
+	_, err = fw.file.WriteAt([]byte{'x'}, byteOffset(offsets[7])+16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, offset, _, err := reader.FindByChecksum(uint32(Hash([]byte("entry 7"))))
+	if err != nil || offset != dup {
+		t.Fatalf("expected %d got %d %v", dup, offset, err)
+	}
+	if _, _, _, err := reader.FindByChecksumIn(index, uint32(Hash([]byte("entry 7")))); err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+	if _, _, _, err := reader.FindByChecksumIn(index, 1); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+}
@@ -2,7 +2,9 @@ package pen
 
 import (
 	"encoding/binary"
+	"io"
 	"os"
+	"sync/atomic"
 )
 
 const FixedHeaderSize = 8
@@ -15,16 +17,23 @@ const FixedHeaderSize = 8
 //   ...
 //   fixed size data
 func FixedWriteAt(file *os.File, index uint64, encoded []byte) error {
+	_, err := fixedWriteAt(file, index, encoded)
+	return err
+}
+
+// FixedWriteAt that returns the stored checksum
+func fixedWriteAt(file *os.File, index uint64, encoded []byte) (uint64, error) {
 	blobSize := FixedHeaderSize + len(encoded)
 	blob := make([]byte, blobSize)
 	copy(blob[FixedHeaderSize:], encoded)
 
-	binary.LittleEndian.PutUint64(blob, Hash(encoded))
+	checksum := Hash(encoded)
+	binary.LittleEndian.PutUint64(blob, checksum)
 	_, err := file.WriteAt(blob, int64(index*uint64(blobSize)))
 	if err != nil {
-		return err
+		return 0, err
 	}
-	return nil
+	return checksum, nil
 }
 
 // Calculate the amount of objects based on the given fixed size
@@ -54,3 +63,37 @@ func FixedReadAt(file *os.File, index uint64, into []byte) error {
 	copy(into, block[FixedHeaderSize:])
 	return nil
 }
+
+func fixedRecordSize(fixedSize int) int64 {
+	return int64(FixedHeaderSize + fixedSize)
+}
+
+// Append with WriterOptions.FixedSize, the offset is just bumped by one record
+func (fw *Writer) appendFixed(encoded []byte) (uint32, uint32, uint32, error) {
+	if len(encoded) != fw.fixedSize {
+		return 0, 0, 0, EINVAL
+	}
+	current := atomic.AddUint32(&fw.offset, 1) - 1
+	checksum, err := fixedWriteAt(fw.file, uint64(current), encoded)
+	fw.written.finish(current, current+1)
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	return current, current + 1, uint32(checksum), nil
+}
+
+// Read with ReaderOptions.FixedSize, a record cut short by the end of the file is ErrTruncated
+func (ar *Reader) readFixed(offset uint32) ([]byte, uint32, error) {
+	block := make([]byte, fixedRecordSize(ar.opts.FixedSize))
+	n, err := readFullAt(ar.reader, block, int64(offset)*fixedRecordSize(ar.opts.FixedSize))
+	if n < len(block) {
+		if n > 0 && err == io.EOF {
+			err = ErrTruncated
+		}
+		return nil, 0, err
+	}
+	if binary.LittleEndian.Uint64(block) != Hash(block[FixedHeaderSize:]) {
+		return nil, 0, EBADSLT
+	}
+	return block[FixedHeaderSize:], offset + 1, nil
+}
@@ -0,0 +1,134 @@
+package pen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestFixedSize(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "forward")
+
+	_, err = NewWriterWithOptions(fn, WriterOptions{FixedSize: 64, FileCRC: true})
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+	_, err = NewWriterWithOptions(fn, WriterOptions{FixedSize: 64, OpenFlags: os.O_APPEND})
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+
+	record := func(i int) []byte {
+		return bytes.Repeat([]byte{byte(i)}, 64)
+	}
+	for round := 0; round < 2; round++ {
+		w, err := NewWriterWithOptions(fn, WriterOptions{FixedSize: 64})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := round * 50; i < (round+1)*50; i++ {
+			off, next, err := w.Append(record(i))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if off != uint32(i) || next != off+1 {
+				t.Fatalf("expected %d got %d %d", i, off, next)
+			}
+		}
+		_, _, err = w.Append(make([]byte, 63))
+		if err != EINVAL {
+			t.Fatalf("expected EINVAL got %v", err)
+		}
+		w.Close()
+	}
+
+	s, err := os.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Size() != 100*(64+FixedHeaderSize) {
+		t.Fatalf("unexpected size %d", s.Size())
+	}
+
+	r, err := NewReaderWithOptions(fn, 0, ReaderOptions{FixedSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	data, next, err := r.Read(42)
+	if err != nil || !bytes.Equal(data, record(42)) || next != 43 {
+		t.Fatalf("unexpected %v %d %v", data, next, err)
+	}
+	into := make([]byte, 64)
+	err = FixedReadAt(r.file, 42, into)
+	if err != nil || !bytes.Equal(into, record(42)) {
+		t.Fatalf("unexpected %v %v", into, err)
+	}
+
+	// corrupt one record, and a torn one at the end
+	w, err := NewWriterWithOptions(fn, WriterOptions{FixedSize: 64})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	_, err = w.file.WriteAt([]byte{0xff}, 10*(64+FixedHeaderSize)+20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = w.file.WriteAt([]byte{1, 2, 3}, 100*(64+FixedHeaderSize))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = r.Read(10)
+	if err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+	_, _, err = r.Read(100)
+	if err != ErrTruncated {
+		t.Fatalf("expected ErrTruncated got %v", err)
+	}
+
+	seen := []uint32{}
+	err = r.Scan(0, func(data []byte, offset, next uint32) error {
+		if !bytes.Equal(data, record(int(offset))) {
+			t.Fatalf("unexpected data at %d", offset)
+		}
+		seen = append(seen, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 99 || seen[10] != 11 {
+		t.Fatalf("unexpected %v", seen)
+	}
+
+	// overwrite fixes the record, and the torn one is overwritten by the next append
+	err = w.Overwrite(10, record(10))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Overwrite(10, record(10)[1:])
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+	off, _, err := w.Append(record(100))
+	if err != nil || off != 100 {
+		t.Fatalf("unexpected %d %v", off, err)
+	}
+	n := 0
+	err = r.Scan(0, func(data []byte, offset, next uint32) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 101 {
+		t.Fatalf("unexpected %d %v", n, err)
+	}
+}
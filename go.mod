@@ -1,5 +1,8 @@
 module github.com/rekki/go-pen
 
-go 1.13
+go 1.18
 
-require github.com/dgryski/go-metro v0.0.0-20180109044635-280f6062b5bc
+require (
+	github.com/dgryski/go-metro v0.0.0-20180109044635-280f6062b5bc
+	golang.org/x/sys v0.15.0
+)
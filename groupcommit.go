@@ -0,0 +1,46 @@
+package pen
+
+import (
+	"sync"
+	"time"
+)
+
+// the appends waiting for the same fsync, see WriterOptions.GroupCommitWindow
+type commitGroup struct {
+	done chan struct{}
+	err  error
+}
+
+type groupCommit struct {
+	lock    sync.Mutex
+	current *commitGroup
+}
+
+// wait until everything written before the call is synced, the first caller opens a group which is synced GroupCommitWindow later,
+// everyone who calls it until then waits for the same fsync
+func (fw *Writer) waitGroupCommit() error {
+	g := &fw.group
+	g.lock.Lock()
+	current := g.current
+	if current == nil {
+		current = &commitGroup{done: make(chan struct{})}
+		g.current = current
+		time.AfterFunc(fw.opts.GroupCommitWindow, func() {
+			// close the group before syncing, so the appends written after the sync started wait for the next one
+			g.lock.Lock()
+			g.current = nil
+			g.lock.Unlock()
+
+			fw.appendLock.Lock()
+			file := fw.file
+			fw.appendLock.Unlock()
+
+			current.err = fw.syncFile(file)
+			close(current.done)
+		})
+	}
+	g.lock.Unlock()
+
+	<-current.done
+	return current.err
+}
@@ -0,0 +1,116 @@
+package pen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newGroupCommitWriter(t testing.TB, window time.Duration) (*Writer, string, func()) {
+	dir, err := ioutil.TempDir("", "group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := path.Join(dir, "group")
+	fw, err := NewWriterWithOptions(fn, WriterOptions{GroupCommitWindow: window})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fw, fn, func() {
+		fw.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestGroupCommit(t *testing.T) {
+	window := 50 * time.Millisecond
+	fw, fn, done := newGroupCommitWriter(t, window)
+	defer done()
+
+	started := time.Now()
+	var wg sync.WaitGroup
+	offsets := make([]uint32, 100)
+	errs := make([]error, 100)
+	for i := range offsets {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			offsets[i], _, errs[i] = fw.Append([]byte(fmt.Sprintf("%d", i)))
+		}(i)
+	}
+	wg.Wait()
+	took := time.Since(started)
+	if took < window {
+		t.Fatalf("returned before the window %v", took)
+	}
+	// all of them should fit in few groups, not 100 windows
+	if took > 20*window {
+		t.Fatalf("took too long %v", took)
+	}
+
+	reader, err := NewReader(fn, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	for i, off := range offsets {
+		if errs[i] != nil {
+			t.Fatal(errs[i])
+		}
+		data, _, err := reader.Read(off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != fmt.Sprintf("%d", i) {
+			t.Fatalf("entry %d mismatch %q", i, data)
+		}
+	}
+
+	batch, err := fw.AppendBatch([][]byte{[]byte("a"), []byte("b")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(batch) != 2 {
+		t.Fatalf("expected 2 offsets got %d", len(batch))
+	}
+}
+
+func BenchmarkGroupCommit(b *testing.B) {
+	data := make([]byte, 100)
+	for _, concurrency := range []int{1, 8, 64} {
+		for _, window := range []time.Duration{0, time.Millisecond} {
+			name := fmt.Sprintf("concurrency=%d/fsync", concurrency)
+			if window > 0 {
+				name = fmt.Sprintf("concurrency=%d/group=%v", concurrency, window)
+			}
+			b.Run(name, func(b *testing.B) {
+				fw, _, done := newGroupCommitWriter(b, window)
+				defer done()
+
+				b.ResetTimer()
+				var wg sync.WaitGroup
+				for g := 0; g < concurrency; g++ {
+					wg.Add(1)
+					go func(g int) {
+						defer wg.Done()
+						for i := g; i < b.N; i += concurrency {
+							_, _, err := fw.Append(data)
+							if err == nil && window == 0 {
+								err = fw.Sync()
+							}
+							if err != nil {
+								b.Error(err)
+								return
+							}
+						}
+					}(g)
+				}
+				wg.Wait()
+			})
+		}
+	}
+}
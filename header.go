@@ -0,0 +1,249 @@
+package pen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// The 16 byte header in front of every entry
+//   4 bytes LE len(data) [1] // LE = Little Endian
+//   4 bytes LE HASH(data)[2] // go-metro
+//   4 bytes MAGIC        [3] // 0xbeef
+//   4 bytes LE HASH(1 2 3)   // hash of the first 12 bytes
+// There are no reserved bytes, every field is covered by the header checksum, so a bit flip anywhere in the header
+// (including the data checksum) is detected. Any future field stored in the header (e.g. a key) must be covered by it as well.
+type Header struct {
+	Length         uint32
+	DataChecksum   uint32
+	Magic          [4]byte
+	HeaderChecksum uint32
+}
+
+// Decode the first 16 bytes of b into Header regardless if it is valid or not, returns false if it is not valid (or b is shorter than 16 bytes)
+// The compact entries (WriterOptions.CompactHeader) do not have this header, so they are never valid, see ErrCompactEntry.
+func ParseHeader(b []byte) (Header, bool) {
+	if len(b) < 16 {
+		return Header{}, false
+	}
+	h := Header{
+		Length:         binary.LittleEndian.Uint32(b[0:]),
+		DataChecksum:   binary.LittleEndian.Uint32(b[4:]),
+		HeaderChecksum: binary.LittleEndian.Uint32(b[12:]),
+	}
+	copy(h.Magic[:], b[8:12])
+	return h, h.Valid()
+}
+
+// Check if the header checksum matches the other fields and the magic is MAGIC (or TRANSFORM_MAGIC)
+func (h Header) Valid() bool {
+	b := make([]byte, 12)
+	binary.LittleEndian.PutUint32(b[0:], h.Length)
+	binary.LittleEndian.PutUint32(b[4:], h.DataChecksum)
+	copy(b[8:], h.Magic[:])
+	return (bytes.Equal(h.Magic[:], MAGIC) || bytes.Equal(h.Magic[:], TRANSFORM_MAGIC)) && uint32(Hash(b)) == h.HeaderChecksum
+}
+
+func (h Header) String() string {
+	return fmt.Sprintf("length: %d, data checksum: %08x, magic: %x, header checksum: %08x, valid: %v", h.Length, h.DataChecksum, h.Magic, h.HeaderChecksum, h.Valid())
+}
+
+// Read the entry at offset without refusing corrupted data, for forensic and recovery tools, use Read for everything else.
+// headerValid and dataValid tell which checksum matched (the magic is checked unless ReaderOptions.SkipMagic is set).
+// If the header is not valid the length can not be trusted, so payload is nil and next is offset+1 (same as Scan resyncing).
+// If the payload is cut short by the end of the file, the partial payload is returned with ErrTruncated, if there is nothing at offset it returns io.EOF.
+// A valid compact entry returns ErrCompactEntry with its next offset.
+func (ar *Reader) ReadRaw(offset uint32) (header []byte, payload []byte, headerValid bool, dataValid bool, next uint32, err error) {
+	header = make([]byte, 16)
+	n, err := readFullAt(ar.reader, header, byteOffset(offset))
+	if next, ok := compactAt(ar.reader, offset, header[:n]); ok {
+		return header[:n], nil, false, false, next, ErrCompactEntry
+	}
+	if n < 16 {
+		if n > 0 && err == io.EOF {
+			err = ErrTruncated
+		}
+		return header[:n], nil, false, false, 0, err
+	}
+	h, _ := ParseHeader(header)
+	headerValid = h.Valid() || (ar.opts.SkipMagic && uint32(Hash(header[:12])) == h.HeaderChecksum)
+	if !headerValid {
+		return header, nil, false, false, offset + 1, nil
+	}
+
+	payload = make([]byte, ar.entryLen(h.Length))
+	n, err = readFullAt(ar.reader, payload, byteOffset(offset)+16)
+	if n < len(payload) {
+		if err == io.EOF {
+			err = ErrTruncated
+		}
+		if n > int(h.Length) {
+			n = int(h.Length)
+		}
+		return header, payload[:n], true, false, 0, err
+	}
+	checksum := h.DataChecksum
+	if ar.opts.TrailingDataChecksum {
+		checksum = binary.LittleEndian.Uint32(payload[h.Length:])
+		payload = payload[:h.Length]
+	}
+	return header, payload, true, uint32(Hash(payload)) == checksum, ar.entryNext(offset, h.Length), nil
+}
+
+// length of the entry after the header, with ReaderOptions.TrailingDataChecksum the checksum is after the data
+func (ar *Reader) entryLen(dataLen uint32) int {
+	if ar.opts.TrailingDataChecksum {
+		return int(dataLen) + 4
+	}
+	return int(dataLen)
+}
+
+// offset of the entry after the one at offset with data of the given length
+func (ar *Reader) entryNext(offset uint32, dataLen uint32) uint32 {
+	return nextOffsetSize(offset, 16+ar.entryLen(dataLen))
+}
+
+// Read only the header at offset, and return the stored data checksum (uint32 of Hash(data)) and the next offset, without reading the data
+// (with ReaderOptions.TrailingDataChecksum only the 4 bytes after the data are read). Only the header checksum is verified, so the data itself could still be corrupted, use Read to check it. Returns io.EOF if there is nothing at offset.
+// The compact entries do not store the data checksum, for them it returns ErrCompactEntry (hash the data from Read instead).
+func (ar *Reader) PayloadChecksum(offset uint32) (uint32, uint32, error) {
+	header := make([]byte, 16)
+	n, err := readFullAt(ar.reader, header, byteOffset(offset))
+	if n < 16 {
+		if n > 0 && err == io.EOF {
+			err = ErrTruncated
+		}
+		return 0, 0, err
+	}
+	h, ok := ParseHeader(header)
+	if !ok && !(ar.opts.SkipMagic && uint32(Hash(header[:12])) == h.HeaderChecksum) {
+		if _, compact := compactAt(ar.reader, offset, header); compact {
+			return 0, 0, ErrCompactEntry
+		}
+		return 0, 0, EBADSLT
+	}
+	next := ar.entryNext(offset, h.Length)
+	if next <= offset {
+		return 0, 0, EBADSLT
+	}
+	if ar.opts.TrailingDataChecksum {
+		trailer := make([]byte, 4)
+		n, err := readFullAt(ar.reader, trailer, byteOffset(offset)+16+int64(h.Length))
+		if n < 4 {
+			if err == io.EOF {
+				err = ErrTruncated
+			}
+			return 0, 0, readError(offset, err)
+		}
+		return binary.LittleEndian.Uint32(trailer), next, nil
+	}
+	return h.DataChecksum, next, nil
+}
+
+// Find the entry whose range [start, next) contains the byte position (e.g. position inside a payload from a crash dump), returns its offset and the length of its data.
+// There are no back links, so it scans forward from a window before bytePos, which is doubled until the entries found in it are chained up to the one containing bytePos
+// (or it starts at 0), same as LastN. If ScanReverseN already built the index of the file, it is used instead.
+// Returns io.EOF if bytePos is at or after the end of the file, and EBADSLT if it is inside corrupted region (no valid entry contains it).
+func (ar *Reader) EntryContaining(bytePos int64) (uint32, uint32, error) {
+	size, err := ar.size()
+	if err != nil {
+		return 0, 0, err
+	}
+	if bytePos < 0 {
+		return 0, 0, EINVAL
+	}
+	if bytePos >= size {
+		return 0, 0, io.EOF
+	}
+
+	if offset, ok := ar.indexContaining(bytePos); ok {
+		data, next, err := ar.Read(offset)
+		if err == nil && bytePos < byteOffset(next) {
+			return offset, uint32(len(data)), nil
+		}
+	}
+
+	window := int64(ar.blockSize)
+	if window < 64*1024 {
+		window = 64 * 1024
+	}
+	for {
+		start := bytePos - window
+		if start < 0 {
+			start = 0
+		}
+		found := 0
+		chained := true
+		prevNext := uint32(0)
+		var offset, length uint32
+		contains := false
+		err := ar.ScanNoCopy(uint32(start/int64(PAD)), func(data []byte, o, next uint32) error {
+			if byteOffset(o) > bytePos {
+				return errStopScan
+			}
+			if found > 0 && o != prevNext {
+				chained = false
+			}
+			found++
+			prevNext = next
+			if bytePos < byteOffset(next) {
+				offset, length, contains = o, uint32(len(data)), true
+				return errStopScan
+			}
+			return nil
+		})
+		if err != nil && err != errStopScan {
+			return 0, 0, err
+		}
+		// the first entry found could be inside a payload, so some entry before it has to be chained to it
+		if start == 0 || (contains && found > 1 && chained) {
+			if !contains {
+				return 0, 0, EBADSLT
+			}
+			return offset, length, nil
+		}
+		window *= 2
+	}
+}
+
+// the offset of the entry that could contain bytePos from the ScanReverseN index
+func (ar *Reader) indexContaining(bytePos int64) (uint32, bool) {
+	ar.indexLock.Lock()
+	defer ar.indexLock.Unlock()
+	if len(ar.index) == 0 || bytePos >= byteOffset(ar.indexNext) {
+		return 0, false
+	}
+	i := sort.Search(len(ar.index), func(i int) bool {
+		return byteOffset(ar.index[i]) > bytePos
+	})
+	if i == 0 {
+		return 0, false
+	}
+	return ar.index[i-1], true
+}
+
+// Check if the entry at offset has exactly the expected data. The length and the data checksum in the header are compared first, so when they are
+// different the data is not read at all (false is definitive, there is no need to read it), only if they match the data is read (verifying its checksum)
+// and compared byte by byte, so true is also definitive, there are no false positives from checksum collisions.
+// Entries without the normal header (e.g. compact) and the entries written with WriterOptions.Transforms are just read and compared.
+func (ar *Reader) CompareAt(offset uint32, expected []byte) (bool, uint32, error) {
+	header := make([]byte, 16)
+	n, err := readFullAt(ar.reader, header, byteOffset(offset))
+	if n == 16 {
+		h, ok := ParseHeader(header)
+		// the header of the transformed entries describes the encoded data, so only the plain entries can be rejected from it
+		if ok && bytes.Equal(h.Magic[:], MAGIC) && (h.Length != uint32(len(expected)) || (!ar.opts.TrailingDataChecksum && h.DataChecksum != uint32(Hash(expected)))) {
+			return false, ar.entryNext(offset, h.Length), nil
+		}
+	} else if n == 0 && err != nil {
+		return false, 0, readError(offset, err)
+	}
+
+	data, next, err := ar.Read(offset)
+	if err != nil {
+		return false, 0, err
+	}
+	return bytes.Equal(data, expected), next, nil
+}
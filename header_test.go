@@ -0,0 +1,288 @@
+package pen
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestParseHeader(t *testing.T) {
+	blob := bytes.NewBuffer(nil)
+	data := []byte("hello")
+	err := WriteAtWriter64(&writerAtBuffer{blob}, 0, data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b := blob.Bytes()
+
+	h, ok := ParseHeader(b)
+	if !ok || !h.Valid() {
+		t.Fatalf("expected valid header: %s", h)
+	}
+	if h.Length != uint32(len(data)) || h.DataChecksum != uint32(Hash(data)) || !bytes.Equal(h.Magic[:], MAGIC) {
+		t.Fatalf("unexpected header: %s", h)
+	}
+
+	_, ok = ParseHeader(b[:15])
+	if ok {
+		t.Fatal("expected invalid header")
+	}
+
+	for i := 0; i < 16; i++ {
+		corrupt := append([]byte{}, b...)
+		corrupt[i]++
+		h, ok := ParseHeader(corrupt)
+		if ok || h.Valid() {
+			t.Fatalf("%d: expected invalid header: %s", i, h)
+		}
+	}
+}
+
+func TestHeaderBitFlip(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	off, _, err := fw.Append([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	header := make([]byte, 16)
+	_, err = fw.file.ReadAt(header, byteOffset(off))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 16; i++ {
+		for bit := uint(0); bit < 8; bit++ {
+			flipped := append([]byte{}, header...)
+			flipped[i] ^= 1 << bit
+			_, err = fw.file.WriteAt(flipped, byteOffset(off))
+			if err != nil {
+				t.Fatal(err)
+			}
+			_, _, err = reader.Read(off)
+			if err != EBADSLT {
+				t.Fatalf("byte %d bit %d: expected EBADSLT got %v", i, bit, err)
+			}
+		}
+	}
+}
+
+func TestReadRaw(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	first, _, err := fw.Append([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := fw.Append([]byte("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	header, payload, headerValid, dataValid, next, err := reader.ReadRaw(first)
+	if err != nil || len(header) != 16 || string(payload) != "hello" || !headerValid || !dataValid || next != second {
+		t.Fatalf("unexpected: %v %q %v %v %d %v", header, payload, headerValid, dataValid, next, err)
+	}
+
+	// corrupt data is still returned
+	_, err = fw.file.WriteAt([]byte("j"), byteOffset(first)+16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = reader.Read(first)
+	if err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+	_, payload, headerValid, dataValid, next, err = reader.ReadRaw(first)
+	if err != nil || string(payload) != "jello" || !headerValid || dataValid || next != second {
+		t.Fatalf("unexpected: %q %v %v %d %v", payload, headerValid, dataValid, next, err)
+	}
+
+	// corrupt header
+	_, err = fw.file.WriteAt([]byte{0}, byteOffset(first)+8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	header, payload, headerValid, dataValid, next, err = reader.ReadRaw(first)
+	if err != nil || len(header) != 16 || payload != nil || headerValid || dataValid || next != first+1 {
+		t.Fatalf("unexpected: %v %q %v %v %d %v", header, payload, headerValid, dataValid, next, err)
+	}
+
+	// truncated data
+	err = fw.file.Truncate(byteOffset(second) + 18)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, payload, headerValid, dataValid, _, err = reader.ReadRaw(second)
+	if err != ErrTruncated || string(payload) != "wo" || !headerValid || dataValid {
+		t.Fatalf("unexpected: %q %v %v %v", payload, headerValid, dataValid, err)
+	}
+
+	_, _, _, _, _, err = reader.ReadRaw(second + 10)
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF got %v", err)
+	}
+}
+
+func TestPayloadChecksum(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	first, _, err := fw.Append([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, _, err := fw.Append([]byte("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum, next, err := reader.PayloadChecksum(first)
+	if err != nil || checksum != uint32(Hash([]byte("hello"))) || next != second {
+		t.Fatalf("unexpected %x %d %v", checksum, next, err)
+	}
+
+	// corrupted data is not detected, corrupted header is
+	_, err = fw.file.WriteAt([]byte("j"), byteOffset(first)+16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	checksum, _, err = reader.PayloadChecksum(first)
+	if err != nil || checksum != uint32(Hash([]byte("hello"))) {
+		t.Fatalf("unexpected %x %v", checksum, err)
+	}
+	_, err = fw.file.WriteAt([]byte{0}, byteOffset(second)+4)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = reader.PayloadChecksum(second)
+	if err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+	_, _, err = reader.PayloadChecksum(second + 10)
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF got %v", err)
+	}
+}
+
+func TestEntryContaining(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	type entry struct {
+		offset, next uint32
+		length       int
+	}
+	entries := []entry{}
+	for i := 0; i < 2000; i++ {
+		length := i % 300
+		if i%700 == 0 {
+			length = 200 * 1024
+		}
+		off, next, err := fw.Append([]byte(RandStringRunes(length)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries = append(entries, entry{off, next, length})
+	}
+
+	check := func() {
+		for i := 0; i < len(entries); i += 7 {
+			e := entries[i]
+			for _, pos := range []int64{byteOffset(e.offset), byteOffset(e.offset) + 16 + int64(e.length)/2, byteOffset(e.next) - 1} {
+				if pos >= byteOffset(e.offset)+16+int64(e.length) && i == len(entries)-1 {
+					continue
+				}
+				offset, length, err := reader.EntryContaining(pos)
+				if err != nil {
+					t.Fatalf("entry %d pos %d: %v", i, pos, err)
+				}
+				if offset != e.offset || int(length) != e.length {
+					t.Fatalf("entry %d pos %d: expected %d %d got %d %d", i, pos, e.offset, e.length, offset, length)
+				}
+			}
+		}
+	}
+	check()
+
+	last := entries[len(entries)-1]
+	if _, _, err := reader.EntryContaining(byteOffset(last.offset) + 16 + int64(last.length)); err != io.EOF {
+		t.Fatalf("expected io.EOF got %v", err)
+	}
+
+	// with the index
+	err := reader.ScanReverseN(1, func(data []byte, offset, next uint32) error { return nil })
+	if err != nil {
+		t.Fatal(err)
+	}
+	check()
+
+	corrupted := entries[1000]
+	_, err = fw.file.WriteAt([]byte{1}, byteOffset(corrupted.offset)+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader.index = nil
+	reader.indexNext = 0
+	if _, _, err := reader.EntryContaining(byteOffset(corrupted.offset) + 20); err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+}
+
+func TestCompareAt(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	counting := &countingReaderAt{r: reader.reader}
+	reader.reader = counting
+
+	off, next, err := fw.Append([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw, err := NewWriterWithOptions(reader.file.Name(), WriterOptions{CompactHeader: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	compact, compactNext, err := cw.Append([]byte("tiny"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cw.Close()
+
+	for _, c := range []struct {
+		offset   uint32
+		expected string
+		equal    bool
+		next     uint32
+	}{
+		{off, "hello", true, next},
+		{off, "hellO", false, next},
+		{off, "hello!", false, next},
+		{compact, "tiny", true, compactNext},
+		{compact, "tinY", false, compactNext},
+	} {
+		equal, n, err := reader.CompareAt(c.offset, []byte(c.expected))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if equal != c.equal || n != c.next {
+			t.Fatalf("%q at %d: expected %v %d got %v %d", c.expected, c.offset, c.equal, c.next, equal, n)
+		}
+	}
+
+	// the fast path reads only the header
+	before := counting.reads
+	equal, _, err := reader.CompareAt(off, []byte("other"))
+	if err != nil || equal {
+		t.Fatalf("unexpected %v %v", equal, err)
+	}
+	if counting.reads-before != 1 {
+		t.Fatalf("expected one read got %d", counting.reads-before)
+	}
+
+	if _, _, err := reader.CompareAt(compactNext+10, []byte("x")); err != io.EOF {
+		t.Fatalf("expected io.EOF got %v", err)
+	}
+}
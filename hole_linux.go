@@ -0,0 +1,38 @@
+//go:build linux
+// +build linux
+
+package pen
+
+import (
+	"io"
+	"math"
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// find the next data region at or after from (SEEK_DATA) and where it ends (SEEK_HOLE), returns io.EOF if there is only hole after from
+// if the filesystem does not support it, everything is data
+// lseek moves the file position shared by everyone using the file (also dup'd fds), so it is restored before returning,
+// the reads use ReadAt and do not depend on it, but the file could be shared with code that does (e.g. NewReaderFromFile)
+func nextData(file *os.File, from int64) (int64, int64, error) {
+	fd := int(file.Fd())
+	position, err := unix.Seek(fd, 0, io.SeekCurrent)
+	if err != nil {
+		return from, math.MaxInt64, nil
+	}
+	defer unix.Seek(fd, position, io.SeekStart)
+
+	start, err := unix.Seek(fd, from, unix.SEEK_DATA)
+	if err == unix.ENXIO {
+		return 0, 0, io.EOF
+	}
+	if err != nil {
+		return from, math.MaxInt64, nil
+	}
+	end, err := unix.Seek(fd, start, unix.SEEK_HOLE)
+	if err != nil {
+		return start, math.MaxInt64, nil
+	}
+	return start, end, nil
+}
@@ -0,0 +1,14 @@
+//go:build !linux
+// +build !linux
+
+package pen
+
+import (
+	"math"
+	"os"
+)
+
+// SEEK_DATA is not available, so everything is data
+func nextData(file *os.File, from int64) (int64, int64, error) {
+	return from, math.MaxInt64, nil
+}
@@ -0,0 +1,17 @@
+package pen
+
+import "fmt"
+
+// Scan decoding every entry into the same target (owned by the caller, so there is no allocation per entry) and calling cb with it.
+// The data is read with ScanNoCopy, so with decode that does not allocate, the whole loop is allocation free (e.g. fixed layout records).
+// target and the data passed to decode are *only valid during the callback*, they are overwritten by the next entry.
+// The decode errors are returned with the offset of the bad entry.
+func ScanInto[T any](r *Reader, offset uint32, target *T, decode func(dst *T, data []byte) error, cb func(*T, uint32) error) error {
+	return r.ScanNoCopy(offset, func(data []byte, offset, next uint32) error {
+		err := decode(target, data)
+		if err != nil {
+			return fmt.Errorf("pen: decode at offset %d: %w", offset, err)
+		}
+		return cb(target, offset)
+	})
+}
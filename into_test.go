@@ -0,0 +1,89 @@
+package pen
+
+import (
+	"encoding/binary"
+	"errors"
+	"testing"
+)
+
+type intoRecord struct {
+	ID    uint64
+	Value uint32
+}
+
+func decodeIntoRecord(dst *intoRecord, data []byte) error {
+	if len(data) != 12 {
+		return EINVAL
+	}
+	dst.ID = binary.LittleEndian.Uint64(data)
+	dst.Value = binary.LittleEndian.Uint32(data[8:])
+	return nil
+}
+
+func appendIntoRecords(t testing.TB, fw *Writer, n int) {
+	b := make([]byte, 12)
+	for i := 0; i < n; i++ {
+		binary.LittleEndian.PutUint64(b, uint64(i))
+		binary.LittleEndian.PutUint32(b[8:], uint32(i*2))
+		_, _, err := fw.Append(b)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestScanInto(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 64)
+	defer done()
+	appendIntoRecords(t, fw, 100)
+
+	var target intoRecord
+	n := 0
+	err := ScanInto(reader, 0, &target, decodeIntoRecord, func(r *intoRecord, offset uint32) error {
+		if r != &target {
+			t.Fatalf("expected the target pointer")
+		}
+		if r.ID != uint64(n) || r.Value != uint32(n*2) {
+			t.Fatalf("unexpected %+v", r)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Fatalf("expected 100 got %d", n)
+	}
+
+	_, _, err = fw.Append([]byte("bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ScanInto(reader, 0, &target, decodeIntoRecord, func(r *intoRecord, offset uint32) error {
+		return nil
+	})
+	if !errors.Is(err, EINVAL) {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+}
+
+func BenchmarkScanInto(b *testing.B) {
+	fw, reader, done := newTestWriterReader(b, 64)
+	defer done()
+	appendIntoRecords(b, fw, 10000)
+
+	var target intoRecord
+	sum := uint64(0)
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err := ScanInto(reader, 0, &target, decodeIntoRecord, func(r *intoRecord, offset uint32) error {
+			sum += r.ID
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
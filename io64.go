@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"io"
+	"time"
 )
 
 // Append bytes to the end of file
@@ -36,46 +37,184 @@ func WriteAtWriter64(file io.WriterAt, offset uint64, encoded []byte) error {
 }
 
 func ReadFromReader64(reader io.ReaderAt, offset uint64, blockSize int) ([]byte, error) {
-	block := make([]byte, blockSize)
-	n, err := reader.ReadAt(block, int64(offset))
+	return readFromReader64(reader, offset, make([]byte, blockSize), &defaultReaderOptions)
+}
+
+// ReadAt until p is full or there is an error, some io.ReaderAt implementations (network backed, chunked) can return less than len(p) without error
+func readFullAt(reader io.ReaderAt, p []byte, off int64) (int, error) {
+	read := 0
+	for read < len(p) {
+		n, err := reader.ReadAt(p[read:], off+int64(read))
+		read += n
+		if err != nil {
+			return read, err
+		}
+		if n == 0 {
+			return read, io.ErrNoProgress
+		}
+	}
+	return read, nil
+}
+
+func makeBytes(size int) []byte {
+	return make([]byte, size)
+}
+
+// same as ReadFromReader64 but the header is read into block, and if the data does not fit in it, opts.Alloc is used to get the space for it
+// if the allocated data is not returned because of an error it is given back to opts.Free (if not nil)
+func readFromReader64(reader io.ReaderAt, offset uint64, block []byte, opts *ReaderOptions) ([]byte, error) {
+	data, _, err := readEntry64(reader, offset, block, opts)
+	if err == errReservedMagic {
+		err = EBADSLT
+	}
+	return data, err
+}
 
+// same as readFromReader64, but also returns the size of the whole entry (header and data, without the padding), which is different for compact entries
+func readEntry64(reader io.ReaderAt, offset uint64, block []byte, opts *ReaderOptions) ([]byte, int, error) {
+	data, size, _, err := readEntry(reader, offset, block, opts)
+	return data, size, err
+}
+
+// same as readEntry64, but also returns true if the data was allocated with opts.Alloc, so the caller that drops it can give it back to opts.Free
+func readEntry(reader io.ReaderAt, offset uint64, block []byte, opts *ReaderOptions) ([]byte, int, bool, error) {
+	n, err := readFullAt(reader, block, int64(offset))
+
+	if n >= 12 && bytes.Equal(block[8:12], LARGE_MAGIC) {
+		_, _, lerr := largeEntryAt(reader, int64(offset))
+		if lerr == nil {
+			return nil, 0, false, ErrLargeEntry
+		}
+	}
+
+	truncatedCompact := false
+	if n >= len(COMPACT_MAGIC) && bytes.Equal(block[:len(COMPACT_MAGIC)], COMPACT_MAGIC) {
+		data, size, cerr := readCompact(reader, offset, block[:n], n < len(block))
+		if cerr == nil {
+			return data, size, false, nil
+		}
+		// it could be normal entry with length that starts like COMPACT_MAGIC
+		truncatedCompact = cerr == ErrTruncated
+	}
+
+	data, allocated, err := readRegular(reader, offset, block, n, err, opts)
+	if err == EBADSLT && truncatedCompact {
+		err = ErrTruncated
+	}
+	if err != nil {
+		return nil, 0, false, err
+	}
+	size := 16 + len(data)
+	if opts.TrailingDataChecksum {
+		size += 4
+	}
+	if bytes.Equal(block[8:12], TRANSFORM_MAGIC) {
+		decoded, err := decodeTransforms(data, opts.Transforms)
+		if err != nil {
+			if allocated && opts.Free != nil {
+				opts.Free(data)
+			}
+			return nil, 0, false, err
+		}
+		// the decoded data is not from opts.Alloc
+		data, allocated = decoded, false
+	}
+	return data, size, allocated, nil
+}
+
+// parse the normal 16 byte header entry, n and err are the result of reading the block, returns true if the data was allocated with opts.Alloc
+func readRegular(reader io.ReaderAt, offset uint64, block []byte, n int, err error, opts *ReaderOptions) ([]byte, bool, error) {
 	// end of file, or not enough space to read whole block_size
 	if n < 16 {
-		return nil, err
+		if n > 0 && err == io.EOF {
+			// there is something, but not even a whole header
+			return nil, false, ErrTruncated
+		}
+		return nil, false, err
 	}
-	if n != blockSize {
+	// short read of the block at the end of the file is fine, the data could still fit
+	err = nil
+	if n != len(block) {
 		block = block[:n]
 	}
 
 	header := block[:16]
-	if !bytes.Equal(header[8:12], MAGIC) {
-		return nil, EBADSLT
+	if !opts.SkipMagic && !bytes.Equal(header[8:12], MAGIC) && !bytes.Equal(header[8:12], TRANSFORM_MAGIC) {
+		if reservedMagic(header[8:12]) {
+			return nil, false, errReservedMagic
+		}
+		return nil, false, EBADSLT
 	}
 
 	computedChecksumHeader := uint32(Hash(header[:12]))
 	checksumHeader := binary.LittleEndian.Uint32(header[12:16])
 	if checksumHeader != computedChecksumHeader {
-		return nil, EBADSLT
+		return nil, false, EBADSLT
 	}
 
 	metadataLen := binary.LittleEndian.Uint32(header)
+	entryLen := int(metadataLen)
+	if opts.TrailingDataChecksum {
+		entryLen += 4
+	}
 
 	var readInto []byte
-	if int(metadataLen) < len(block)-len(header) {
-		readInto = block[len(header) : len(header)+int(metadataLen)]
+	allocated := false
+	if entryLen <= len(block)-len(header) {
+		readInto = block[len(header) : len(header)+entryLen]
 	} else {
-		readInto = make([]byte, metadataLen)
-		_, err = reader.ReadAt(readInto, int64(offset)+int64(len(header)))
-		if err != nil {
-			return nil, err
+		readInto = opts.Alloc(entryLen)[:entryLen]
+		allocated = true
+		n, err = readFullAt(reader, readInto, int64(offset)+int64(len(header)))
+		if err == io.EOF && n < len(readInto) {
+			// valid header, but the data is not all there
+			err = ErrTruncated
+		}
+		if err == io.EOF {
+			err = nil
 		}
 	}
 
-	checksumHeaderData := binary.LittleEndian.Uint32(header[4:])
-	computedChecksumData := uint32(Hash(readInto))
+	if err == nil && !opts.skipPayloadChecksum {
+		checksumHeaderData := binary.LittleEndian.Uint32(header[4:])
+		if opts.TrailingDataChecksum {
+			checksumHeaderData = binary.LittleEndian.Uint32(readInto[metadataLen:])
+		}
+		computedChecksumData := uint32(Hash(readInto[:metadataLen]))
+		if checksumHeaderData != computedChecksumData {
+			err = EBADSLT
+		}
+	}
 
-	if checksumHeaderData != computedChecksumData {
-		return nil, EBADSLT
+	if err != nil {
+		if allocated && opts.Free != nil {
+			opts.Free(readInto)
+		}
+		return nil, false, err
+	}
+	return readInto[:metadataLen], allocated, nil
+}
+
+// retries the failed reads according to ReaderOptions.RetryPolicy, continuing after the bytes that were already read
+type retryReaderAt struct {
+	r      io.ReaderAt
+	policy func(int, error) (bool, time.Duration)
+}
+
+func (rr *retryReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	total := 0
+	attempt := 0
+	for {
+		n, err := rr.r.ReadAt(p[total:], off+int64(total))
+		total += n
+		if err == nil || err == io.EOF {
+			return total, err
+		}
+		attempt++
+		retry, backoff := rr.policy(attempt, err)
+		if !retry {
+			return total, err
+		}
+		time.Sleep(backoff)
 	}
-	return readInto, nil
 }
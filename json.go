@@ -0,0 +1,23 @@
+package pen
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// Scan the reader and json.Unmarshal every entry into new T, the unmarshal errors are returned with the offset of the bad entry.
+// example:
+//	err := ScanJSON(r, 0, func(e Event, offset uint32) error {
+//		log.Printf("%v", e)
+//		return nil
+//	})
+func ScanJSON[T any](r *Reader, offset uint32, cb func(T, uint32) error) error {
+	return r.Scan(offset, func(data []byte, offset, next uint32) error {
+		var v T
+		err := json.Unmarshal(data, &v)
+		if err != nil {
+			return fmt.Errorf("pen: unmarshal at offset %d: %w", offset, err)
+		}
+		return cb(v, offset)
+	})
+}
@@ -0,0 +1,57 @@
+package pen
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestScanJSON(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	type event struct {
+		ID   int
+		Name string
+	}
+
+	for i := 0; i < 10; i++ {
+		data, err := json.Marshal(event{ID: i, Name: RandStringRunes(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = fw.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n := 0
+	err := ScanJSON(reader, 0, func(e event, offset uint32) error {
+		if e.ID != n || len(e.Name) != n {
+			t.Fatalf("unexpected %v", e)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 10 {
+		t.Fatalf("expected 10 got %d", n)
+	}
+
+	bad, _, err := fw.Append([]byte("{bad"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = ScanJSON(reader, 0, func(e event, offset uint32) error {
+		return nil
+	})
+	var serr *json.SyntaxError
+	if err == nil || !strings.Contains(err.Error(), fmt.Sprintf("offset %d", bad)) || !errors.As(err, &serr) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
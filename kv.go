@@ -0,0 +1,125 @@
+package pen
+
+import (
+	"encoding/binary"
+	"sync"
+)
+
+// Key-value store over the log: Put appends (key, value) entries and keeps the offset of the latest entry per key in memory, Get reads it.
+// Load rebuilds the index with one scan (last write wins), so the store survives restarts. The superseded entries stay in the file,
+// Rebuild keeps them too (it only realigns the entries), use Compact to write only the latest entry of every key to a new file.
+// The entries are uvarint length of the key, the key and the value. It is *safe* to use concurrently.
+type KVLog struct {
+	w *Writer
+	r *Reader
+
+	lock  sync.RWMutex
+	index map[string]uint32
+}
+
+// Create KVLog on top of the writer and the reader of the same file, call Load to index the existing entries
+func NewKVLog(w *Writer, r *Reader) *KVLog {
+	return &KVLog{w: w, r: r, index: map[string]uint32{}}
+}
+
+// Rebuild the index from the whole file (last write wins), entries that are not key-value entries are skipped like corruption.
+// It replaces the index, so call it before the first Put.
+func (kv *KVLog) Load() error {
+	index, err := ScanMapOffsets(kv.r, func(data []byte) (string, bool) {
+		key, _, ok := decodeKV(data)
+		return key, ok
+	})
+	if err != nil {
+		return err
+	}
+	kv.lock.Lock()
+	kv.index = index
+	kv.lock.Unlock()
+	return nil
+}
+
+// Append the new value of key, returns its offset
+func (kv *KVLog) Put(key string, value []byte) (uint32, error) {
+	offset, _, err := kv.w.Append(encodeKV(key, value))
+	if err != nil {
+		return 0, err
+	}
+	kv.lock.Lock()
+	defer kv.lock.Unlock()
+	// concurrent Puts of the same key, the later offset is the latest value
+	if old, ok := kv.index[key]; !ok || offset > old {
+		kv.index[key] = offset
+	}
+	return offset, nil
+}
+
+// Read the latest value of key, returns ErrNotFound if it was never Put
+func (kv *KVLog) Get(key string) ([]byte, error) {
+	kv.lock.RLock()
+	offset, ok := kv.index[key]
+	kv.lock.RUnlock()
+	if !ok {
+		return nil, ErrNotFound
+	}
+	data, _, err := kv.r.Read(offset)
+	if err != nil {
+		return nil, err
+	}
+	k, value, ok := decodeKV(data)
+	if !ok || k != key {
+		return nil, EBADSLT
+	}
+	return value, nil
+}
+
+// Number of keys
+func (kv *KVLog) Len() int {
+	kv.lock.RLock()
+	defer kv.lock.RUnlock()
+	return len(kv.index)
+}
+
+// Write the latest value of every key to dst (in the order of the file), and return KVLog over it, dstReader must read the file of dst.
+// The entries appended by Put during Compact may be missing in dst, so stop the writes first.
+func (kv *KVLog) Compact(dst *Writer, dstReader *Reader) (*KVLog, error) {
+	kv.lock.RLock()
+	latest := make(map[uint32]bool, len(kv.index))
+	for _, offset := range kv.index {
+		latest[offset] = true
+	}
+	kv.lock.RUnlock()
+
+	out := NewKVLog(dst, dstReader)
+	err := kv.r.Scan(0, func(data []byte, offset, next uint32) error {
+		if !latest[offset] {
+			return nil
+		}
+		key, _, _ := decodeKV(data)
+		o, _, err := dst.Append(data)
+		if err != nil {
+			return err
+		}
+		out.index[key] = o
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return out, nil
+}
+
+func encodeKV(key string, value []byte) []byte {
+	b := make([]byte, binary.MaxVarintLen64+len(key)+len(value))
+	n := binary.PutUvarint(b, uint64(len(key)))
+	n += copy(b[n:], key)
+	n += copy(b[n:], value)
+	return b[:n]
+}
+
+func decodeKV(data []byte) (string, []byte, bool) {
+	length, n := binary.Uvarint(data)
+	if n <= 0 || length > uint64(len(data)-n) {
+		return "", nil, false
+	}
+	return string(data[n : n+int(length)]), data[n+int(length):], true
+}
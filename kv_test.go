@@ -0,0 +1,95 @@
+package pen
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestKVLog(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	kv := NewKVLog(fw, reader)
+	if _, err := kv.Get("a"); err != ErrNotFound {
+		t.Fatalf("expected ErrNotFound got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				_, err := kv.Put(fmt.Sprintf("key%d", i%10), []byte(fmt.Sprintf("value%d-%d", g, i)))
+				if err != nil {
+					t.Error(err)
+					return
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	// not a key-value entry
+	if _, _, err := fw.Append([]byte{0xff}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Put("key3", []byte("latest")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := kv.Put("", nil); err != nil {
+		t.Fatal(err)
+	}
+
+	// the latest value of every key is the last entry for it in the file
+	expected := map[string]string{}
+	err := reader.Scan(0, func(data []byte, offset, next uint32) error {
+		if k, v, ok := decodeKV(data); ok {
+			expected[k] = string(v)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(expected) != 11 || expected["key3"] != "latest" {
+		t.Fatalf("unexpected %v", expected)
+	}
+
+	loaded := NewKVLog(fw, reader)
+	if err := loaded.Load(); err != nil {
+		t.Fatal(err)
+	}
+	for _, store := range []*KVLog{kv, loaded} {
+		if store.Len() != len(expected) {
+			t.Fatalf("expected %d keys got %d", len(expected), store.Len())
+		}
+		for k, v := range expected {
+			got, err := store.Get(k)
+			if err != nil || string(got) != v {
+				t.Fatalf("key %q: expected %q got %q %v", k, v, got, err)
+			}
+		}
+	}
+
+	dst, dstReader, dstDone := newTestWriterReader(t, 0)
+	defer dstDone()
+	compacted, err := kv.Compact(dst, dstReader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	err = dstReader.Scan(0, func(data []byte, offset, next uint32) error {
+		n++
+		return nil
+	})
+	if err != nil || n != len(expected) {
+		t.Fatalf("expected %d entries got %d %v", len(expected), n, err)
+	}
+	for k, v := range expected {
+		got, err := compacted.Get(k)
+		if err != nil || string(got) != v {
+			t.Fatalf("key %q: expected %q got %q %v", k, v, got, err)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package pen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"hash/crc32"
+	"io"
+	"math"
+	"sync/atomic"
+)
+
+// magic of the large entries written by Writer.AppendFrom
+var LARGE_MAGIC = []byte{0x1, 0xa, 0x9, 0xe}
+
+// returned by Read for large entry written by Writer.AppendFrom, read it with Reader.WriteEntryTo
+var ErrLargeEntry = errors.New("large entry, use WriteEntryTo")
+
+// size of the header of the large entries
+const largeHeaderSize = 24
+
+// chunk size used to stream the large entries
+var largeChunkSize = 1024 * 1024
+
+// Append length bytes read from r as large entry, without buffering them, so the entry can be bigger than 4GB.
+// format is:
+//   24 byte header
+//   XX variable length data
+//
+//   header:
+//      4 bytes LE low 32 bits of the length
+//      4 bytes LE CRC32(data) (IEEE, it can be computed while streaming, unlike Hash)
+//      4 bytes LARGE_MAGIC
+//      4 bytes LE HASH(header without these 4 bytes)
+//      8 bytes LE length
+//
+// The data is written first and the header last, so the readers do not see the entry until it is complete. Read and Scan do not return large entries
+// (Read returns ErrLargeEntry, Scan skips them, or calls ScanOptions.OnLargeEntry), stream them with Reader.WriteEntryTo.
+// It is written (and WriteEntryTo reads it) in 1MB chunks with one syscall each, so it is about as fast as copying the file, but it uses allocated offset
+// for the whole duration of the copy, and the appends after it are visible to Scan before it. Every entry takes length/PAD offsets, so the total file is still limited to 2^32 offsets (EOVERFLOW if it would not fit).
+// If r returns less than length bytes, the space is left unused (the readers skip it as corruption) and io.ErrUnexpectedEOF is returned.
+// It returns EINVAL with O_APPEND, MultiProcess, FileCRC, FixedSize, Transforms, MaxSegmentBytes or OnAppend.
+func (fw *Writer) AppendFrom(r io.Reader, length int64) (uint32, uint32, error) {
+	if fw.appendMode || fw.fileCRC || fw.fixedSize > 0 || len(fw.opts.Transforms) > 0 || fw.opts.MaxSegmentBytes > 0 || fw.opts.OnAppend != nil || length < 0 {
+		return 0, 0, EINVAL
+	}
+	units := (largeHeaderSize + length + int64(PAD) - 1) / int64(PAD)
+	if units > math.MaxUint32 {
+		return 0, 0, EOVERFLOW
+	}
+	padded := uint32(units)
+	current := uint32(0)
+	for {
+		// check the headroom before reserving, so an entry that does not fit does not wrap the offset of the next appends
+		current = atomic.LoadUint32(&fw.offset)
+		if current+padded < current {
+			return 0, 0, EOVERFLOW
+		}
+		if atomic.CompareAndSwapUint32(&fw.offset, current, current+padded) {
+			break
+		}
+	}
+	defer fw.written.finish(current, current+padded)
+
+	start := byteOffset(current)
+	crc := uint32(0)
+	buf := make([]byte, largeChunkSize)
+	written := int64(0)
+	for written < length {
+		chunk := buf
+		if length-written < int64(len(chunk)) {
+			chunk = chunk[:length-written]
+		}
+		n, err := io.ReadFull(r, chunk)
+		if n > 0 {
+			crc = crc32.Update(crc, crc32.IEEETable, chunk[:n])
+			_, werr := fw.file.WriteAt(chunk[:n], start+largeHeaderSize+written)
+			if werr != nil {
+				return 0, 0, werr
+			}
+			written += int64(n)
+		}
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		if err != nil {
+			return 0, 0, err
+		}
+	}
+
+	_, err := fw.file.WriteAt(largeHeader(length, crc), start)
+	if err != nil {
+		return 0, 0, err
+	}
+	return current, current + padded, nil
+}
+
+func largeHeader(length int64, crc uint32) []byte {
+	header := make([]byte, largeHeaderSize)
+	binary.LittleEndian.PutUint32(header[0:], uint32(length))
+	binary.LittleEndian.PutUint32(header[4:], crc)
+	copy(header[8:], LARGE_MAGIC)
+	binary.LittleEndian.PutUint64(header[16:], uint64(length))
+	binary.LittleEndian.PutUint32(header[12:], largeHeaderChecksum(header))
+	return header
+}
+
+func largeHeaderChecksum(header []byte) uint32 {
+	b := make([]byte, 0, 20)
+	b = append(b, header[:12]...)
+	b = append(b, header[16:24]...)
+	return uint32(Hash(b))
+}
+
+// parse the large header at byte position pos, returns the length and the data crc, EBADSLT if there is no valid large header
+func largeEntryAt(reader io.ReaderAt, pos int64) (int64, uint32, error) {
+	header := make([]byte, largeHeaderSize)
+	n, err := readFullAt(reader, header, pos)
+	if n < largeHeaderSize {
+		if err == io.EOF {
+			return 0, 0, ErrTruncated
+		}
+		return 0, 0, err
+	}
+	length := binary.LittleEndian.Uint64(header[16:])
+	if !bytes.Equal(header[8:12], LARGE_MAGIC) || binary.LittleEndian.Uint32(header[12:]) != largeHeaderChecksum(header) ||
+		uint32(length) != binary.LittleEndian.Uint32(header) || length > math.MaxInt64/2 {
+		return 0, 0, EBADSLT
+	}
+	return int64(length), binary.LittleEndian.Uint32(header[4:]), nil
+}
+
+// same as largeEntryAt, but at offset, and also returns the next offset
+func readLargeHeader(reader io.ReaderAt, offset uint32) (int64, uint32, uint32, error) {
+	length, crc, err := largeEntryAt(reader, byteOffset(offset))
+	if err != nil {
+		return 0, 0, 0, err
+	}
+	units := (largeHeaderSize + length + int64(PAD) - 1) / int64(PAD)
+	if int64(offset)+units > math.MaxUint32 {
+		return 0, 0, 0, EBADSLT
+	}
+	return length, crc, offset + uint32(units), nil
+}
+
+// Write the data of the entry at offset to w, for large entries written by Writer.AppendFrom it is streamed in chunks, so it does not need memory for all of it,
+// normal entries are just Read. Returns the number of bytes written. The checksum of large entry is known only after all of its data is read,
+// so if it is corrupted w already got the data when EBADSLT is returned.
+func (ar *Reader) WriteEntryTo(offset uint32, w io.Writer) (int64, error) {
+	length, crc, _, err := readLargeHeader(ar.reader, offset)
+	if err == EBADSLT || err == ErrTruncated {
+		data, _, err := ar.Read(offset)
+		if err != nil {
+			return 0, err
+		}
+		n, err := w.Write(data)
+		return int64(n), err
+	}
+	if err != nil {
+		return 0, readError(offset, err)
+	}
+
+	start := byteOffset(offset) + largeHeaderSize
+	computed := uint32(0)
+	buf := make([]byte, largeChunkSize)
+	written := int64(0)
+	for written < length {
+		chunk := buf
+		if length-written < int64(len(chunk)) {
+			chunk = chunk[:length-written]
+		}
+		n, err := readFullAt(ar.reader, chunk, start+written)
+		if n < len(chunk) {
+			if err == io.EOF {
+				err = ErrTruncated
+			}
+			return written, readError(offset, err)
+		}
+		computed = crc32.Update(computed, crc32.IEEETable, chunk)
+		wn, err := w.Write(chunk)
+		written += int64(wn)
+		if err != nil {
+			return written, err
+		}
+	}
+	if computed != crc {
+		return written, EBADSLT
+	}
+	return written, nil
+}
@@ -0,0 +1,117 @@
+package pen
+
+import (
+	"bytes"
+	"io"
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestAppendFrom(t *testing.T) {
+	defer func(size int) {
+		largeChunkSize = size
+	}(largeChunkSize)
+	largeChunkSize = 1000
+
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	big := make([]byte, 100*1000+17)
+	rand.Read(big)
+
+	first, _, err := fw.Append([]byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	large, next, err := fw.AppendFrom(bytes.NewReader(big), int64(len(big)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if next != large+uint32((largeHeaderSize+len(big)+int(PAD)-1)/int(PAD)) {
+		t.Fatalf("unexpected next %d", next)
+	}
+	last, _, err := fw.Append([]byte("last"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, _, err := reader.Read(large); err != ErrLargeEntry {
+		t.Fatalf("expected ErrLargeEntry got %v", err)
+	}
+
+	var out bytes.Buffer
+	n, err := reader.WriteEntryTo(large, &out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(len(big)) || !bytes.Equal(out.Bytes(), big) {
+		t.Fatalf("mismatch %d", n)
+	}
+	out.Reset()
+	if _, err := reader.WriteEntryTo(first, &out); err != nil || out.String() != "first" {
+		t.Fatalf("unexpected %q %v", out.String(), err)
+	}
+
+	got := []uint32{}
+	larges := []uint32{}
+	errs, err := reader.ScanCollectErrors(0, func(data []byte, offset, next uint32) error {
+		got = append(got, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 2 || got[0] != first || got[1] != last || len(errs) != 0 {
+		t.Fatalf("expected the large entry to be skipped got %v %v", got, errs)
+	}
+	err = reader.ScanWithOptions(0, ScanOptions{OnLargeEntry: func(offset, next uint32) error {
+		larges = append(larges, offset)
+		return nil
+	}}, func(data []byte, offset, next uint32) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(larges) != 1 || larges[0] != large {
+		t.Fatalf("expected the large entry got %v", larges)
+	}
+
+	// large entry at the end is not garbage
+	tail, _, err := fw.AppendFrom(bytes.NewReader(big), int64(len(big)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastGood, garbage, err := reader.TailState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastGood <= tail || garbage != 0 {
+		t.Fatalf("unexpected tail state %d %d", lastGood, garbage)
+	}
+
+	// corrupted data is found when streaming
+	_, err = fw.file.WriteAt([]byte{big[500] ^ 1}, byteOffset(large)+largeHeaderSize+500)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := reader.WriteEntryTo(large, io.Discard); err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+
+	if _, _, err := fw.AppendFrom(bytes.NewReader(big[:10]), 20); err != io.ErrUnexpectedEOF {
+		t.Fatalf("expected io.ErrUnexpectedEOF got %v", err)
+	}
+	if _, _, err := fw.AppendFrom(bytes.NewReader(nil), 1<<60); err != EOVERFLOW {
+		t.Fatalf("expected EOVERFLOW got %v", err)
+	}
+	// fits in 2^32 offsets, but not after the current end, the offset must not wrap
+	before := fw.offset
+	if _, _, err := fw.AppendFrom(bytes.NewReader(nil), int64(math.MaxUint32)*int64(PAD)-largeHeaderSize); err != EOVERFLOW {
+		t.Fatalf("expected EOVERFLOW got %v", err)
+	}
+	if fw.offset != before {
+		t.Fatalf("offset moved from %d to %d", before, fw.offset)
+	}
+}
@@ -0,0 +1,228 @@
+package pen
+
+// Read the last n entries (or less if the file has less), in the order they are in the file.
+// Instead of scanning the whole file it probes a window at the end of the file, and scans it forward, resyncing to the first valid entry the same way Scan does.
+// If the window does not contain enough entries, or the entries in it are not chained (there was corruption or garbage between them, or the window started in the middle of a payload that looks like an entry)
+// the window is doubled, until it covers the whole file, which is the same as full forward scan.
+// This is best effort, the window could start inside a payload that contains valid entries at PAD aligned positions (e.g. nested pen file with PAD <= 16) and in pathological cases they could be returned.
+func (ar *Reader) LastN(n int) ([][]byte, []uint32, error) {
+	if n <= 0 {
+		return nil, nil, nil
+	}
+
+	size, err := ar.size()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	window := int64(n) * int64(ar.blockSize)
+	if window < 64*1024 {
+		window = 64 * 1024
+	}
+
+	for {
+		start := size - window
+		if start < 0 {
+			start = 0
+		}
+		data, offsets, chained, err := ar.lastN(uint32(start/int64(PAD)), n)
+		if err != nil {
+			return nil, nil, err
+		}
+		if start == 0 || (chained && len(data) == n) {
+			return data, offsets, nil
+		}
+		window *= 2
+	}
+}
+
+// scan from offset and keep the last n entries, chained is false if there was a gap between any of the entries found
+func (ar *Reader) lastN(offset uint32, n int) ([][]byte, []uint32, bool, error) {
+	data := make([][]byte, n)
+	offsets := make([]uint32, n)
+	found := 0
+	chained := true
+	prevNext := uint32(0)
+	err := ar.Scan(offset, func(d []byte, o, next uint32) error {
+		if found > 0 && o != prevNext {
+			chained = false
+		}
+		data[found%n] = d
+		offsets[found%n] = o
+		prevNext = next
+		found++
+		return nil
+	})
+	if err != nil {
+		return nil, nil, false, err
+	}
+
+	count := found
+	if count > n {
+		count = n
+	}
+	outData := make([][]byte, 0, count)
+	outOffsets := make([]uint32, 0, count)
+	for i := found - count; i < found; i++ {
+		outData = append(outData, data[i%n])
+		outOffsets = append(outOffsets, offsets[i%n])
+	}
+	return outData, outOffsets, chained, nil
+}
+
+// Returns the first n entries (or less if the file has less) and their offsets, the counterpart of LastN for a quick look at the start of the file.
+// It is Scan from offset 0 that stops after n entries, so corruption is skipped the same way, and every payload is copied to its own exact size slice
+// (not the blockSize read buffer) owned by the caller.
+func (ar *Reader) Head(n int) ([][]byte, []uint32, error) {
+	if n <= 0 {
+		return nil, nil, nil
+	}
+	data := [][]byte{}
+	offsets := []uint32{}
+	err := ar.ScanNoCopy(0, func(b []byte, offset, next uint32) error {
+		data = append(data, append([]byte{}, b...))
+		offsets = append(offsets, offset)
+		if len(data) == n {
+			return errStopScan
+		}
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		return nil, nil, err
+	}
+	return data, offsets, nil
+}
+
+// Call cb for the last n entries (or less if the file has less) newest first. Unlike LastN it is exact, it uses in memory index of the offsets
+// of all entries (4 bytes per entry), which is built by the first call with one full scan, and then only extended with the new entries.
+// It is *safe* to call it concurrently.
+func (ar *Reader) ScanReverseN(n int, cb func([]byte, uint32, uint32) error) error {
+	if n <= 0 {
+		return nil
+	}
+	index, err := ar.Offsets()
+	if err != nil {
+		return err
+	}
+
+	for i := len(index) - 1; i >= 0 && i >= len(index)-n; i-- {
+		data, next, err := ar.Read(index[i])
+		if err != nil {
+			return err
+		}
+		err = cb(data, index[i], next)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Returns the offsets of all valid entries in order, e.g. for binary search over a file sorted by some key (reading the key with Read at the candidates).
+// It uses the same in memory index as ScanReverseN (4 bytes per entry), the first call builds it with one full scan, the next calls only scan
+// the entries appended after it, so calling it again refreshes it after the file grows. The returned slice is shared, do *not* modify it.
+// It is *safe* to call it concurrently.
+func (ar *Reader) Offsets() ([]uint32, error) {
+	index, _, err := ar.offsets()
+	return index, err
+}
+
+// Offsets and the offset after the last indexed entry
+func (ar *Reader) offsets() ([]uint32, uint32, error) {
+	ar.indexLock.Lock()
+	defer ar.indexLock.Unlock()
+	err := ar.ScanNoCopy(ar.indexNext, func(data []byte, offset, next uint32) error {
+		ar.index = append(ar.index, offset)
+		ar.indexNext = next
+		return nil
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return ar.index[:len(ar.index):len(ar.index)], ar.indexNext, nil
+}
+
+// Drop the index of Offsets and ScanReverseN, so the next call rebuilds it from the start of the file (e.g. after Writer.TruncateTo).
+func (ar *Reader) ResetOffsets() {
+	ar.indexLock.Lock()
+	defer ar.indexLock.Unlock()
+	ar.index = nil
+	ar.indexNext = 0
+}
+
+// Call cb for every entry newest first, without keeping an index of the whole file.
+// It reads a window at the end of the file, finds the entries in it by scanning forward (resyncing to the first valid entry the same way Scan does),
+// calls cb for them newest first and then moves the window back to end at the oldest entry found, so an entry that straddled the start of the window is found by the next one.
+// If a window has no entries (an entry bigger than the window) or they are not chained with each other and the previous window, the window is doubled until it covers the rest of the file.
+// Same as LastN this is best effort around the window boundaries, in pathological cases (e.g. nested pen files, corruption) windows can grow to the whole file and entries from inside payloads could be returned.
+func (ar *Reader) ScanFromEnd(cb func([]byte, uint32, uint32) error) error {
+	size, err := ar.size()
+	if err != nil {
+		return err
+	}
+
+	base := int64(64 * ar.blockSize)
+	if base < 64*1024 {
+		base = 64 * 1024
+	}
+
+	end := uint32((size + int64(PAD) - 1) / int64(PAD))
+	first := true
+	window := base
+	for end > 0 {
+		start := byteOffset(end) - window
+		if start < 0 {
+			start = 0
+		}
+		data, offsets, nexts, chained, err := ar.window(uint32(start/int64(PAD)), end)
+		if err != nil {
+			return err
+		}
+		// the newest entry of the window must end where the previous window started, except for the end of the file where there could be garbage
+		if len(data) > 0 && !first && nexts[len(nexts)-1] != end {
+			chained = false
+		}
+		if start > 0 && (len(data) == 0 || !chained) {
+			window *= 2
+			continue
+		}
+
+		for i := len(data) - 1; i >= 0; i-- {
+			err := cb(data[i], offsets[i], nexts[i])
+			if err != nil {
+				return err
+			}
+		}
+		if start == 0 || len(data) == 0 {
+			return nil
+		}
+		end = offsets[0]
+		first = false
+		window = base
+	}
+	return nil
+}
+
+// scan the entries starting before end, chained is false if there was a gap between any of them
+func (ar *Reader) window(offset, end uint32) ([][]byte, []uint32, []uint32, bool, error) {
+	data := [][]byte{}
+	offsets := []uint32{}
+	nexts := []uint32{}
+	chained := true
+	err := ar.Scan(offset, func(d []byte, o, next uint32) error {
+		if o >= end {
+			return errStopScan
+		}
+		if len(nexts) > 0 && o != nexts[len(nexts)-1] {
+			chained = false
+		}
+		data = append(data, d)
+		offsets = append(offsets, o)
+		nexts = append(nexts, next)
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		return nil, nil, nil, false, err
+	}
+	return data, offsets, nexts, chained, nil
+}
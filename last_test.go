@@ -0,0 +1,257 @@
+package pen
+
+import (
+	"bytes"
+	"fmt"
+	"sort"
+	"testing"
+)
+
+func TestLastN(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	data, offsets, err := reader.LastN(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(data) != 0 || len(offsets) != 0 {
+		t.Fatalf("expected nothing got %d", len(data))
+	}
+
+	expected := [][]byte{}
+	expectedOffsets := []uint32{}
+	for i := 0; i < 5000; i++ {
+		d := []byte(RandStringRunes(i % 300))
+		off, _, err := fw.Append(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, d)
+		expectedOffsets = append(expectedOffsets, off)
+	}
+
+	for _, n := range []int{1, 3, 100, 1000, 5000, 6000} {
+		data, offsets, err := reader.LastN(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := n
+		if want > len(expected) {
+			want = len(expected)
+		}
+		if len(data) != want || len(offsets) != want {
+			t.Fatalf("n: %d, expected %d got %d", n, want, len(data))
+		}
+		for i := range data {
+			j := len(expected) - want + i
+			if !bytes.Equal(data[i], expected[j]) || offsets[i] != expectedOffsets[j] {
+				t.Fatalf("n: %d, mismatch at %d", n, i)
+			}
+		}
+	}
+}
+
+func TestScanReverseN(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	collect := func(n int) []string {
+		got := []string{}
+		err := reader.ScanReverseN(n, func(data []byte, offset, next uint32) error {
+			got = append(got, string(data))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	if got := collect(5); len(got) != 0 {
+		t.Fatalf("unexpected %v", got)
+	}
+
+	for i := 0; i < 10; i++ {
+		_, _, err := fw.Append([]byte(fmt.Sprintf("%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if got := fmt.Sprintf("%v", collect(3)); got != "[9 8 7]" {
+		t.Fatalf("unexpected %s", got)
+	}
+	if got := fmt.Sprintf("%v", collect(100)); got != "[9 8 7 6 5 4 3 2 1 0]" {
+		t.Fatalf("unexpected %s", got)
+	}
+
+	// the index is extended with the new entries
+	_, _, err := fw.Append([]byte("10"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%v", collect(2)); got != "[10 9]" {
+		t.Fatalf("unexpected %s", got)
+	}
+	if len(reader.index) != 11 {
+		t.Fatalf("expected 11 indexed got %d", len(reader.index))
+	}
+}
+
+func TestScanFromEnd(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	collect := func() ([][]byte, []uint32) {
+		data := [][]byte{}
+		offsets := []uint32{}
+		err := reader.ScanFromEnd(func(d []byte, offset, next uint32) error {
+			data = append(data, d)
+			offsets = append(offsets, offset)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return data, offsets
+	}
+
+	data, _ := collect()
+	if len(data) != 0 {
+		t.Fatalf("expected nothing got %d", len(data))
+	}
+
+	expected := [][]byte{}
+	expectedOffsets := []uint32{}
+	for i := 0; i < 3000; i++ {
+		d := []byte(RandStringRunes(i % 300))
+		if i%500 == 0 {
+			// bigger than the window
+			d = []byte(RandStringRunes(200 * 1024))
+		}
+		off, _, err := fw.Append(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, d)
+		expectedOffsets = append(expectedOffsets, off)
+	}
+
+	data, offsets := collect()
+	if len(data) != len(expected) {
+		t.Fatalf("expected %d got %d", len(expected), len(data))
+	}
+	for i := range data {
+		j := len(expected) - 1 - i
+		if !bytes.Equal(data[i], expected[j]) || offsets[i] != expectedOffsets[j] {
+			t.Fatalf("mismatch at %d", i)
+		}
+	}
+
+	stop := fmt.Errorf("stop")
+	n := 0
+	err := reader.ScanFromEnd(func(d []byte, offset, next uint32) error {
+		n++
+		if n == 10 {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || n != 10 {
+		t.Fatalf("expected stop after 10 got %v %d", err, n)
+	}
+}
+
+func TestOffsets(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	offsets, err := reader.Offsets()
+	if err != nil || len(offsets) != 0 {
+		t.Fatalf("unexpected %v %v", offsets, err)
+	}
+
+	expected := []uint32{}
+	for i := 0; i < 100; i++ {
+		off, _, err := fw.Append([]byte(fmt.Sprintf("%03d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, off)
+		if i == 49 {
+			offsets, err = reader.Offsets()
+			if err != nil || fmt.Sprintf("%v", offsets) != fmt.Sprintf("%v", expected) {
+				t.Fatalf("unexpected %v %v", offsets, err)
+			}
+		}
+	}
+	first := offsets
+	offsets, err = reader.Offsets()
+	if err != nil || fmt.Sprintf("%v", offsets) != fmt.Sprintf("%v", expected) {
+		t.Fatalf("unexpected %v %v", offsets, err)
+	}
+	if len(first) != 50 {
+		t.Fatalf("previous slice changed %d", len(first))
+	}
+
+	// binary search for the entry with key 042
+	i := sort.Search(len(offsets), func(i int) bool {
+		data, _, err := reader.Read(offsets[i])
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data) >= "042"
+	})
+	if i != 42 {
+		t.Fatalf("expected 42 got %d", i)
+	}
+
+	if err := fw.TruncateTo(expected[10]); err != nil {
+		t.Fatal(err)
+	}
+	reader.ResetOffsets()
+	offsets, err = reader.Offsets()
+	if err != nil || len(offsets) != 10 {
+		t.Fatalf("unexpected %v %v", offsets, err)
+	}
+}
+
+func TestHead(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 4096)
+	defer done()
+
+	data, offsets, err := reader.Head(10)
+	if err != nil || len(data) != 0 || len(offsets) != 0 {
+		t.Fatalf("expected nothing got %d %v", len(data), err)
+	}
+
+	expectedOffsets := []uint32{}
+	for i := 0; i < 20; i++ {
+		off, _, err := fw.Append([]byte(fmt.Sprintf("%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedOffsets = append(expectedOffsets, off)
+	}
+	_, err = fw.file.WriteAt([]byte{'x'}, byteOffset(expectedOffsets[1])+16)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, offsets, err = reader.Head(3)
+	if err != nil || fmt.Sprintf("%s", data) != "[0 2 3]" || offsets[1] != expectedOffsets[2] {
+		t.Fatalf("unexpected %s %v %v", data, offsets, err)
+	}
+	data, _, err = reader.Head(100)
+	if err != nil || len(data) != 19 {
+		t.Fatalf("expected 19 got %d %v", len(data), err)
+	}
+	for _, d := range data {
+		// copied out of the 4096 byte block
+		if cap(d) > 64 {
+			t.Fatalf("entry pins %d bytes", cap(d))
+		}
+	}
+	if data, _, _ := reader.Head(0); data != nil {
+		t.Fatalf("unexpected %v", data)
+	}
+}
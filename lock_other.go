@@ -0,0 +1,11 @@
+//go:build !linux && !darwin && !freebsd && !netbsd && !openbsd && !dragonfly && !windows
+// +build !linux,!darwin,!freebsd,!netbsd,!openbsd,!dragonfly,!windows
+
+package pen
+
+import "os"
+
+// file locking is not available, so WriterOptions.Lock does nothing
+func lockFile(file *os.File) error {
+	return nil
+}
@@ -0,0 +1,21 @@
+//go:build windows
+// +build windows
+
+package pen
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// LockFileEx(LOCKFILE_EXCLUSIVE_LOCK|LOCKFILE_FAIL_IMMEDIATELY) of one byte at offset 2^64-2, released when the file is closed.
+// The windows locks are mandatory, the reads and writes of the locked range fail, so it locks a byte far after any data instead of the whole file.
+func lockFile(file *os.File) error {
+	overlapped := &windows.Overlapped{Offset: 0xFFFFFFFE, OffsetHigh: 0xFFFFFFFF}
+	err := windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, overlapped)
+	if err == windows.ERROR_LOCK_VIOLATION {
+		return ErrLocked
+	}
+	return err
+}
@@ -0,0 +1,76 @@
+package pen
+
+// Writer and Reader on the same file, with in memory LRU cache of the recently appended or read entries.
+// Append puts the entry in the cache, so reading your own writes does not touch the disk.
+// It is *safe* to use it concurrently.
+// The cache holds at most cacheSize entries (so memory is bounded by cacheSize * the size of your biggest entry),
+// the entries are never invalidated, because the offsets in append only file never change meaning,
+// do not Overwrite the file from another Writer while using Log.
+type Log struct {
+	w     *Writer
+	r     *Reader
+	cache *entryCache
+}
+
+// Open (or create) Log, blockSize is passed to the Reader, cacheSize is the max amount of entries to keep in memory
+func NewLog(filename string, blockSize int, cacheSize int) (*Log, error) {
+	if cacheSize < 0 {
+		return nil, EINVAL
+	}
+	w, err := NewWriter(filename)
+	if err != nil {
+		return nil, err
+	}
+	r, err := NewReader(filename, blockSize)
+	if err != nil {
+		w.Close()
+		return nil, err
+	}
+	return &Log{
+		w:     w,
+		r:     r,
+		cache: newEntryCache(cacheSize),
+	}, nil
+}
+
+// Append to the file and add the entry to the cache, returns the offset and next offset
+func (l *Log) Append(data []byte) (uint32, uint32, error) {
+	offset, next, err := l.w.Append(data)
+	if err != nil {
+		return 0, 0, err
+	}
+	l.cache.add(offset, next, append([]byte{}, data...))
+	return offset, next, nil
+}
+
+// Read from the cache, or from the file if not cached. The returned data is a copy, so it is safe to modify it.
+func (l *Log) Read(offset uint32) ([]byte, uint32, error) {
+	if data, next, ok := l.cache.get(offset); ok {
+		return data, next, nil
+	}
+
+	data, next, err := l.r.Read(offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	l.cache.add(offset, next, append([]byte{}, data...))
+	return data, next, nil
+}
+
+// Scan the file (the cache is not used)
+func (l *Log) Scan(offset uint32, cb func([]byte, uint32, uint32) error) error {
+	return l.r.Scan(offset, cb)
+}
+
+func (l *Log) Sync() error {
+	return l.w.Sync()
+}
+
+func (l *Log) Close() error {
+	err1 := l.w.Close()
+	err2 := l.r.Close()
+	if err1 != nil {
+		return err1
+	}
+	return err2
+}
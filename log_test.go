@@ -0,0 +1,61 @@
+package pen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestLog(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "log")
+
+	l, err := NewLog(fn, 0, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer l.Close()
+
+	expected := map[uint32][]byte{}
+	for i := 1; i <= 100; i++ {
+		data := []byte(RandStringRunes(i))
+		off, _, err := l.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected[off] = data
+	}
+	if l.cache.lru.Len() != 10 {
+		t.Fatalf("expected 10 cached got %d", l.cache.lru.Len())
+	}
+
+	// corrupt the file, so only cached entries can be read
+	err = ioutil.WriteFile(fn, make([]byte, 100000), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cached := 0
+	for off, data := range expected {
+		r, _, err := l.Read(off)
+		if err == nil {
+			if !bytes.Equal(r, data) {
+				t.Fatalf("data mismatch at %d", off)
+			}
+			r[0] = 'x'
+			r, _, _ = l.Read(off)
+			if !bytes.Equal(r, data) {
+				t.Fatalf("cache was modified %d", off)
+			}
+			cached++
+		}
+	}
+	if cached != 10 {
+		t.Fatalf("expected 10 got %d", cached)
+	}
+}
@@ -0,0 +1,103 @@
+package pen
+
+// Replay the whole log into map of the latest data per key (last write wins), entries for which keyFn returns false are skipped.
+// Generic methods are not possible, so it is a function like ScanJSON, corruption is skipped like in Scan. The values are copied to their own exact size
+// slices (the small entries are read into blockSize buffers, keeping them would use blockSize per key), so they are owned by the map.
+// example:
+//	state, err := ScanMap(r, func(data []byte) (string, bool) {
+//		k, _, ok := bytes.Cut(data, []byte("="))
+//		return string(k), ok
+//	})
+func ScanMap[K comparable](r *Reader, keyFn func([]byte) (K, bool)) (map[K][]byte, error) {
+	m := map[K][]byte{}
+	err := r.ScanNoCopy(0, func(data []byte, offset, next uint32) error {
+		k, ok := keyFn(data)
+		if ok {
+			m[k] = append([]byte{}, data...)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Same as ScanMap but keeps only the offset of the latest entry per key, so the data can be read lazily with Read
+func ScanMapOffsets[K comparable](r *Reader, keyFn func([]byte) (K, bool)) (map[K]uint32, error) {
+	m := map[K]uint32{}
+	err := r.Scan(0, func(data []byte, offset, next uint32) error {
+		k, ok := keyFn(data)
+		if ok {
+			m[k] = offset
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Max total data length of the group buffered by ScanGroupBy, bigger groups are split
+var GroupByMaxBytes = 64 * 1024 * 1024
+
+// Scan from offset and call cb with every run of consecutive entries with the same key, when the key changes (and at the end of the file).
+// The log should be sorted by the key, if it is not the same key just gets more groups, one for every run.
+// The group is flushed early if its data would be bigger than GroupByMaxBytes (the entry that does not fit starts the next group with the same key),
+// so the memory is bounded. Every payload is copied into the group (instead of keeping the blockSize read buffer), so GroupByMaxBytes is the real size of the data,
+// and the group slices are owned by the callback. Same as ScanMap it is a function because generic methods are not possible.
+func ScanGroupBy[K comparable](r *Reader, offset uint32, keyFn func([]byte) K, cb func(key K, group [][]byte, offsets []uint32) error) error {
+	var key K
+	group := [][]byte{}
+	offsets := []uint32{}
+	size := 0
+	flush := func() error {
+		if len(group) == 0 {
+			return nil
+		}
+		err := cb(key, group, offsets)
+		group = [][]byte{}
+		offsets = []uint32{}
+		size = 0
+		return err
+	}
+
+	err := r.ScanNoCopy(offset, func(data []byte, offset, next uint32) error {
+		k := keyFn(data)
+		if len(group) > 0 && (k != key || size+len(data) > GroupByMaxBytes) {
+			err := flush()
+			if err != nil {
+				return err
+			}
+		}
+		key = k
+		group = append(group, append([]byte{}, data...))
+		offsets = append(offsets, offset)
+		size += len(data)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return flush()
+}
+
+// Fold all entries from offset into one value (e.g. sum, count, max), reduce gets the accumulator and returns the next one, error stops the scan (and is returned with the accumulator before the failed entry).
+// Corruption is skipped like in Scan, and the data passed to reduce is owned by it (it can be kept in the accumulator).
+// example:
+//	total, err := ScanReduce(r, 0, 0, func(acc int, data []byte, offset uint32) (int, error) {
+//		return acc + len(data), nil
+//	})
+func ScanReduce[A any](r *Reader, offset uint32, initial A, reduce func(acc A, data []byte, offset uint32) (A, error)) (A, error) {
+	acc := initial
+	err := r.Scan(offset, func(data []byte, offset, next uint32) error {
+		a, err := reduce(acc, data, offset)
+		if err != nil {
+			return err
+		}
+		acc = a
+		return nil
+	})
+	return acc, err
+}
@@ -0,0 +1,173 @@
+package pen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"strconv"
+	"testing"
+)
+
+func TestScanMap(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 4096)
+	defer done()
+
+	offsets := map[string]uint32{}
+	for i := 0; i < 100; i++ {
+		k := fmt.Sprintf("k%d", i%10)
+		off, _, err := fw.Append([]byte(fmt.Sprintf("%s=%d", k, i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets[k] = off
+		_, _, err = fw.Append([]byte("no key"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	keyFn := func(data []byte) (string, bool) {
+		k, _, ok := bytes.Cut(data, []byte("="))
+		return string(k), ok
+	}
+
+	m, err := ScanMap(reader, keyFn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(m) != 10 {
+		t.Fatalf("expected 10 keys got %d", len(m))
+	}
+	for i := 0; i < 10; i++ {
+		k := fmt.Sprintf("k%d", i)
+		if string(m[k]) != fmt.Sprintf("%s=%d", k, 90+i) {
+			t.Fatalf("unexpected %s: %s", k, m[k])
+		}
+		// copied out of the 4096 byte block
+		if cap(m[k]) > 64 {
+			t.Fatalf("value of %s pins %d bytes", k, cap(m[k]))
+		}
+	}
+
+	mo, err := ScanMapOffsets(reader, keyFn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(mo) != 10 {
+		t.Fatalf("expected 10 keys got %d", len(mo))
+	}
+	for k, off := range mo {
+		if offsets[k] != off {
+			t.Fatalf("%s: expected %d got %d", k, offsets[k], off)
+		}
+	}
+}
+
+func TestScanGroupBy(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 4096)
+	defer done()
+
+	for _, e := range []string{"a=1", "a=2", "b=1", "c=1", "c=2", "c=3", "a=3"} {
+		_, _, err := fw.Append([]byte(e))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	keyFn := func(data []byte) string {
+		return string(data[:1])
+	}
+
+	collect := func() []string {
+		got := []string{}
+		err := ScanGroupBy(reader, 0, keyFn, func(key string, group [][]byte, offsets []uint32) error {
+			if len(group) != len(offsets) {
+				t.Fatalf("%d entries and %d offsets", len(group), len(offsets))
+			}
+			s := key + ":"
+			for _, g := range group {
+				s += string(g[2:])
+				// copied out of the 4096 byte block
+				if cap(g) > 64 {
+					t.Fatalf("entry pins %d bytes", cap(g))
+				}
+			}
+			got = append(got, s)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if got := fmt.Sprint(collect()); got != "[a:12 b:1 c:123 a:3]" {
+		t.Fatalf("unexpected groups %s", got)
+	}
+
+	defer func(max int) {
+		GroupByMaxBytes = max
+	}(GroupByMaxBytes)
+	GroupByMaxBytes = 6
+	if got := fmt.Sprint(collect()); got != "[a:12 b:1 c:12 c:3 a:3]" {
+		t.Fatalf("unexpected groups %s", got)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err := ScanGroupBy(reader, 0, keyFn, func(key string, group [][]byte, offsets []uint32) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Fatalf("expected stop after the first group got %v %d", err, n)
+	}
+}
+
+func TestScanReduce(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	sum := func(acc int, data []byte, offset uint32) (int, error) {
+		n, err := strconv.Atoi(string(data))
+		return acc + n, err
+	}
+	total, err := ScanReduce(reader, 0, 100, sum)
+	if err != nil || total != 100 {
+		t.Fatalf("expected initial got %d %v", total, err)
+	}
+
+	offsets := []uint32{}
+	for i := 1; i <= 10; i++ {
+		off, _, err := fw.Append([]byte(strconv.Itoa(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	total, err = ScanReduce(reader, 0, 0, sum)
+	if err != nil || total != 55 {
+		t.Fatalf("expected 55 got %d %v", total, err)
+	}
+	total, err = ScanReduce(reader, offsets[5], 0, sum)
+	if err != nil || total != 6+7+8+9+10 {
+		t.Fatalf("unexpected %d %v", total, err)
+	}
+
+	longest, err := ScanReduce(reader, 0, []byte(nil), func(acc []byte, data []byte, offset uint32) ([]byte, error) {
+		if len(data) > len(acc) {
+			return data, nil
+		}
+		return acc, nil
+	})
+	if err != nil || string(longest) != "10" {
+		t.Fatalf("unexpected %s %v", longest, err)
+	}
+
+	_, _, err = fw.Append([]byte("x"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	total, err = ScanReduce(reader, 0, 0, sum)
+	if err == nil || total != 55 {
+		t.Fatalf("expected error after 55 got %d %v", total, err)
+	}
+}
@@ -0,0 +1,63 @@
+package pen
+
+import "io"
+
+// io.ReaderAt with known length, used by MultiReaderAt
+type SizedReaderAt struct {
+	io.ReaderAt
+	Size int64
+}
+
+type multiReaderAt struct {
+	readers []SizedReaderAt
+	size    int64
+}
+
+// Returns io.ReaderAt that is the logical concatenation of the input readers, e.g. base snapshot and delta overlay.
+// Reads that span a boundary read from both sides, reads past the end return io.EOF.
+func MultiReaderAt(readers ...SizedReaderAt) io.ReaderAt {
+	m := &multiReaderAt{readers: readers}
+	for _, r := range readers {
+		m.size += r.Size
+	}
+	return m
+}
+
+// Total size of all readers, so Reader.TailState and friends work
+func (m *multiReaderAt) Size() int64 {
+	return m.size
+}
+
+func (m *multiReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, EINVAL
+	}
+	n := 0
+	for _, r := range m.readers {
+		if len(p) == 0 {
+			break
+		}
+		if off >= r.Size {
+			off -= r.Size
+			continue
+		}
+		want := p
+		if int64(len(want)) > r.Size-off {
+			want = want[:r.Size-off]
+		}
+		read, err := r.ReadAt(want, off)
+		n += read
+		if read < len(want) {
+			if err == nil || err == io.EOF {
+				err = io.ErrUnexpectedEOF
+			}
+			return n, err
+		}
+		p = p[read:]
+		off = 0
+	}
+	if len(p) > 0 {
+		return n, io.EOF
+	}
+	return n, nil
+}
@@ -0,0 +1,63 @@
+package pen
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"testing"
+)
+
+func TestMultiReaderAt(t *testing.T) {
+	w, r, done := newTestWriterReader(t, 0)
+	defer done()
+	offsets := []uint32{}
+	for i := 0; i < 100; i++ {
+		off, _, err := w.Append([]byte(fmt.Sprintf("%d%s", i, RandStringRunes(i))))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	size, err := r.size()
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob := make([]byte, size)
+	_, err = r.reader.ReadAt(blob, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, split := range []int{0, 1, 15, 16, 17, 64, 1000, len(blob) / 2, len(blob) - 1, len(blob)} {
+		a, c := blob[:split], blob[split:]
+		m := MultiReaderAt(
+			SizedReaderAt{bytes.NewReader(a), int64(len(a))},
+			SizedReaderAt{bytes.NewReader(nil), 0},
+			SizedReaderAt{bytes.NewReader(c), int64(len(c))},
+		)
+
+		all := make([]byte, len(blob)+10)
+		n, err := m.ReadAt(all, 0)
+		if err != io.EOF || n != len(blob) || !bytes.Equal(all[:n], blob) {
+			t.Fatalf("split %d: n %d err %v", split, n, err)
+		}
+
+		i := 0
+		err = ScanFromReader(m, 0, 64, func(data []byte, offset, next uint32) error {
+			if offset != offsets[i] {
+				t.Fatalf("split %d: expected offset %d got %d", split, offsets[i], offset)
+			}
+			if !bytes.HasPrefix(data, []byte(fmt.Sprintf("%d", i))) {
+				t.Fatalf("split %d: unexpected data at %d", split, i)
+			}
+			i++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i != len(offsets) {
+			t.Fatalf("split %d: expected %d got %d", split, len(offsets), i)
+		}
+	}
+}
@@ -0,0 +1,39 @@
+package pen
+
+import (
+	"io"
+	"sync/atomic"
+)
+
+// Max size of the padded entry (header, data and the padding) in WriterOptions.MultiProcess mode, bigger entries return EOVERFLOW.
+// It is PIPE_BUF, POSIX guarantees that O_APPEND writes up to it are not interleaved, and on regular files of the common filesystems (ext4, xfs)
+// the bigger writes are also atomic, but a write can still be partial if the disk is full, or if the process is killed during it.
+var AtomicAppendSize = 4096
+
+// write the padded blob with one O_APPEND write, and find where it went from the file position after it
+// the lock is only for the writers in this process, they share the file position
+func (fw *Writer) appendMultiProcess(blob []byte, padded uint32) (uint32, uint32, error) {
+	size := int64(padded) * int64(PAD)
+	if size > int64(AtomicAppendSize) {
+		return 0, 0, EOVERFLOW
+	}
+
+	fw.appendLock.Lock()
+	defer fw.appendLock.Unlock()
+
+	out := make([]byte, size)
+	copy(out, blob)
+	_, err := fw.file.Write(out)
+	if err != nil {
+		return 0, 0, err
+	}
+	end, err := fw.file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, 0, err
+	}
+	fw.end = end
+	next := uint32(end / int64(PAD))
+	atomic.StoreUint32(&fw.offset, next)
+	fw.written.reset(next)
+	return next - padded, next, nil
+}
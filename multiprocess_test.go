@@ -0,0 +1,129 @@
+package pen
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+)
+
+func TestMultiProcessWriter(t *testing.T) {
+	dir, err := ioutil.TempDir("", "multi")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "multi")
+
+	// every writer has its own fd, same as separate processes
+	writers := []*Writer{}
+	for i := 0; i < 4; i++ {
+		fw, err := NewWriterWithOptions(fn, WriterOptions{MultiProcess: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer fw.Close()
+		writers = append(writers, fw)
+	}
+
+	type written struct {
+		offset uint32
+		data   string
+	}
+	var lock sync.Mutex
+	all := []written{}
+	var wg sync.WaitGroup
+	for w, fw := range writers {
+		for g := 0; g < 2; g++ {
+			wg.Add(1)
+			go func(fw *Writer, w, g int) {
+				defer wg.Done()
+				for i := 0; i < 200; i++ {
+					data := fmt.Sprintf("%d/%d/%d/%s", w, g, i, RandStringRunes(i%100))
+					offset, next, err := fw.Append([]byte(data))
+					if err != nil {
+						t.Error(err)
+						return
+					}
+					if next != nextOffset(offset, len(data)) {
+						t.Errorf("unexpected next %d for %d", next, offset)
+						return
+					}
+					lock.Lock()
+					all = append(all, written{offset, data})
+					lock.Unlock()
+				}
+			}(fw, w, g)
+		}
+	}
+	wg.Wait()
+
+	s, err := os.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if s.Size()%int64(PAD) != 0 {
+		t.Fatalf("file is not aligned %d", s.Size())
+	}
+
+	reader, err := NewReader(fn, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	seen := map[uint32]bool{}
+	for _, e := range all {
+		if seen[e.offset] {
+			t.Fatalf("offset %d returned twice", e.offset)
+		}
+		seen[e.offset] = true
+		data, _, err := reader.Read(e.offset)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(data) != e.data {
+			t.Fatalf("mismatch at %d: %q != %q", e.offset, data, e.data)
+		}
+	}
+	n := 0
+	err = reader.Scan(0, func(data []byte, offset, next uint32) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(all) {
+		t.Fatalf("expected %d got %d", len(all), n)
+	}
+
+	if _, _, err := writers[0].Append(make([]byte, AtomicAppendSize)); err != EOVERFLOW {
+		t.Fatalf("expected EOVERFLOW got %v", err)
+	}
+	if err := writers[0].Overwrite(0, []byte("x")); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+
+	// a file with unpadded last entry
+	unaligned := path.Join(dir, "unaligned")
+	fw, err := NewWriter(unaligned)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fw.Append([]byte("x")); err != nil {
+		t.Fatal(err)
+	}
+	fw.Close()
+	if _, err := NewWriterWithOptions(unaligned, WriterOptions{MultiProcess: true}); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+	if _, err := NewWriterWithOptions(fn, WriterOptions{MultiProcess: true, FileCRC: true}); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+	onAppend := func([]byte, uint32, uint32) error { return nil }
+	if _, err := NewWriterWithOptions(fn, WriterOptions{MultiProcess: true, OnAppend: onAppend}); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+}
@@ -0,0 +1,13 @@
+package pen
+
+import "bytes"
+
+// Read the entry at offset, and return Reader over its data, for when the data itself is a pen file.
+// The nested reader has the same blockSize and options, and its own copy of the data, so it does not alias any buffer.
+func (ar *Reader) NestedReader(offset uint32) (*Reader, error) {
+	data, _, err := ar.Read(offset)
+	if err != nil {
+		return nil, err
+	}
+	return newReader(bytes.NewReader(append([]byte{}, data...)), nil, ar.blockSize, ar.opts)
+}
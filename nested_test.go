@@ -0,0 +1,60 @@
+package pen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"testing"
+)
+
+func TestNestedReader(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+	nw, nr, ndone := newTestWriterReader(t, 0)
+	defer ndone()
+
+	expected := [][]byte{}
+	for i := 0; i < 10; i++ {
+		data := []byte(RandStringRunes(i * 10))
+		_, _, err := nw.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, data)
+	}
+	nested, err := ioutil.ReadFile(nr.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	off, _, err := fw.Append(nested)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	r, err := reader.NestedReader(off)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	n := 0
+	err = r.Scan(0, func(data []byte, offset, next uint32) error {
+		if !bytes.Equal(data, expected[n]) {
+			t.Fatalf("mismatch at %d", n)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(expected) {
+		t.Fatalf("expected %d got %d", len(expected), n)
+	}
+
+	_, garbage, err := r.TailState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if garbage != 0 {
+		t.Fatalf("expected no garbage got %d", garbage)
+	}
+}
@@ -0,0 +1,78 @@
+package pen
+
+import (
+	"encoding/json"
+	"sort"
+)
+
+// number of entries at the start of the file used by Open to pick the block size
+const openSampleEntries = 64
+
+// max block size picked by Open, bigger entries are read with second read
+const openMaxBlockSize = 64 * 1024
+
+// percentile of the sampled entry sizes used as the block size, so most entries are read with one read, but a few huge ones do not make the block huge
+const openBlockPercentile = 90
+
+// Reader settings that Open reads from the schema entry (Writer.SetSchema) when it is JSON object, e.g. {"block_size":4096,"codec":"json"},
+// the other fields (the payload format) are ignored, so the same JSON can describe both.
+type Format struct {
+	// block size of the reader, if not set it is picked from the first entries
+	BlockSize int `json:"block_size,omitempty"`
+
+	// same as ReaderOptions.TrailingDataChecksum
+	TrailingDataChecksum bool `json:"trailing_data_checksum,omitempty"`
+}
+
+// Open the file for reading without knowing the block size or the format options. If the file starts with a schema that is JSON with the fields of Format,
+// the reader is configured from it. Otherwise (and if the schema has no block_size) the block size is picked from the sizes of the first entries
+// (so a typical entry is read with one read), or 16 if the file is empty. The compact headers, the schema and the file crc trailer are recognized per entry,
+// so they need no options, but files written with WriterOptions.FixedSize or WriterOptions.Transforms have to be opened with NewReaderWithOptions.
+func Open(filename string) (*Reader, error) {
+	r, err := NewReader(filename, 16)
+	if err != nil {
+		return nil, err
+	}
+
+	format := Format{}
+	schema, ok, err := r.Schema()
+	if err != nil && err != EBADSLT {
+		r.Close()
+		return nil, err
+	}
+	if ok && json.Unmarshal(schema, &format) == nil {
+		r.opts.TrailingDataChecksum = format.TrailingDataChecksum
+		if format.BlockSize >= 16 {
+			r.blockSize = format.BlockSize
+			return r, nil
+		}
+	}
+
+	sizes := []int{}
+	err = r.ScanNoCopy(0, func(data []byte, offset, next uint32) error {
+		sizes = append(sizes, 16+r.entryLen(uint32(len(data))))
+		if len(sizes) == openSampleEntries {
+			return errStopScan
+		}
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		r.Close()
+		return nil, err
+	}
+
+	blockSize := 16
+	if len(sizes) > 0 {
+		sort.Ints(sizes)
+		if size := sizes[(len(sizes)-1)*openBlockPercentile/100]; size > blockSize {
+			blockSize = size
+		}
+		// round up to PAD, the entries are padded to it anyway
+		blockSize = int((uint32(blockSize) + PAD - 1) / PAD * PAD)
+	}
+	if blockSize > openMaxBlockSize {
+		blockSize = openMaxBlockSize
+	}
+	r.blockSize = blockSize
+	return r, nil
+}
@@ -0,0 +1,155 @@
+package pen
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestOpen(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	empty, err := Open(reader.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if empty.blockSize != 16 {
+		t.Fatalf("expected block size 16 got %d", empty.blockSize)
+	}
+	empty.Close()
+
+	expected := [][]byte{}
+	for i := 0; i < 100; i++ {
+		d := []byte(RandStringRunes(100 + i%50))
+		if i == 80 {
+			d = make([]byte, 1024*1024)
+		}
+		_, _, err := fw.Append(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, d)
+	}
+
+	r, err := Open(reader.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if r.blockSize != 192 {
+		t.Fatalf("expected block size 192 got %d", r.blockSize)
+	}
+	n := 0
+	err = r.Scan(0, func(data []byte, offset, next uint32) error {
+		if !bytes.Equal(data, expected[n]) {
+			t.Fatalf("entry %d mismatch", n)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(expected) {
+		t.Fatalf("expected %d got %d", len(expected), n)
+	}
+
+	if _, err := Open(reader.file.Name() + ".missing"); err == nil {
+		t.Fatalf("expected error")
+	}
+}
+
+func TestOpenFormat(t *testing.T) {
+	dir, err := ioutil.TempDir("", "open")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// a few huge entries do not make the block huge
+	fn := path.Join(dir, "sizes")
+	fw, err := NewWriter(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 100; i++ {
+		d := make([]byte, 100)
+		if i%20 == 0 {
+			d = make([]byte, 100000)
+		}
+		if _, _, err := fw.Append(d); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fw.Close()
+	r, err := Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r.blockSize != 128 {
+		t.Fatalf("expected block size 128 got %d", r.blockSize)
+	}
+	r.Close()
+
+	// the block size from the schema
+	fn = path.Join(dir, "schema")
+	fw, err = NewWriter(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := fw.SetSchema([]byte(`{"block_size":4096,"codec":"json"}`)); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, _, err := fw.Append([]byte(`{"a":1}`)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	fw.Close()
+	r, err = Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	err = r.Scan(0, func(data []byte, offset, next uint32) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 10 || r.blockSize != 4096 {
+		t.Fatalf("unexpected %d %d %v", r.blockSize, n, err)
+	}
+	r.Close()
+
+	// the layout from the schema
+	fn = path.Join(dir, "trailing")
+	schema := entryBlob([]byte(`{"trailing_data_checksum":true}`), SCHEMA_MAGIC)
+	file := append(schema, make([]byte, (int(PAD)-len(schema)%int(PAD))%int(PAD))...)
+	entries := [][]byte{[]byte("a"), bytes.Repeat([]byte("b"), 45), bytes.Repeat([]byte("c"), 1000)}
+	for _, e := range entries {
+		file = append(file, trailingBlob(e)...)
+	}
+	if err := ioutil.WriteFile(fn, file, 0600); err != nil {
+		t.Fatal(err)
+	}
+	r, err = Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	got := [][]byte{}
+	errs, err := r.ScanCollectErrors(0, func(data []byte, offset, next uint32) error {
+		got = append(got, data)
+		return nil
+	})
+	if err != nil || len(errs) != 0 || len(got) != len(entries) || !r.opts.TrailingDataChecksum {
+		t.Fatalf("unexpected %q %v %v", got, errs, err)
+	}
+	for i := range entries {
+		if !bytes.Equal(got[i], entries[i]) {
+			t.Fatalf("entry %d: unexpected %q", i, got[i])
+		}
+	}
+}
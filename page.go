@@ -0,0 +1,65 @@
+package pen
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+)
+
+// Read up to pageSize entries starting from the cursor (empty cursor starts from the beginning of the file), for stateless pagination (e.g. http handler).
+// It returns the entries and the cursor of the next page, which is empty if the page reached the end of the file.
+// The cursor is url safe base64 of the offset and its checksum, it returns EINVAL for malformed or modified cursor, or cursor after the end of the file.
+// The checksum is not a signature, it only guards against broken or hand edited cursors, the entries are found the same way as Scan even from a forged offset.
+func (ar *Reader) Page(cursor string, pageSize int) ([][]byte, string, error) {
+	if pageSize <= 0 {
+		return nil, "", EINVAL
+	}
+	offset := uint32(0)
+	if cursor != "" {
+		var err error
+		offset, err = decodeCursor(cursor)
+		if err != nil {
+			return nil, "", err
+		}
+	}
+	size, err := ar.size()
+	if err != nil {
+		return nil, "", err
+	}
+	if byteOffset(offset) > size {
+		return nil, "", EINVAL
+	}
+
+	entries := [][]byte{}
+	end := offset
+	err = ar.Scan(offset, func(data []byte, offset, next uint32) error {
+		entries = append(entries, data)
+		end = next
+		if len(entries) == pageSize {
+			return errStopScan
+		}
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		return nil, "", err
+	}
+	// the last entry is not padded, so its next is at or after the end of the file
+	if err != errStopScan || byteOffset(end) >= size {
+		return entries, "", nil
+	}
+	return entries, encodeCursor(end), nil
+}
+
+func encodeCursor(offset uint32) string {
+	b := make([]byte, 8)
+	binary.LittleEndian.PutUint32(b, offset)
+	binary.LittleEndian.PutUint32(b[4:], uint32(Hash(b[:4])))
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeCursor(cursor string) (uint32, error) {
+	b, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil || len(b) != 8 || binary.LittleEndian.Uint32(b[4:]) != uint32(Hash(b[:4])) {
+		return 0, EINVAL
+	}
+	return binary.LittleEndian.Uint32(b), nil
+}
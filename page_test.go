@@ -0,0 +1,70 @@
+package pen
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestPage(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	entries, next, err := reader.Page("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 0 || next != "" {
+		t.Fatalf("expected empty page got %d %q", len(entries), next)
+	}
+
+	for i := 0; i < 95; i++ {
+		_, _, err := fw.Append([]byte(fmt.Sprintf("%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, pageSize := range []int{1, 10, 19, 95, 100} {
+		cursor := ""
+		n := 0
+		pages := 0
+		for {
+			entries, next, err := reader.Page(cursor, pageSize)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, e := range entries {
+				if string(e) != fmt.Sprintf("%d", n) {
+					t.Fatalf("page size %d: expected %d got %s", pageSize, n, e)
+				}
+				n++
+			}
+			pages++
+			if next == "" {
+				break
+			}
+			if len(entries) != pageSize {
+				t.Fatalf("page size %d: short page %d with next cursor", pageSize, len(entries))
+			}
+			cursor = next
+		}
+		if n != 95 || pages != (95+pageSize-1)/pageSize {
+			t.Fatalf("page size %d: got %d entries in %d pages", pageSize, n, pages)
+		}
+	}
+
+	_, next, err = reader.Page("", 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := []byte(next)
+	tampered[0] ^= 1
+	for _, cursor := range []string{"!!", "AAAA", string(tampered), encodeCursor(1 << 30)} {
+		if _, _, err := reader.Page(cursor, 10); err != EINVAL {
+			t.Fatalf("cursor %q: expected EINVAL got %v", cursor, err)
+		}
+	}
+	if _, _, err := reader.Page("", 0); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+}
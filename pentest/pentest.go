@@ -0,0 +1,43 @@
+// Package pentest provides helpers for testing code that produces pen files
+package pentest
+
+import (
+	"bytes"
+	"errors"
+	"io"
+
+	pen "github.com/rekki/go-pen"
+)
+
+var errMismatch = errors.New("mismatch")
+
+// Check if two append files contain the same entries in the same order, ignoring offsets and padding.
+// Corrupted entries are skipped in both the same way pen.ScanFromReader skips them.
+// Returns false on the first payload mismatch or if the amount of entries differs.
+func EntriesEqual(a, b io.ReaderAt, blockSize int) (bool, error) {
+	entries := [][]byte{}
+	err := pen.ScanFromReader(a, 0, blockSize, func(data []byte, offset, next uint32) error {
+		entries = append(entries, data)
+		return nil
+	})
+	if err != nil {
+		return false, err
+	}
+
+	n := 0
+	err = pen.ScanFromReader(b, 0, blockSize, func(data []byte, offset, next uint32) error {
+		if n >= len(entries) || !bytes.Equal(entries[n], data) {
+			return errMismatch
+		}
+		n++
+		return nil
+	})
+	if err == errMismatch {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	return n == len(entries), nil
+}
@@ -0,0 +1,77 @@
+package pentest
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	pen "github.com/rekki/go-pen"
+)
+
+func TestEntriesEqual(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pentest")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	write := func(name string, entries ...string) *os.File {
+		fn := path.Join(dir, name)
+		w, err := pen.NewWriter(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer w.Close()
+		for _, e := range entries {
+			_, _, err := w.Append([]byte(e))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		f, err := os.OpenFile(fn, os.O_RDWR, 0600)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	a := write("a", "hello", "world")
+	defer a.Close()
+
+	// same entries, but "hello" was overwritten with a shorter payload so there is garbage between the entries
+	b := write("b", string(make([]byte, 100)), "world")
+	defer b.Close()
+	w, err := pen.NewWriterFromFile(b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = w.Overwrite(0, []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	c := write("c", "hello", "world", "!")
+	defer c.Close()
+	d := write("d", "hello", "w0rld")
+	defer d.Close()
+
+	for _, tc := range []struct {
+		x, y     *os.File
+		expected bool
+	}{
+		{a, a, true},
+		{a, b, true},
+		{a, c, false},
+		{c, a, false},
+		{a, d, false},
+	} {
+		equal, err := EntriesEqual(tc.x, tc.y, 16)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if equal != tc.expected {
+			t.Fatalf("%s vs %s: expected %v got %v", tc.x.Name(), tc.y.Name(), tc.expected, equal)
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package pen
+
+import (
+	"os"
+	"runtime"
+	"sync"
+	"sync/atomic"
+)
+
+// io.ReaderAt over multiple fds of the same file, the reads are round-robined across them
+type filePool struct {
+	files []*os.File
+	next  uint32
+}
+
+func (p *filePool) ReadAt(b []byte, off int64) (int, error) {
+	i := atomic.AddUint32(&p.next, 1) % uint32(len(p.files))
+	return p.files[i].ReadAt(b, off)
+}
+
+func (p *filePool) Close() error {
+	var first error
+	for _, f := range p.files {
+		err := f.Close()
+		if err != nil && first == nil {
+			first = err
+		}
+	}
+	return first
+}
+
+// Same as NewReader but keeps poolSize fds of the file open, and round-robins the reads across them, so the kernel can serve parallel reads
+// (e.g. with ReadMany) without contention on a single fd. Close closes all of them. poolSize must be at least 1.
+func NewPooledReader(filename string, blockSize, poolSize int) (*Reader, error) {
+	if blockSize == 0 {
+		blockSize = 16
+	}
+	if blockSize < 16 || poolSize < 1 {
+		return nil, EINVAL
+	}
+
+	pool := &filePool{}
+	for i := 0; i < poolSize; i++ {
+		fd, err := os.OpenFile(filename, os.O_RDONLY, 0600)
+		if err != nil {
+			pool.Close()
+			return nil, err
+		}
+		pool.files = append(pool.files, fd)
+	}
+	r, err := newReader(pool, pool.files[0], blockSize, ReaderOptions{})
+	if err != nil {
+		pool.Close()
+		return nil, err
+	}
+	return r, nil
+}
+
+// Read the entries at offsets in parallel, the data is returned in the same order as the offsets.
+// It uses one goroutine per fd of a NewPooledReader, or GOMAXPROCS goroutines otherwise. If any of the reads fails the first error is returned.
+func (ar *Reader) ReadMany(offsets []uint32) ([][]byte, error) {
+	workers := runtime.GOMAXPROCS(0)
+	if p, ok := ar.underlying().(*filePool); ok {
+		workers = len(p.files)
+	}
+	if workers > len(offsets) {
+		workers = len(offsets)
+	}
+
+	out := make([][]byte, len(offsets))
+	var next int64 = -1
+	var firstErr error
+	var errOnce sync.Once
+	var wg sync.WaitGroup
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				i := atomic.AddInt64(&next, 1)
+				if i >= int64(len(offsets)) {
+					return
+				}
+				data, _, err := ar.Read(offsets[i])
+				if err != nil {
+					errOnce.Do(func() { firstErr = err })
+					return
+				}
+				out[i] = data
+			}
+		}()
+	}
+	wg.Wait()
+	if firstErr != nil {
+		return nil, firstErr
+	}
+	return out, nil
+}
@@ -0,0 +1,114 @@
+package pen
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+func TestPooledReader(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	expected := [][]byte{}
+	offsets := []uint32{}
+	for i := 0; i < 1000; i++ {
+		d := []byte(RandStringRunes(i % 300))
+		off, _, err := fw.Append(d)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, d)
+		offsets = append(offsets, off)
+	}
+
+	if _, err := NewPooledReader(reader.file.Name(), 64, 0); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+	pooled, err := NewPooledReader(reader.file.Name(), 64, 4)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, r := range []*Reader{reader, pooled} {
+		data, err := r.ReadMany(offsets)
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := range data {
+			if !bytes.Equal(data[i], expected[i]) {
+				t.Fatalf("entry %d mismatch", i)
+			}
+		}
+		n := 0
+		err = r.Scan(0, func(data []byte, offset, next uint32) error {
+			n++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(expected) {
+			t.Fatalf("expected %d got %d", len(expected), n)
+		}
+	}
+
+	if _, err := pooled.ReadMany([]uint32{offsets[1], offsets[len(offsets)-1] + 1000}); err != io.EOF {
+		t.Fatalf("expected io.EOF got %v", err)
+	}
+
+	pool := pooled.underlying().(*filePool)
+	err = pooled.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, f := range pool.files {
+		if _, err := f.Stat(); err == nil {
+			t.Fatalf("expected all fds to be closed")
+		}
+	}
+}
+
+func benchmarkParallelRead(b *testing.B, poolSize int) {
+	fw, reader, done := newTestWriterReader(b, 0)
+	defer done()
+
+	offsets := []uint32{}
+	for i := 0; i < 10000; i++ {
+		off, _, err := fw.Append(make([]byte, 4096))
+		if err != nil {
+			b.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	r, err := NewReader(reader.file.Name(), 4096+16)
+	if poolSize > 0 {
+		r, err = NewPooledReader(reader.file.Name(), 4096+16, poolSize)
+	}
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer r.Close()
+
+	b.SetParallelism(16)
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		i := 0
+		for pb.Next() {
+			_, _, err := r.Read(offsets[(i*7919)%len(offsets)])
+			if err != nil {
+				b.Error(err)
+				return
+			}
+			i++
+		}
+	})
+}
+
+func BenchmarkReadSingleFd(b *testing.B) {
+	benchmarkParallelRead(b, 0)
+}
+
+func BenchmarkReadPooled(b *testing.B) {
+	benchmarkParallelRead(b, 8)
+}
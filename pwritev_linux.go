@@ -0,0 +1,42 @@
+//go:build linux
+// +build linux
+
+package pen
+
+import (
+	"os"
+
+	"golang.org/x/sys/unix"
+)
+
+// max amount of iovecs in one pwritev (IOV_MAX)
+const iovMax = 1024
+
+func writeVectored(file *os.File, iovs [][]byte, off int64) error {
+	fd := int(file.Fd())
+	for len(iovs) > 0 {
+		chunk := iovs
+		if len(chunk) > iovMax {
+			chunk = chunk[:iovMax]
+		}
+		iovs = iovs[len(chunk):]
+
+		size := 0
+		for _, b := range chunk {
+			size += len(b)
+		}
+		n, err := unix.Pwritev(fd, chunk, off)
+		if err != nil {
+			return err
+		}
+		if n < size {
+			// short write, write the rest the simple way
+			err = writeCopy(file, skipBytes(chunk, n), off+int64(n))
+			if err != nil {
+				return err
+			}
+		}
+		off += int64(size)
+	}
+	return nil
+}
@@ -0,0 +1,11 @@
+//go:build !linux
+// +build !linux
+
+package pen
+
+import "os"
+
+// pwritev is not available, so the entries are copied into one buffer
+func writeVectored(file *os.File, iovs [][]byte, off int64) error {
+	return writeCopy(file, iovs, off)
+}
@@ -0,0 +1,222 @@
+package pen
+
+import (
+	"container/heap"
+	"context"
+	"math"
+	"sync"
+)
+
+// Scan only the entries starting in [start, end), the scan resyncs to the first valid entry at or after start (so start does not have to be the exact offset of an entry)
+// and stops at the first entry at or after end.
+// Every entry belongs to exactly one range, so adjacent ranges can be scanned independently, without processing an entry twice.
+func (ar *Reader) ScanRange(start, end uint32, cb func([]byte, uint32, uint32) error) error {
+	if start >= end {
+		return nil
+	}
+	err := ar.Scan(start, func(data []byte, offset, next uint32) error {
+		if offset >= end {
+			return errStopScan
+		}
+		return cb(data, offset, next)
+	})
+	if err == errStopScan {
+		return nil
+	}
+	return err
+}
+
+// Split the file in k roughly equal ranges, and scan them in parallel with ScanRange, the callback is called concurrently from k goroutines, so it must be safe for concurrent use.
+// The order of the entries is *not* preserved.
+// If any callback returns error the other ranges stop at their next entry, and the first error is returned.
+// Each range resyncs to the first valid entry in it, so the same caveat as LastN applies: if a range starts inside a payload that contains valid entries at PAD aligned positions, they will be processed.
+func (ar *Reader) ScanConcurrent(k int, cb func([]byte, uint32, uint32) error) error {
+	if k <= 0 {
+		return EINVAL
+	}
+	ranges, err := ar.ranges(k)
+	if err != nil {
+		return err
+	}
+
+	var (
+		wg       sync.WaitGroup
+		lock     sync.Mutex
+		firstErr error
+	)
+	failed := func() bool {
+		lock.Lock()
+		defer lock.Unlock()
+		return firstErr != nil
+	}
+
+	for i := 0; i < len(ranges)-1; i++ {
+		wg.Add(1)
+		go func(start, end uint32) {
+			defer wg.Done()
+			err := ar.ScanRange(start, end, func(data []byte, offset, next uint32) error {
+				if failed() {
+					return errStopScan
+				}
+				return cb(data, offset, next)
+			})
+			if err != nil && err != errStopScan {
+				lock.Lock()
+				if firstErr == nil {
+					firstErr = err
+				}
+				lock.Unlock()
+			}
+		}(ranges[i], ranges[i+1])
+	}
+	wg.Wait()
+	return firstErr
+}
+
+// k+1 boundaries splitting the file in k ranges, the last one is after the end of the file
+func (ar *Reader) ranges(k int) ([]uint32, error) {
+	size, err := ar.size()
+	if err != nil {
+		return nil, err
+	}
+	total := uint64((size + int64(PAD) - 1) / int64(PAD))
+	out := make([]uint32, k+1)
+	for i := 0; i < k; i++ {
+		out[i] = uint32(uint64(i) * total / uint64(k))
+	}
+	// everything after the end also belongs to the last range, in case the file grows
+	out[k] = math.MaxUint32
+	return out, nil
+}
+
+// Range of the file returned by Reader.Split, [Start, End) in offsets
+type RangeReader struct {
+	r     *Reader
+	Start uint32
+	End   uint32
+}
+
+// Scan the entries in the range, same as Reader.ScanRange(Start, End, cb)
+func (rr *RangeReader) Scan(cb func([]byte, uint32, uint32) error) error {
+	return rr.r.ScanRange(rr.Start, rr.End, cb)
+}
+
+// Split the file in n disjoint ranges to be scanned independently (e.g. by different workers), every entry belongs to exactly one range.
+// Unlike ScanConcurrent the boundaries are moved to the first valid entry after the n equal parts, so Start of every range (except the first) is an entry offset,
+// with the same caveat as ScanConcurrent about valid entries inside payloads. The last range ends with math.MaxUint32, so it includes the entries appended later.
+func (ar *Reader) Split(n int) ([]*RangeReader, error) {
+	if n <= 0 {
+		return nil, EINVAL
+	}
+	boundaries, err := ar.ranges(n)
+	if err != nil {
+		return nil, err
+	}
+	for i := 1; i < n; i++ {
+		if boundaries[i] < boundaries[i-1] {
+			boundaries[i] = boundaries[i-1]
+		}
+		b, err := ar.firstEntryFrom(boundaries[i])
+		if err != nil {
+			return nil, err
+		}
+		boundaries[i] = b
+	}
+
+	out := make([]*RangeReader, n)
+	for i := range out {
+		out[i] = &RangeReader{r: ar, Start: boundaries[i], End: boundaries[i+1]}
+	}
+	return out, nil
+}
+
+// offset of the first valid entry at or after offset, or the offset after the end of the file if there is none
+func (ar *Reader) firstEntryFrom(offset uint32) (uint32, error) {
+	first := uint32(math.MaxUint32)
+	end := offset
+	err := ar.Scan(offset, func(data []byte, offset, next uint32) error {
+		first = offset
+		return errStopScan
+	})
+	if err != nil && err != errStopScan {
+		return 0, err
+	}
+	if first != math.MaxUint32 {
+		return first, nil
+	}
+	size, err := ar.size()
+	if err != nil {
+		return 0, err
+	}
+	if e := uint32((size + int64(PAD) - 1) / int64(PAD)); e > end {
+		end = e
+	}
+	return end, nil
+}
+
+// Result of processing the entry at Offset, sent on the per-range channels given to MergeOrdered
+type RangeResult[T any] struct {
+	Offset uint32
+	Value  T
+}
+
+// Merge the per-range results (e.g. from processing the ranges of Reader.Split concurrently) in one channel ordered by offset.
+// Every input channel must be in increasing offset order and closed by its producer when done, the merge is streaming and holds only
+// the head of every input, the returned channel is closed after all inputs are closed, or when ctx is done.
+// Cancel ctx if the output is not drained, otherwise the merge goroutine is blocked on it forever. It stops reading the inputs then,
+// so the producers should watch the same ctx instead of blocking on their send.
+func MergeOrdered[T any](ctx context.Context, results []<-chan RangeResult[T]) <-chan RangeResult[T] {
+	out := make(chan RangeResult[T])
+	go func() {
+		defer close(out)
+		receive := func(c <-chan RangeResult[T]) (RangeResult[T], bool) {
+			select {
+			case v, ok := <-c:
+				return v, ok
+			case <-ctx.Done():
+				return RangeResult[T]{}, false
+			}
+		}
+		h := &resultHeap[T]{}
+		for _, c := range results {
+			if v, ok := receive(c); ok {
+				h.items = append(h.items, resultHead[T]{v, c})
+			}
+		}
+		heap.Init(h)
+		for len(h.items) > 0 && ctx.Err() == nil {
+			head := &h.items[0]
+			select {
+			case out <- head.value:
+			case <-ctx.Done():
+				return
+			}
+			if v, ok := receive(head.c); ok {
+				head.value = v
+				heap.Fix(h, 0)
+			} else {
+				heap.Pop(h)
+			}
+		}
+	}()
+	return out
+}
+
+type resultHead[T any] struct {
+	value RangeResult[T]
+	c     <-chan RangeResult[T]
+}
+
+type resultHeap[T any] struct {
+	items []resultHead[T]
+}
+
+func (h *resultHeap[T]) Len() int           { return len(h.items) }
+func (h *resultHeap[T]) Less(i, j int) bool { return h.items[i].value.Offset < h.items[j].value.Offset }
+func (h *resultHeap[T]) Swap(i, j int)      { h.items[i], h.items[j] = h.items[j], h.items[i] }
+func (h *resultHeap[T]) Push(x interface{}) { h.items = append(h.items, x.(resultHead[T])) }
+func (h *resultHeap[T]) Pop() interface{} {
+	last := h.items[len(h.items)-1]
+	h.items = h.items[:len(h.items)-1]
+	return last
+}
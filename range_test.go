@@ -0,0 +1,217 @@
+package pen
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sync"
+	"testing"
+)
+
+func TestScanRange(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	offsets := []uint32{}
+	for i := 0; i < 100; i++ {
+		off, _, err := fw.Append([]byte(RandStringRunes(i * 5)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+
+	// two ranges split in the middle of an entry
+	split := offsets[50] + 1
+	seen := map[uint32]int{}
+	for _, r := range [][2]uint32{{0, split}, {split, offsets[99] + 1000}} {
+		err := reader.ScanRange(r[0], r[1], func(data []byte, offset, next uint32) error {
+			if offset < r[0] || offset >= r[1] {
+				t.Fatalf("offset %d out of range %v", offset, r)
+			}
+			seen[offset]++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, off := range offsets {
+		if seen[off] != 1 {
+			t.Fatalf("offset %d seen %d times", off, seen[off])
+		}
+	}
+}
+
+func TestScanConcurrent(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	expected := map[uint32][]byte{}
+	for i := 0; i < 1000; i++ {
+		data := []byte(RandStringRunes(i % 300))
+		off, _, err := fw.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected[off] = data
+	}
+
+	for _, k := range []int{1, 2, 7, 64} {
+		var lock sync.Mutex
+		seen := map[uint32]int{}
+		err := reader.ScanConcurrent(k, func(data []byte, offset, next uint32) error {
+			lock.Lock()
+			defer lock.Unlock()
+			if !bytes.Equal(data, expected[offset]) {
+				t.Errorf("data mismatch at %d", offset)
+			}
+			seen[offset]++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(seen) != len(expected) {
+			t.Fatalf("k: %d, expected %d got %d", k, len(expected), len(seen))
+		}
+		for off, n := range seen {
+			if n != 1 {
+				t.Fatalf("k: %d, offset %d seen %d times", k, off, n)
+			}
+		}
+	}
+
+	stop := errors.New("stop")
+	err := reader.ScanConcurrent(4, func(data []byte, offset, next uint32) error {
+		return stop
+	})
+	if err != stop {
+		t.Fatalf("expected stop got %v", err)
+	}
+}
+
+func TestSplit(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	_, err := reader.Split(0)
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+
+	isEntry := map[uint32]bool{}
+	end := uint32(0)
+	for i := 0; i < 200; i++ {
+		off, next, err := fw.Append(bytes.Repeat([]byte("a"), (i*37)%500))
+		if err != nil {
+			t.Fatal(err)
+		}
+		isEntry[off] = true
+		end = next
+	}
+
+	for _, n := range []int{1, 3, 7, 1000} {
+		ranges, err := reader.Split(n)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(ranges) != n || ranges[0].Start != 0 || ranges[n-1].End != math.MaxUint32 {
+			t.Fatalf("unexpected ranges %v", ranges)
+		}
+		seen := map[uint32]int{}
+		for i, r := range ranges {
+			if i > 0 && (r.Start != ranges[i-1].End || (!isEntry[r.Start] && r.Start < end)) {
+				t.Fatalf("range %d does not start at entry %d", i, r.Start)
+			}
+			err := r.Scan(func(data []byte, offset, next uint32) error {
+				if offset < r.Start || offset >= r.End {
+					t.Fatalf("offset %d out of range %d %d", offset, r.Start, r.End)
+				}
+				seen[offset]++
+				return nil
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		if len(seen) != len(isEntry) {
+			t.Fatalf("expected %d entries got %d", len(isEntry), len(seen))
+		}
+		for off, c := range seen {
+			if c != 1 || !isEntry[off] {
+				t.Fatalf("offset %d seen %d times", off, c)
+			}
+		}
+	}
+}
+
+func TestMergeOrdered(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	var offsets []uint32
+	for i := 0; i < 300; i++ {
+		off, _, err := fw.Append([]byte(fmt.Sprintf("%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+
+	ranges, err := reader.Split(5)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var wg sync.WaitGroup
+	produce := func(ctx context.Context) []<-chan RangeResult[string] {
+		results := make([]<-chan RangeResult[string], len(ranges))
+		for i, r := range ranges {
+			c := make(chan RangeResult[string])
+			results[i] = c
+			wg.Add(1)
+			go func(r *RangeReader) {
+				defer wg.Done()
+				defer close(c)
+				_ = r.Scan(func(data []byte, offset, next uint32) error {
+					select {
+					case c <- RangeResult[string]{Offset: offset, Value: string(data)}:
+						return nil
+					case <-ctx.Done():
+						return ctx.Err()
+					}
+				})
+			}(r)
+		}
+		return results
+	}
+
+	i := 0
+	for v := range MergeOrdered(context.Background(), produce(context.Background())) {
+		if v.Offset != offsets[i] || v.Value != fmt.Sprintf("%d", i) {
+			t.Fatalf("expected %d at %d got %v", i, offsets[i], v)
+		}
+		i++
+	}
+	if i != len(offsets) {
+		t.Fatalf("expected %d results got %d", len(offsets), i)
+	}
+	wg.Wait()
+
+	// stop reading after 10 results, the merge and the producers exit after cancel
+	ctx, cancel := context.WithCancel(context.Background())
+	merged := MergeOrdered(ctx, produce(ctx))
+	for i := 0; i < 10; i++ {
+		<-merged
+	}
+	cancel()
+	for range merged {
+	}
+	wg.Wait()
+
+	for range MergeOrdered[int](context.Background(), nil) {
+		t.Fatal("expected no results")
+	}
+}
@@ -1,21 +1,120 @@
 package pen
 
 import (
+	"bytes"
 	"errors"
+	"fmt"
 	"io"
+	"math"
 	"os"
+	"sync"
+	"time"
 )
 
 var EBADSLT = errors.New("checksum mismatch")
 var EINVAL = errors.New("invalid argument")
 
+// returned when the entry at the end of the file is incomplete (e.g. the writer crashed in the middle of the write)
+var ErrTruncated = errors.New("truncated entry at the end of file")
+
+// Adds the offset to the errors of the underlying io.ReaderAt, errors.Is and errors.As still work with the original error.
+// io.EOF, EBADSLT, ErrTruncated and EINVAL are returned as they are, because they are the expected results of reading (callers compare them with ==),
+// ChecksumError has the offset of the corruption.
+func readError(offset uint32, err error) error {
+	switch err {
+	case nil, io.EOF, EBADSLT, ErrTruncated, EINVAL, ErrLargeEntry:
+		return err
+	case errReservedMagic:
+		return EBADSLT
+	}
+	return fmt.Errorf("pen: read at offset %d: %w", offset, err)
+}
+
+// checksum mismatch (EBADSLT) at specific offset, errors.Is(err, EBADSLT) is true for it
+// End is set if it is a corrupted region (e.g. from ScanCollectErrors), it is the offset after it.
+type ChecksumError struct {
+	Offset uint32
+	End    uint32
+}
+
+func (e ChecksumError) Error() string {
+	if e.End > e.Offset+1 {
+		return fmt.Sprintf("checksum mismatch at offsets %d-%d", e.Offset, e.End)
+	}
+	return fmt.Sprintf("checksum mismatch at offset %d", e.Offset)
+}
+
+func (e ChecksumError) Unwrap() error {
+	return EBADSLT
+}
+
 type Reader struct {
-	file      *os.File
+	// SetHighWater offset + 1, 0 if it is not set, first so it is 64 bit aligned for atomic on 32 bit platforms
+	highWater uint64
+
+	reader    io.ReaderAt
+	file      *os.File // nil if the reader is not a file
 	blockSize int
+	opts      ReaderOptions
+	cache     *entryCache // nil without CacheSize
+
+	// offsets of all entries, built lazily by Offsets and ScanReverseN
+	indexLock sync.Mutex
+	index     []uint32
+	indexNext uint32
+
+	// where the next Scrub starts
+	scrubOffset uint32
+}
+
+// Options for NewReaderWithOptions, the zero value is the same as NewReader
+type ReaderOptions struct {
+	// check the tail of the file when opening it, and if there is a torn entry or garbage after the last valid entry return ErrTruncated,
+	// use Reader.TailState() to find out how much to truncate
+	CheckTail bool
+
+	// used to allocate the data when it does not fit in the block (e.g. to use arena or a pool), the default is make([]byte, size)
+	// the returned slice must have at least size length
+	Alloc func(size int) []byte
+
+	// called with the buffers from Alloc that are not returned to the caller because of an error, the default is to do nothing
+	// the buffers returned by Read and Scan are owned by the caller, who is responsible to free them
+	Free func([]byte)
+
+	// do not check MAGIC, rely only on the header checksum (which still has to match over the header as it is, including the bytes where MAGIC should be)
+	// be careful, MAGIC is a cheap guard against reading random data, use this only for files that were written without it (e.g. legacy formats)
+	SkipMagic bool
+
+	// read fixed size records written with WriterOptions.FixedSize (the FixedWriteAt format), the offsets are record indexes instead of PAD units.
+	// Only Read, Scan, ScanWithOptions and the scan helpers built on Scan support it, Alloc and Free are not used.
+	FixedSize int
+
+	// keep LRU cache of the last CacheSize entries returned by Read, so the hot offsets are read without syscall, Scan does not use it.
+	// Read returns a copy of the cached data, check Reader.CacheStats for the hit rate.
+	CacheSize int
+
+	// called when ReadAt fails with error other than io.EOF (e.g. timeout of network storage), attempt starts from 1,
+	// if it returns true the read is retried after backoff, otherwise the error is returned, the default is to never retry
+	RetryPolicy func(attempt int, err error) (retry bool, backoff time.Duration)
+
+	// decode the entries written with WriterOptions.Transforms, it must have the same transforms in the same order as the writer,
+	// entries that need a transform that is not here fail with ErrUnknownTransform. It can not be combined with FixedSize.
+	Transforms []Transform
+
+	// read files where the data checksum is after the data instead of in the header (written in one pass by streaming writers),
+	// the entry is the 16 byte header (the data checksum field is ignored), the data, and 4 bytes LE uint32(Hash(data)),
+	// so the next offset is offset + (16 + len(data) + 4 + PAD - 1) / PAD. The whole file must use this layout, it can not be combined with FixedSize.
+	TrailingDataChecksum bool
+
+	// used by ScanOptions.VerifyPayload
+	skipPayloadChecksum bool
 }
 
+var defaultReaderOptions = ReaderOptions{Alloc: makeBytes}
+
 // Create New AppendReader (you just nice wrapper around ReadFromReader adn ScanFromReader)
-// it is *safe* to use it concurrently
+// it is *safe* to use it concurrently, also while the file is being appended to by a single Writer goroutine, Scan will not skip entries that were in the middle of being written
+// (with multiple goroutines appending, entries are allocated before they are written, so Scan can still skip an entry that is written after the one following it)
 // Example usage
 //	r, err := NewReader(filename, 4096)
 //	if err != nil {
@@ -36,6 +135,15 @@ type Reader struct {
 // You can reduce that to 1 syscall if your data fits within 1 block, do not set blockSize < 16 because this is the header length.
 // blockSize 0 means 16
 func NewReader(filename string, blockSize int) (*Reader, error) {
+	return NewReaderWithOptions(filename, blockSize, ReaderOptions{})
+}
+
+func NewReaderFromFile(fd *os.File, blockSize int) (*Reader, error) {
+	return NewReaderFromFileWithOptions(fd, blockSize, ReaderOptions{})
+}
+
+// Same as NewReader but with options
+func NewReaderWithOptions(filename string, blockSize int, opts ReaderOptions) (*Reader, error) {
 	if blockSize == 0 {
 		blockSize = 16
 	}
@@ -47,10 +155,16 @@ func NewReader(filename string, blockSize int) (*Reader, error) {
 	if err != nil {
 		return nil, err
 	}
-	return NewReaderFromFile(fd, blockSize)
+	r, err := NewReaderFromFileWithOptions(fd, blockSize, opts)
+	if err != nil {
+		fd.Close()
+		return nil, err
+	}
+	return r, nil
 }
 
-func NewReaderFromFile(fd *os.File, blockSize int) (*Reader, error) {
+// Same as NewReaderFromFile but with options
+func NewReaderFromFileWithOptions(fd *os.File, blockSize int, opts ReaderOptions) (*Reader, error) {
 	if blockSize == 0 {
 		blockSize = 16
 	}
@@ -58,52 +172,461 @@ func NewReaderFromFile(fd *os.File, blockSize int) (*Reader, error) {
 		return nil, EINVAL
 	}
 
-	return &Reader{
+	return newReader(fd, fd, blockSize, opts)
+}
+
+// Same as NewReaderFromFileWithOptions but for any io.ReaderAt (e.g. remote storage), the methods that need the size of the file
+// (TailState, IsEmpty..) work only if it has Size() int64 method (like bytes.Reader or io.SectionReader), and Close calls its Close if it has one.
+func NewReaderFromReaderAt(reader io.ReaderAt, blockSize int, opts ReaderOptions) (*Reader, error) {
+	if blockSize == 0 {
+		blockSize = 16
+	}
+	if blockSize < 16 {
+		return nil, EINVAL
+	}
+
+	return newReader(reader, nil, blockSize, opts)
+}
+
+func newReader(reader io.ReaderAt, fd *os.File, blockSize int, opts ReaderOptions) (*Reader, error) {
+	if opts.Alloc == nil {
+		opts.Alloc = makeBytes
+	}
+	if opts.CacheSize < 0 || len(opts.Transforms) > maxTransforms || (len(opts.Transforms) > 0 && opts.FixedSize > 0) || (opts.TrailingDataChecksum && opts.FixedSize > 0) {
+		return nil, EINVAL
+	}
+	r := &Reader{
+		reader:    reader,
 		file:      fd,
 		blockSize: blockSize,
-	}, nil
+		opts:      opts,
+	}
+	if opts.CacheSize > 0 {
+		r.cache = newEntryCache(opts.CacheSize)
+	}
+	if opts.RetryPolicy != nil {
+		r.reader = &retryReaderAt{r: reader, policy: opts.RetryPolicy}
+	}
+	if opts.CheckTail {
+		_, garbage, err := r.TailState()
+		if err != nil {
+			return nil, err
+		}
+		if garbage > 0 {
+			return nil, ErrTruncated
+		}
+	}
+	return r, nil
 }
 
 // Scan the open file, if the callback returns error this error is returned as the Scan error. just a wrapper around ScanFromReader.
+// The data passed to the callback is owned by the caller, it is safe to keep it after the callback returns.
 func (ar *Reader) Scan(offset uint32, cb func([]byte, uint32, uint32) error) error {
-	return ScanFromReader(ar.file, offset, ar.blockSize, cb)
+	return ar.scan(offset, ar.read, cb)
+}
+
+// Same as Scan, the data passed to the callback is always a fresh copy owned by the caller, so it is safe to retain it.
+// Use it instead of ScanNoCopy when the callback keeps references to the data.
+func (ar *Reader) ScanCopy(offset uint32, cb func([]byte, uint32, uint32) error) error {
+	return ar.Scan(offset, cb)
+}
+
+// Scan without allocating per entry, the header block and the data buffer are reused between the entries.
+// The data passed to the callback is *only valid during the callback*, it will be overwritten by the next entry, copy it if you need to keep it (or use ScanCopy).
+func (ar *Reader) ScanNoCopy(offset uint32, cb func([]byte, uint32, uint32) error) error {
+	block := make([]byte, ar.blockSize)
+	buf := []byte{}
+	opts := ar.opts
+	opts.Alloc = func(size int) []byte {
+		if cap(buf) < size {
+			buf = make([]byte, size)
+		}
+		return buf[:size]
+	}
+	opts.Free = nil
+
+	return ar.scan(offset, func(offset uint32) ([]byte, uint32, error) {
+		return ar.readEntryAt(offset, block, &opts)
+	}, cb)
+}
+
+// Same as Scan, but tells the kernel that the file will be read sequentially (posix_fadvise(POSIX_FADV_SEQUENTIAL)) so it can readahead more aggressively.
+// If dontNeed is true, after the scan the kernel is told that the scanned pages are not needed anymore (POSIX_FADV_DONTNEED), so a big scan does not pollute the page cache.
+// On platforms without fadvise it is just Scan.
+func (ar *Reader) ScanSequential(offset uint32, dontNeed bool, cb func([]byte, uint32, uint32) error) error {
+	if ar.file == nil {
+		return ar.Scan(offset, cb)
+	}
+
+	from := byteOffset(offset)
+	err := fadviseSequential(ar.file, from)
+	if err != nil {
+		return err
+	}
+
+	err = ar.Scan(offset, cb)
+	if dontNeed {
+		errAdvice := fadviseDontNeed(ar.file, from)
+		if err == nil {
+			err = errAdvice
+		}
+	}
+	return err
 }
 
 // Read at specific offset (just wrapper around ReadFromReader), returns the data, next readable offset and error
+// Reading at or after the end of the file (e.g. offset 0 of empty file) returns io.EOF, a valid empty entry returns non nil zero length data and nil error.
 func (ar *Reader) Read(offset uint32) ([]byte, uint32, error) {
-	return ReadFromReader(ar.file, offset, ar.blockSize)
+	if ar.cache != nil {
+		if data, next, ok := ar.cache.get(offset); ok {
+			if ar.afterHighWater(offset, next) {
+				return nil, 0, io.EOF
+			}
+			return data, next, nil
+		}
+	}
+	data, next, err := ar.read(offset)
+	if err != nil {
+		return nil, 0, readError(offset, err)
+	}
+	if ar.afterHighWater(offset, next) {
+		return nil, 0, io.EOF
+	}
+	if ar.cache == nil {
+		return data, next, nil
+	}
+	ar.cache.add(offset, next, append([]byte{}, data...))
+	return data, next, nil
+}
+
+// ReadFromReader using the reader options
+func (ar *Reader) read(offset uint32) ([]byte, uint32, error) {
+	if ar.opts.FixedSize > 0 {
+		return ar.readFixed(offset)
+	}
+	return ar.readEntryAt(offset, make([]byte, ar.blockSize), &ar.opts)
+}
+
+// read the entry at offset with opts, returns EBADSLT if the next offset does not move forward (corrupted length or offset overflow),
+// and gives the data allocated with opts.Alloc back to opts.Free then, as every other error does
+func (ar *Reader) readEntryAt(offset uint32, block []byte, opts *ReaderOptions) ([]byte, uint32, error) {
+	b, size, allocated, err := readEntry(ar.reader, uint64(byteOffset(offset)), block, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	next := nextOffsetSize(offset, size)
+	if next <= offset {
+		if allocated && opts.Free != nil {
+			opts.Free(b)
+		}
+		return nil, 0, EBADSLT
+	}
+	return b, next, nil
+}
+
+// Same as Read but uses the given block instead of allocating one, check ReadFromReaderWithBlock
+func (ar *Reader) ReadWithBlock(offset uint32, block []byte) ([]byte, uint32, error) {
+	return ReadFromReaderWithBlock(ar.reader, offset, block)
+}
+
+// Read the first valid entry at or after offset, skipping corrupted entries or padding the same way Scan does.
+// returns the data, the offset where the entry was found, the next readable offset and error (io.EOF if there are no valid entries until the end of the file)
+func (ar *Reader) ReadOrNext(offset uint32) ([]byte, uint32, uint32, error) {
+	var (
+		data        []byte
+		found, next uint32
+		ok          bool
+	)
+	err := ar.Scan(offset, func(d []byte, o, n uint32) error {
+		data, found, next, ok = d, o, n, true
+		return errStopScan
+	})
+	if err != nil && err != errStopScan {
+		return nil, 0, 0, err
+	}
+	if !ok {
+		return nil, 0, 0, io.EOF
+	}
+	return data, found, next, nil
+}
+
+// Same as Scan but starts from a byte position instead of an offset, the position must be a multiple of PAD, otherwise EINVAL is returned
+func (ar *Reader) ScanFromByte(bytePos int64, cb func([]byte, uint32, uint32) error) error {
+	offset, err := offsetFromByte(bytePos)
+	if err != nil {
+		return err
+	}
+	return ar.Scan(offset, cb)
+}
+
+// Same as Read but reads at byte position instead of an offset, the position must be a multiple of PAD, otherwise EINVAL is returned
+func (ar *Reader) ReadFromByte(bytePos int64) ([]byte, uint32, error) {
+	offset, err := offsetFromByte(bytePos)
+	if err != nil {
+		return nil, 0, err
+	}
+	return ar.Read(offset)
 }
 
 func (ar *Reader) Close() error {
-	return ar.file.Close()
+	if c, ok := ar.underlying().(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// the reader without the retry wrapper
+func (ar *Reader) underlying() io.ReaderAt {
+	if r, ok := ar.reader.(*retryReaderAt); ok {
+		return r.r
+	}
+	return ar.reader
+}
+
+// true if there are less than blockSize bytes from offset to the end of the file
+func (ar *Reader) inTail(offset uint32) bool {
+	n, _ := readFullAt(ar.reader, make([]byte, ar.blockSize), byteOffset(offset))
+	return n < ar.blockSize
+}
+
+// Returns true if the file has no bytes at all (the state of every new log), Scan on it returns nil without calling the callback and Read returns io.EOF.
+// It returns EINVAL if the size of the underlying reader is not known.
+func (ar *Reader) IsEmpty() (bool, error) {
+	size, err := ar.size()
+	if err != nil {
+		return false, err
+	}
+	return size == 0, nil
+}
+
+// size of the underlying file
+func (ar *Reader) size() (int64, error) {
+	if ar.file != nil {
+		s, err := ar.file.Stat()
+		if err != nil {
+			return 0, err
+		}
+		return s.Size(), nil
+	}
+	if s, ok := ar.underlying().(interface{ Size() int64 }); ok {
+		return s.Size(), nil
+	}
+	return 0, EINVAL
 }
 
 // Reads specific offset. returns data, nextOffset, error. You can
 // ReadFromReader(nextOffset) if you want to read the next document, or
 // use the Scan() helper
 func ReadFromReader(reader io.ReaderAt, offset uint32, blockSize int) ([]byte, uint32, error) {
-	b, err := ReadFromReader64(reader, uint64(offset*PAD), blockSize)
+	b, size, err := readEntry64(reader, uint64(byteOffset(offset)), make([]byte, blockSize), &defaultReaderOptions)
 	if err != nil {
-		return nil, 0, err
+		return nil, 0, readError(offset, err)
+	}
+	return b, nextOffsetSize(offset, size), nil
+}
+
+// position in bytes of the offset, computed in 64 bit so it does not overflow for files bigger than 4gb
+func byteOffset(offset uint32) int64 {
+	return int64(offset) * int64(PAD)
+}
+
+// offset of the entry at the given byte position, returns EINVAL if it is not PAD aligned or out of the 32 bit offset range
+func offsetFromByte(bytePos int64) (uint32, error) {
+	if bytePos < 0 || bytePos%int64(PAD) != 0 || bytePos/int64(PAD) > math.MaxUint32 {
+		return 0, EINVAL
+	}
+	return uint32(bytePos / int64(PAD)), nil
+}
+
+// Same as ReadFromReader, but instead of allocating a new block for every read it uses the given one (len(block) is the blockSize), so it can be reused between reads.
+// If the data fits in the block, the returned data is a slice of the block (valid only until the block is reused) and the read does not allocate at all,
+// otherwise new slice is allocated for the data.
+func ReadFromReaderWithBlock(reader io.ReaderAt, offset uint32, block []byte) ([]byte, uint32, error) {
+	if len(block) < 16 {
+		return nil, 0, EINVAL
+	}
+	b, size, err := readEntry64(reader, uint64(byteOffset(offset)), block, &defaultReaderOptions)
+	if err != nil {
+		return nil, 0, readError(offset, err)
+	}
+	return b, nextOffsetSize(offset, size), nil
+}
+
+// Same as ReadFromReader, but also returns the raw block that was read (the header is block[:16]), for callers that parse the header themselves.
+// The block is the whole read buffer of blockSize bytes (zero after the end of the file), if the data fits in it, payload is a slice of block
+// (payload = block[16:16+len(payload)]), otherwise payload is read into a separate slice and block contains only its beginning.
+func ReadBlock(reader io.ReaderAt, offset uint32, blockSize int) ([]byte, []byte, uint32, error) {
+	block := make([]byte, blockSize)
+	payload, next, err := ReadFromReaderWithBlock(reader, offset, block)
+	if err != nil {
+		return nil, nil, 0, err
 	}
-	nextOffset := (offset + ((uint32(16+len(b)))+PAD-1)/PAD)
-	return b, uint32(nextOffset), nil
+	return block, payload, next, nil
+}
+
+// offset of the entry after the one at offset with data of the given length
+func nextOffset(offset uint32, dataLen int) uint32 {
+	return nextOffsetSize(offset, 16+dataLen)
+}
+
+// offset of the entry after the one at offset with the given size (header and data)
+func nextOffsetSize(offset uint32, size int) uint32 {
+	return offset + (uint32(size)+PAD-1)/PAD
 }
 
 // Scan ReaderAt, if the callback returns error this error is returned as the Scan error
 func ScanFromReader(reader io.ReaderAt, offset uint32, blockSize int, cb func([]byte, uint32, uint32) error) error {
+	return readerAt(reader, blockSize).Scan(offset, cb)
+}
+
+// Reader with the default options over io.ReaderAt, used by the *FromReader functions
+func readerAt(reader io.ReaderAt, blockSize int) *Reader {
+	return &Reader{reader: reader, blockSize: blockSize, opts: defaultReaderOptions}
+}
+
+// the scan loop, read is called for every offset, corrupted entries are skipped
+// incomplete entry at the end of the file (ErrTruncated) is treated as end of file
+func (ar *Reader) scan(offset uint32, read func(uint32) ([]byte, uint32, error), cb func([]byte, uint32, uint32) error) error {
+	return ar.scanWithOptions(offset, ScanOptions{}, read, cb)
+}
+
+func (ar *Reader) scanWithOptions(offset uint32, opts ScanOptions, read func(uint32) ([]byte, uint32, error), cb func([]byte, uint32, uint32) error) error {
+	progress := func(uint32, bool) {}
+	if opts.Progress != nil {
+		progress = ar.progressReporter(opts.Progress)
+		// the last call is on every way the scan ends, with the offset where it stopped
+		defer func() {
+			progress(offset, true)
+		}()
+	}
+	skipping := false
+	skippedFrom := uint32(0)
+	// the data region of the file (not sparse file hole) is known to continue until dataEnd
+	dataEnd := int64(0)
+	skipped := func(end uint32) {
+		if skipping && opts.onSkip != nil {
+			opts.onSkip(skippedFrom, end)
+		}
+	}
 	for {
-		data, next, err := ReadFromReader(reader, offset, blockSize)
-		if err == io.EOF {
+		progress(offset, false)
+		if ar.afterHighWater(offset, offset) {
+			// do not resync through the entries that are still being written
+			skipped(offset)
+			return nil
+		}
+		data, next, err := read(offset)
+		if err == io.EOF || (err == nil && ar.afterHighWater(offset, next)) {
+			skipped(offset)
+			if err == io.EOF && skipping && opts.ReportTruncated {
+				// the file ends with garbage (e.g. torn entry longer than the header), same as TailState
+				return ErrTruncated
+			}
 			return nil
 		}
+		if err == ErrTruncated {
+			skipped(offset)
+			if opts.ReportTruncated {
+				return ErrTruncated
+			}
+			return nil
+		}
+		if err == ErrLargeEntry {
+			// valid entry, just too big to be delivered
+			_, _, next, lerr := readLargeHeader(ar.reader, offset)
+			if lerr == nil {
+				skipped(offset)
+				skipping = false
+				if opts.OnLargeEntry != nil {
+					err = opts.OnLargeEntry(offset, next)
+					if err != nil {
+						return err
+					}
+				}
+				offset = next
+				continue
+			}
+			err = EBADSLT
+		}
+		if err == nil && next <= offset {
+			// next must always move forward, otherwise corrupted length (or offset overflow) would make us loop forever
+			err = EBADSLT
+		}
+		if err == errReservedMagic {
+			// the schema and the file crc trailer are valid entries, just not for Scan, the read already checked the magic
+			// so only the offsets that can be reserved entries are read again
+			err = EBADSLT
+			data, magic, next, err := ar.readReserved(offset)
+			if err == nil {
+				skipped(offset)
+				skipping = false
+				if opts.IncludeSchema && bytes.Equal(magic, SCHEMA_MAGIC) {
+					err = cb(data, offset, next)
+					if err != nil {
+						return err
+					}
+				}
+				offset = next
+				continue
+			}
+		}
 		if err == EBADSLT {
 			// assume corrupted file, so just skip until we find next valid entry
+			if !skipping {
+				skipping = true
+				skippedFrom = offset
+			}
+			if offset == math.MaxUint32 {
+				// no more addressable offsets
+				skipped(offset)
+				return nil
+			}
+			if opts.StopOnTailCorruption && ar.inTail(offset) {
+				skipped(offset)
+				return nil
+			}
+			if ar.file != nil && ar.opts.FixedSize == 0 && byteOffset(offset) >= dataEnd {
+				// resyncing one PAD at a time through hole of sparse file would read gigabytes of zeros, so jump to the next data
+				start, end, err := nextData(ar.file, byteOffset(offset))
+				if err == io.EOF {
+					skipped(offset)
+					if opts.ReportTruncated {
+						return ErrTruncated
+					}
+					return nil
+				}
+				dataEnd = end
+				if start/int64(PAD) > int64(offset) && start/int64(PAD) <= math.MaxUint32 {
+					offset = uint32(start / int64(PAD))
+					continue
+				}
+			}
 			offset++
 			continue
 		}
 		if err != nil {
-			return err
+			return readError(offset, err)
+		}
+		if skipping {
+			// the entry we skipped could have been in the middle of being written when we read it (the file is being appended to while we scan),
+			// now that there is a valid entry after it, check it once more, so we do not miss it
+			_, skippedNext, err := read(skippedFrom)
+			if err == nil && skippedNext > skippedFrom {
+				skipping = false
+				offset = skippedFrom
+				continue
+			}
+			skipped(offset)
+			skipping = false
+			// ScanNoCopy reads every entry into the same buffers, so the check overwrote the data of this one
+			data, next, err = read(offset)
+			if err != nil {
+				return readError(offset, err)
+			}
+		}
+		if opts.SkipEmpty && len(data) == 0 {
+			offset = next
+			continue
 		}
 		err = cb(data, offset, next)
 		if err != nil {
@@ -2,14 +2,20 @@ package pen
 
 import (
 	"bytes"
+	"context"
+	"encoding/binary"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"math/rand"
 	"os"
 	"path"
 	"sync/atomic"
 	"testing"
+	"time"
 )
 
 var letterRunes = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ")
@@ -418,3 +424,1071 @@ func TestReaderBadArgs(t *testing.T) {
 		panic(err)
 	}
 }
+
+func TestScanSequential(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "forward")
+	fw, err := NewWriter(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+	reader, err := NewReader(fn, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	for _, dontNeed := range []bool{false, true} {
+		for i := 0; i < 100; i++ {
+			_, _, err := fw.Append([]byte(RandStringRunes(i)))
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+		n := 0
+		err = reader.ScanSequential(0, dontNeed, func(data []byte, offset, next uint32) error {
+			n++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if dontNeed && n != 200 || !dontNeed && n != 100 {
+			t.Fatalf("unexpected count %d", n)
+		}
+	}
+}
+
+func benchmarkScan(b *testing.B, scan func(r *Reader, cb func([]byte, uint32, uint32) error) error) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "forward")
+	fw, err := NewWriter(fn)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer fw.Close()
+	data := make([]byte, 4096)
+	for i := 0; i < 16384; i++ {
+		_, _, err := fw.Append(data)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	reader, err := NewReader(fn, 4096+16)
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer reader.Close()
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		err = scan(reader, func(data []byte, offset, next uint32) error {
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScan(b *testing.B) {
+	benchmarkScan(b, func(r *Reader, cb func([]byte, uint32, uint32) error) error {
+		return r.Scan(0, cb)
+	})
+}
+
+func BenchmarkScanSequential(b *testing.B) {
+	benchmarkScan(b, func(r *Reader, cb func([]byte, uint32, uint32) error) error {
+		return r.ScanSequential(0, true, cb)
+	})
+}
+
+func TestScanNoCopy(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "forward")
+	fw, err := NewWriter(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+	reader, err := NewReader(fn, 64)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	expected := [][]byte{}
+	for i := 0; i < 1000; i++ {
+		data := []byte(RandStringRunes(i))
+		_, _, err := fw.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, data)
+	}
+
+	copied := [][]byte{}
+	err = reader.ScanCopy(0, func(data []byte, offset, next uint32) error {
+		copied = append(copied, data)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	n := 0
+	err = reader.ScanNoCopy(0, func(data []byte, offset, next uint32) error {
+		if !bytes.Equal(data, expected[n]) {
+			t.Fatalf("data mismatch at %d", n)
+		}
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(expected) || len(copied) != len(expected) {
+		t.Fatalf("expected %d got %d and %d", len(expected), n, len(copied))
+	}
+	for i := range expected {
+		if !bytes.Equal(copied[i], expected[i]) {
+			t.Fatalf("data mismatch at %d", i)
+		}
+	}
+}
+
+func TestWriterOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "forward")
+
+	w, err := NewWriterWithOptions(fn, WriterOptions{FileMode: 0640, Exclusive: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+	st, err := os.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if st.Mode().Perm() != 0640 {
+		t.Fatalf("expected 0640 got %v", st.Mode().Perm())
+	}
+
+	_, err = NewWriterWithOptions(fn, WriterOptions{Exclusive: true})
+	if !os.IsExist(err) {
+		t.Fatalf("expected exist error, got %v", err)
+	}
+
+	// leave unaligned garbage at the end
+	err = ioutil.WriteFile(fn, []byte("garbage"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w, err = NewWriterWithOptions(fn, WriterOptions{OpenFlags: os.O_APPEND})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	reader, err := NewReader(fn, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	offsets := []uint32{}
+	for i := 1; i < 100; i++ {
+		off, next, err := w.Append([]byte(RandStringRunes(i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		st, err := os.Stat(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Size() != int64(next*PAD) {
+			t.Fatalf("expected size %d got %d", next*PAD, st.Size())
+		}
+		offsets = append(offsets, off)
+	}
+	for _, off := range offsets {
+		_, _, err := reader.Read(off)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	err = w.Overwrite(offsets[0], []byte("a"))
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+}
+
+func TestReadFromByte(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "forward")
+	fw, err := NewWriter(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+	reader, err := NewReader(fn, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	for i := 0; i < 10; i++ {
+		_, _, err := fw.Append([]byte(RandStringRunes(i * 10)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	off, _, err := fw.Append([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, _, err := reader.ReadFromByte(int64(off) * int64(PAD))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("expected hello got %s", data)
+	}
+
+	n := 0
+	err = reader.ScanFromByte(int64(off)*int64(PAD), func(data []byte, offset, next uint32) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 1 {
+		t.Fatalf("expected 1 got %d", n)
+	}
+
+	for _, bad := range []int64{-int64(PAD), int64(PAD) + 1, int64(PAD) * (math.MaxUint32 + 1)} {
+		_, _, err = reader.ReadFromByte(bad)
+		if err != EINVAL {
+			t.Fatalf("%d: expected EINVAL got %v", bad, err)
+		}
+		err = reader.ScanFromByte(bad, func(data []byte, offset, next uint32) error {
+			return nil
+		})
+		if err != EINVAL {
+			t.Fatalf("%d: expected EINVAL got %v", bad, err)
+		}
+	}
+}
+
+func TestReadOrNext(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	first, _, err := fw.Append(make([]byte, 200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	second, secondNext, err := fw.Append([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// make the first entry look shorter, so there is garbage between the entries
+	err = fw.Overwrite(first, []byte("a"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	data, found, next, err := reader.ReadOrNext(first + 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" || found != second || next != secondNext {
+		t.Fatalf("unexpected %s %d %d", data, found, next)
+	}
+
+	data, found, _, err = reader.ReadOrNext(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "a" || found != first {
+		t.Fatalf("unexpected %s %d", data, found)
+	}
+
+	_, _, _, err = reader.ReadOrNext(secondNext)
+	if err != io.EOF {
+		t.Fatalf("expected EOF got %v", err)
+	}
+}
+
+func TestReadWithBlock(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	block := make([]byte, 64)
+	_, _, err := reader.ReadWithBlock(0, block[:15])
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+
+	for i := 0; i < 100; i++ {
+		data := []byte(RandStringRunes(i))
+		off, next, err := fw.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, rnext, err := reader.ReadWithBlock(off, block)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(r, data) || rnext != next {
+			t.Fatalf("mismatch at %d", i)
+		}
+	}
+
+	off, _, err := fw.Append(make([]byte, 48))
+	if err != nil {
+		t.Fatal(err)
+	}
+	allocs := testing.AllocsPerRun(100, func() {
+		_, _, err := reader.ReadWithBlock(off, block)
+		if err != nil {
+			t.Fatal(err)
+		}
+	})
+	if allocs != 0 {
+		t.Fatalf("expected 0 allocations got %v", allocs)
+	}
+}
+
+func benchmarkRead(b *testing.B, size int) {
+	fw, reader, done := newTestWriterReader(b, 0)
+	defer done()
+	off, _, err := fw.Append(make([]byte, size))
+	if err != nil {
+		b.Fatal(err)
+	}
+	block := make([]byte, 4096)
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		_, _, err := reader.ReadWithBlock(off, block)
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+// data fits in the block, one syscall and no allocations
+func BenchmarkReadInBlock(b *testing.B) {
+	benchmarkRead(b, 4096-16)
+}
+
+// data does not fit in the block, two syscalls and the data is allocated
+func BenchmarkReadSpanning(b *testing.B) {
+	benchmarkRead(b, 4096*2)
+}
+
+func TestReaderAlloc(t *testing.T) {
+	fw, r, done := newTestWriterReader(t, 0)
+	defer done()
+
+	allocated := 0
+	freed := 0
+	reader, err := NewReaderWithOptions(r.file.Name(), 32, ReaderOptions{
+		Alloc: func(size int) []byte {
+			allocated++
+			return make([]byte, size, size*2)
+		},
+		Free: func(b []byte) {
+			freed++
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	small, _, err := fw.Append([]byte("small"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	big, _, err := fw.Append(make([]byte, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = reader.Read(small)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocated != 0 {
+		t.Fatalf("expected no allocation got %d", allocated)
+	}
+
+	data, _, err := reader.Read(big)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if allocated != 1 || len(data) != 100 || freed != 0 {
+		t.Fatalf("unexpected allocated %d freed %d len %d", allocated, freed, len(data))
+	}
+
+	// corrupt the data, so the allocated buffer is freed
+	_, err = fw.file.WriteAt([]byte{1}, byteOffset(big)+50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = reader.Read(big)
+	if err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+	if allocated != 2 || freed != 1 {
+		t.Fatalf("unexpected allocated %d freed %d", allocated, freed)
+	}
+}
+
+// every period bytes there is the same blob
+type repeatReaderAt struct {
+	blob   []byte
+	period int64
+}
+
+func (r repeatReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	for i := range p {
+		pos := (off + int64(i)) % r.period
+		if pos < int64(len(r.blob)) {
+			p[i] = r.blob[pos]
+		} else {
+			p[i] = 0
+		}
+	}
+	return len(p), nil
+}
+
+func TestScanNextMustAdvance(t *testing.T) {
+	blob := bytes.NewBuffer(nil)
+	err := WriteAtWriter64(&writerAtBuffer{blob}, 0, make([]byte, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// valid entry at math.MaxUint32-1, its next offset overflows and wraps to the beginning
+	reader := repeatReaderAt{blob: blob.Bytes(), period: int64(PAD) * 2}
+	n := 0
+	err = ScanFromReader(reader, math.MaxUint32-1, 16, func(data []byte, offset, next uint32) error {
+		n++
+		if n > 10 {
+			t.Fatalf("scan is looping, offset %d next %d", offset, next)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Fatalf("expected 0 got %d", n)
+	}
+
+	// the data that does not fit in the block is allocated, and must be freed when the entry is rejected
+	allocated := 0
+	freed := 0
+	r, err := NewReaderFromReaderAt(reader, 16, ReaderOptions{
+		Alloc: func(size int) []byte {
+			allocated++
+			return make([]byte, size)
+		},
+		Free: func(b []byte) {
+			freed++
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := r.Read(math.MaxUint32 - 1); err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+	err = r.Scan(math.MaxUint32-1, func(data []byte, offset, next uint32) error {
+		return nil
+	})
+	if err != nil || allocated == 0 || freed != allocated {
+		t.Fatalf("unexpected allocated %d freed %d %v", allocated, freed, err)
+	}
+}
+
+type writerAtBuffer struct {
+	b *bytes.Buffer
+}
+
+func (w *writerAtBuffer) WriteAt(p []byte, off int64) (int, error) {
+	return w.b.Write(p)
+}
+
+// returns at most max bytes per ReadAt without error
+type shortReaderAt struct {
+	r   io.ReaderAt
+	max int
+}
+
+func (s shortReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if len(p) > s.max {
+		p = p[:s.max]
+	}
+	n, err := s.r.ReadAt(p, off)
+	if err == io.EOF && n > 0 {
+		err = nil
+	}
+	return n, err
+}
+
+func TestShortReaderAt(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	expected := [][]byte{}
+	for i := 0; i < 100; i++ {
+		data := []byte(RandStringRunes(i * 3))
+		_, _, err := fw.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, data)
+	}
+
+	for _, blockSize := range []int{16, 64, 4096} {
+		n := 0
+		err := ScanFromReader(shortReaderAt{r: reader.file, max: 7}, 0, blockSize, func(data []byte, offset, next uint32) error {
+			if !bytes.Equal(data, expected[n]) {
+				t.Fatalf("data mismatch at %d", n)
+			}
+			n++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != len(expected) {
+			t.Fatalf("expected %d got %d", len(expected), n)
+		}
+	}
+}
+
+func TestReaderSkipMagic(t *testing.T) {
+	fw, r, done := newTestWriterReader(t, 0)
+	defer done()
+
+	// legacy entry with zeroed magic, but valid header checksum
+	data := []byte("legacy")
+	blob := make([]byte, 16+len(data))
+	copy(blob[16:], data)
+	binary.LittleEndian.PutUint32(blob[0:], uint32(len(data)))
+	binary.LittleEndian.PutUint32(blob[4:], uint32(Hash(data)))
+	binary.LittleEndian.PutUint32(blob[12:], uint32(Hash(blob[:12])))
+	_, err := fw.file.WriteAt(blob, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, _, err = r.Read(0)
+	if err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+
+	reader, err := NewReaderWithOptions(r.file.Name(), 0, ReaderOptions{SkipMagic: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	read, _, err := reader.Read(0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(read, data) {
+		t.Fatalf("expected %s got %s", data, read)
+	}
+
+	// the header checksum still has to match
+	_, err = fw.file.WriteAt([]byte{1}, 8)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = reader.Read(0)
+	if err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+}
+
+func TestAppendContext(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	off, next, err := fw.AppendContext(context.Background(), []byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, n, err := reader.Read(off)
+	if err != nil || string(data) != "hello" || n != next {
+		t.Fatalf("unexpected %s %d %v", data, n, err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, _, err = fw.AppendContext(ctx, []byte("world"))
+	if err != context.Canceled {
+		t.Fatalf("expected context.Canceled got %v", err)
+	}
+	// nothing was written
+	off, _, err = fw.Append([]byte("world"))
+	if err != nil || off != next {
+		t.Fatalf("unexpected %d %v", off, err)
+	}
+}
+
+func TestWriterLock(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "forward")
+
+	w, err := NewWriterWithOptions(fn, WriterOptions{Lock: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = NewWriterWithOptions(fn, WriterOptions{Lock: true})
+	if err != ErrLocked {
+		t.Fatalf("expected ErrLocked got %v", err)
+	}
+	w.Close()
+
+	w, err = NewWriterWithOptions(fn, WriterOptions{Lock: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+}
+
+func TestReadBlock(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	small, _, err := fw.Append([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	big, _, err := fw.Append(bytes.Repeat([]byte("a"), 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	block, payload, next, err := ReadBlock(reader.file, small, 64)
+	if err != nil || string(payload) != "hello" || next != big || len(block) != 64 {
+		t.Fatalf("unexpected %q %d %v", payload, next, err)
+	}
+	h, ok := ParseHeader(block)
+	if !ok || h.Length != 5 {
+		t.Fatalf("unexpected header %s", h)
+	}
+	// aliased
+	block[16] = 'j'
+	if string(payload) != "jello" {
+		t.Fatalf("expected payload to alias block, got %q", payload)
+	}
+
+	block, payload, _, err = ReadBlock(reader.file, big, 64)
+	if err != nil || len(payload) != 100 || len(block) != 64 {
+		t.Fatalf("unexpected %d %v", len(payload), err)
+	}
+	block[16] = 'b'
+	if payload[0] != 'a' {
+		t.Fatal("expected separate payload for spanning entry")
+	}
+
+	_, _, _, err = ReadBlock(reader.file, small, 15)
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+}
+
+func TestWriterOnAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "forward")
+
+	onAppend := func(data []byte, offset, next uint32) error { return nil }
+	if _, err := NewWriterWithOptions(fn, WriterOptions{GroupCommitWindow: time.Millisecond, OnAppend: onAppend}); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+
+	for _, opts := range []WriterOptions{{}, {OpenFlags: os.O_APPEND}} {
+		os.Remove(fn)
+		index := map[string]uint32{}
+		var w *Writer
+		opts.OnAppend = func(data []byte, offset, next uint32) error {
+			// the hook sees only the entries that are on disk
+			if w.DurableOffset() < next {
+				t.Errorf("%s: durable %d before %d", data, w.DurableOffset(), next)
+			}
+			if string(data) == "bad" {
+				return EINVAL
+			}
+			index[string(data)] = offset
+			return nil
+		}
+		w, err = NewWriterWithOptions(fn, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		off, _, err := w.Append([]byte("a"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, _, err = w.Append([]byte("bad"))
+		if err != EINVAL {
+			t.Fatalf("expected EINVAL got %v", err)
+		}
+		next, _, err := w.Append([]byte("b"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next != off+1 || index["a"] != off || index["b"] != next || len(index) != 2 {
+			t.Fatalf("unexpected %d %d %v", off, next, index)
+		}
+		w.Close()
+
+		r, err := NewReader(fn, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		entries := []string{}
+		err = r.Scan(0, func(data []byte, offset, next uint32) error {
+			entries = append(entries, string(data))
+			return nil
+		})
+		r.Close()
+		if err != nil || fmt.Sprintf("%v", entries) != "[a b]" {
+			t.Fatalf("unexpected %v %v", entries, err)
+		}
+	}
+}
+
+// fails every ReadAt with odd call number
+type flakyReaderAt struct {
+	r     io.ReaderAt
+	calls int
+}
+
+var errFlaky = errors.New("flaky")
+
+func (f *flakyReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	f.calls++
+	if f.calls%2 == 1 {
+		return 0, errFlaky
+	}
+	return f.r.ReadAt(p, off)
+}
+
+func TestReaderRetryPolicy(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	for i := 0; i < 10; i++ {
+		_, _, err := fw.Append([]byte(RandStringRunes(i * 10)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	r, err := NewReaderFromReaderAt(&flakyReaderAt{r: reader.file}, 0, ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = r.Scan(0, func(data []byte, offset, next uint32) error {
+		return nil
+	})
+	if !errors.Is(err, errFlaky) {
+		t.Fatalf("expected errFlaky got %v", err)
+	}
+
+	attempts := 0
+	r, err = NewReaderFromReaderAt(&flakyReaderAt{r: reader.file}, 0, ReaderOptions{RetryPolicy: func(attempt int, err error) (bool, time.Duration) {
+		if err != errFlaky || attempt != 1 {
+			t.Fatalf("unexpected %d %v", attempt, err)
+		}
+		attempts++
+		return true, time.Microsecond
+	}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	err = r.Scan(0, func(data []byte, offset, next uint32) error {
+		if len(data) != n*10 {
+			t.Fatalf("unexpected data at %d", n)
+		}
+		n++
+		return nil
+	})
+	if err != nil || n != 10 || attempts == 0 {
+		t.Fatalf("unexpected %d %d %v", n, attempts, err)
+	}
+}
+
+func TestReadErrorWrapping(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	off, _, err := fw.Append([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	off, _, err = fw.Append([]byte("world"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	flaky := &flakyReaderAt{r: reader.file}
+	_, _, err = ReadFromReader(flaky, off, 16)
+	if !errors.Is(err, errFlaky) || err.Error() != fmt.Sprintf("pen: read at offset %d: flaky", off) {
+		t.Fatalf("unexpected %v", err)
+	}
+	r, err := NewReaderFromReaderAt(flaky, 0, ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	flaky.calls = 0
+	_, _, err = r.Read(off)
+	if !errors.Is(err, errFlaky) || err.Error() != fmt.Sprintf("pen: read at offset %d: flaky", off) {
+		t.Fatalf("unexpected %v", err)
+	}
+
+	// the expected results are not wrapped
+	_, _, err = reader.Read(off + 10)
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF got %v", err)
+	}
+	_, err = fw.file.WriteAt([]byte("j"), 16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, _, err = ReadFromReader(reader.file, 0, 16)
+	if err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+}
+
+func TestEmptyEntries(t *testing.T) {
+	for _, blockSize := range []int{16, 64, 4096} {
+		fw, reader, done := newTestWriterReader(t, blockSize)
+
+		entries := [][]byte{nil, []byte("a"), {}, nil, []byte("bb"), {}}
+		offsets := []uint32{}
+		for _, e := range entries {
+			off, _, err := fw.Append(e)
+			if err != nil {
+				t.Fatal(err)
+			}
+			offsets = append(offsets, off)
+		}
+
+		header := make([]byte, 16)
+		for i, off := range offsets {
+			_, err := reader.file.ReadAt(header, byteOffset(off))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(entries[i]) == 0 && (binary.LittleEndian.Uint32(header) != 0 || binary.LittleEndian.Uint32(header[4:]) != uint32(Hash(nil))) {
+				t.Fatalf("unexpected header of empty entry %d: %x", i, header)
+			}
+			data, _, err := reader.Read(off)
+			if err != nil {
+				t.Fatalf("entry %d: %v", i, err)
+			}
+			if !bytes.Equal(data, entries[i]) {
+				t.Fatalf("entry %d: expected %q got %q", i, entries[i], data)
+			}
+		}
+
+		n := 0
+		err := reader.Scan(0, func(data []byte, offset, next uint32) error {
+			if offset != offsets[n] || !bytes.Equal(data, entries[n]) {
+				t.Fatalf("entry %d: unexpected %q at %d", n, data, offset)
+			}
+			n++
+			return nil
+		})
+		if err != nil || n != len(entries) {
+			t.Fatalf("scanned %d err %v", n, err)
+		}
+
+		// the last empty entry is just the header
+		st, err := reader.file.Stat()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if st.Size() != byteOffset(offsets[len(offsets)-1])+16 {
+			t.Fatalf("unexpected size %d", st.Size())
+		}
+		done()
+	}
+}
+
+func TestAppendWithInfo(t *testing.T) {
+	dir, err := ioutil.TempDir("", "info")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	data := []byte("hello world")
+	for i, opts := range []WriterOptions{{}, {Transforms: []Transform{xorTransform(0x5a)}}, {CompactHeader: true}, {FixedSize: len(data)}} {
+		fn := path.Join(dir, fmt.Sprintf("info%d", i))
+		fw, err := NewWriterWithOptions(fn, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, next, err := fw.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r, err := fw.AppendWithInfo(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if r.Length != uint32(len(data)) || r.Offset != next || r.Next <= r.Offset {
+			t.Fatalf("unexpected result %+v", r)
+		}
+		expected := uint32(Hash(data))
+		if len(opts.Transforms) > 0 {
+			reader, err := NewReader(fn, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// the checksum of the stored (xored) data
+			expected, _, err = reader.PayloadChecksum(r.Offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader.Close()
+			if expected == uint32(Hash(data)) {
+				t.Fatal("expected checksum of the encoded data")
+			}
+		}
+		if r.DataChecksum != expected {
+			t.Fatalf("options %d: expected checksum %x got %x", i, expected, r.DataChecksum)
+		}
+		if _, err := fw.AppendWithInfo(make([]byte, 3)); opts.FixedSize > 0 && err != EINVAL {
+			t.Fatalf("expected EINVAL got %v", err)
+		}
+		fw.Close()
+	}
+}
+
+func TestPadByte(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pad")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, opts := range []WriterOptions{{PadByte: 0xfe}, {PadByte: 0xfe, OpenFlags: os.O_APPEND}, {PadByte: 0xfe, FileCRC: true}, {PadByte: 0xfe, MultiProcess: true}} {
+		fn := path.Join(dir, fmt.Sprintf("pad%d", i))
+		fw, err := NewWriterWithOptions(fn, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := [][]byte{}
+		ends := map[int64]int64{}
+		for j := 0; j < 20; j++ {
+			data := []byte(RandStringRunes(j * 13))
+			off, next, err := fw.Append(data)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected, data)
+			ends[byteOffset(off)+16+int64(len(data))] = byteOffset(next)
+		}
+		batch := [][]byte{[]byte("a"), []byte("bb")}
+		if !opts.MultiProcess {
+			offsets, err := fw.AppendBatch(batch)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for k, off := range offsets {
+				ends[byteOffset(off)+16+int64(len(batch[k]))] = byteOffset(off + 1)
+			}
+			expected = append(expected, batch...)
+		}
+		fw.Close()
+
+		file, err := ioutil.ReadFile(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// the file crc trailer is after the padding
+		if len(file)%int(PAD) != 0 && !opts.FileCRC {
+			t.Fatalf("options %d: size %d is not padded", i, len(file))
+		}
+		for start, end := range ends {
+			for p := start; p < end; p++ {
+				if file[p] != 0xfe {
+					t.Fatalf("options %d: byte %d is %x", i, p, file[p])
+				}
+			}
+		}
+
+		reader, err := NewReader(fn, 64)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if opts.FileCRC {
+			if err := reader.VerifyFileCRC(); err != nil {
+				t.Fatal(err)
+			}
+		}
+		// corrupt the second entry, the scan resyncs over its padding
+		corrupted := append([]byte{}, file...)
+		corrupted[int(PAD)+20] ^= 0xff
+		if err := ioutil.WriteFile(fn, corrupted, 0600); err != nil {
+			t.Fatal(err)
+		}
+		got := [][]byte{}
+		err = reader.Scan(0, func(data []byte, offset, next uint32) error {
+			got = append(got, data)
+			return nil
+		})
+		if err != nil || len(got) != len(expected)-1 || !bytes.Equal(got[0], expected[0]) || !bytes.Equal(got[1], expected[2]) || !bytes.Equal(got[len(got)-1], expected[len(expected)-1]) {
+			t.Fatalf("options %d: unexpected scan %d %v", i, len(got), err)
+		}
+		reader.Close()
+	}
+}
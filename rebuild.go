@@ -0,0 +1,136 @@
+package pen
+
+import (
+	"io"
+	"os"
+	"sync/atomic"
+)
+
+// magic of the padding entries written by Rebuild to align the entries to the block size, Scan skips them
+var PADDING_MAGIC = []byte{0xa, 0x1, 0x9, 0x0}
+
+// Average amount of dstBlock sized (and aligned) blocks touched by reading one entry, before and after Rebuild
+type RebuildStats struct {
+	Entries      int
+	BlocksBefore float64
+	BlocksAfter  float64
+
+	// the schema (Writer.SetSchema) was copied, it is the first entry of dst as well
+	Schema bool
+
+	// large entries (Writer.AppendFrom) streamed to dst, they are bigger than any block, so they are not in Entries and the averages
+	LargeEntries int
+}
+
+// Rewrite src into new file dst (it must not exist), placing every entry that fits in dstBlock so it does not cross dstBlock boundary,
+// so reading it with NewReader(dst, dstBlock) touches only one block (e.g. one page with 4096). The space before the moved entries is
+// filled with padding entries (PADDING_MAGIC) that Scan skips. Corrupted entries in src are skipped, and the offsets are different in dst,
+// so any external index must be rebuilt as well. srcBlock is the blockSize used to read src, dstBlock must be multiple of PAD.
+// The schema is copied first, and the large entries are streamed with WriteEntryTo and AppendFrom without reading them to memory
+// (a corrupted one is removed from dst again). The file crc trailer of src is not copied, dst is written without WriterOptions.FileCRC.
+func Rebuild(src, dst string, srcBlock, dstBlock int) (RebuildStats, error) {
+	stats := RebuildStats{}
+	if dstBlock < 16 || dstBlock%int(PAD) != 0 {
+		return stats, EINVAL
+	}
+	r, err := NewReader(src, srcBlock)
+	if err != nil {
+		return stats, err
+	}
+	defer r.Close()
+	w, err := NewWriterWithOptions(dst, WriterOptions{Exclusive: true})
+	if err != nil {
+		return stats, err
+	}
+	fail := func(err error) (RebuildStats, error) {
+		w.Close()
+		os.Remove(dst)
+		return stats, err
+	}
+
+	schema, ok, err := r.Schema()
+	if err != nil && err != EBADSLT {
+		return fail(err)
+	}
+	if ok {
+		err = w.SetSchema(schema)
+		if err != nil {
+			return fail(err)
+		}
+		stats.Schema = true
+	}
+
+	block := int64(dstBlock)
+	touched := func(start int64, size int64) int64 {
+		return (start+size-1)/block - start/block + 1
+	}
+	before, after := int64(0), int64(0)
+	opts := ScanOptions{OnLargeEntry: func(offset, next uint32) error {
+		copied, err := rebuildLarge(r, w, offset)
+		if copied {
+			stats.LargeEntries++
+		}
+		return err
+	}}
+	err = r.ScanWithOptions(0, opts, func(data []byte, offset, next uint32) error {
+		size := int64(16 + len(data))
+		before += touched(byteOffset(offset), size)
+
+		start := byteOffset(w.offset)
+		if size <= block && touched(start, size) > 1 {
+			gap := block - start%block
+			if gap >= 16 {
+				_, _, err := w.appendBlob(entryBlob(make([]byte, gap-16), PADDING_MAGIC))
+				if err != nil {
+					return err
+				}
+			}
+		}
+		off, _, err := w.Append(data)
+		if err != nil {
+			return err
+		}
+		after += touched(byteOffset(off), size)
+		stats.Entries++
+		return nil
+	})
+	if err == nil {
+		err = w.Sync()
+	}
+	if err != nil {
+		return fail(err)
+	}
+	if stats.Entries > 0 {
+		stats.BlocksBefore = float64(before) / float64(stats.Entries)
+		stats.BlocksAfter = float64(after) / float64(stats.Entries)
+	}
+	return stats, w.Close()
+}
+
+// stream the large entry at offset from r to w, returns false if it is corrupted (its crc is known only at the end, so it is truncated from w again)
+func rebuildLarge(r *Reader, w *Writer, offset uint32) (bool, error) {
+	length, _, _, err := readLargeHeader(r.reader, offset)
+	if err != nil {
+		return false, err
+	}
+	pr, pw := io.Pipe()
+	read := make(chan error, 1)
+	go func() {
+		_, err := r.WriteEntryTo(offset, pw)
+		pw.CloseWithError(err)
+		read <- err
+	}()
+	// Rebuild is the only writer, so the entry starts at the current end
+	start := atomic.LoadUint32(&w.offset)
+	_, _, err = w.AppendFrom(pr, length)
+	// unblock WriteEntryTo if AppendFrom stopped reading
+	pr.Close()
+	rerr := <-read
+	if rerr == EBADSLT || rerr == ErrTruncated {
+		return false, w.TruncateTo(start)
+	}
+	if err == nil {
+		err = rerr
+	}
+	return err == nil, err
+}
@@ -0,0 +1,157 @@
+package pen
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestRebuild(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := path.Join(dir, "src")
+	dst := path.Join(dir, "dst")
+
+	w, err := NewWriter(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{}
+	for i := 0; i < 200; i++ {
+		data := fmt.Sprintf("%d%s", i, RandStringRunes((i*37)%1500))
+		_, _, err := w.Append([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, data)
+	}
+	// big entry can not be aligned
+	_, _, err = w.Append(make([]byte, 10000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected = append(expected, string(make([]byte, 10000)))
+	w.Close()
+
+	_, err = Rebuild(src, dst, 16, 100)
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+	stats, err := Rebuild(src, dst, 16, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != len(expected) || stats.BlocksAfter >= stats.BlocksBefore {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+	_, err = Rebuild(src, dst, 16, 4096)
+	if !os.IsExist(err) {
+		t.Fatalf("expected exist error got %v", err)
+	}
+
+	r, err := NewReader(dst, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	i := 0
+	errs, err := r.ScanCollectErrors(0, func(data []byte, offset, next uint32) error {
+		if string(data) != expected[i] {
+			t.Fatalf("unexpected data at %d", i)
+		}
+		start := byteOffset(offset)
+		if size := int64(16 + len(data)); size <= 4096 && start/4096 != (start+size-1)/4096 {
+			t.Fatalf("entry %d at %d crosses block boundary", i, start)
+		}
+		i++
+		return nil
+	})
+	if err != nil || len(errs) != 0 || i != len(expected) {
+		t.Fatalf("unexpected %d %v %v", i, errs, err)
+	}
+}
+
+func TestRebuildSchemaAndLarge(t *testing.T) {
+	defer func(size int) {
+		largeChunkSize = size
+	}(largeChunkSize)
+	largeChunkSize = 1000
+
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	src := path.Join(dir, "src")
+	dst := path.Join(dir, "dst")
+
+	w, err := NewWriter(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := w.SetSchema([]byte(`{"codec":"json"}`)); err != nil {
+		t.Fatal(err)
+	}
+	big := []byte(RandStringRunes(50000))
+	if _, _, err := w.Append([]byte("before")); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := w.AppendFrom(bytes.NewReader(big), int64(len(big))); err != nil {
+		t.Fatal(err)
+	}
+	corrupted, _, err := w.AppendFrom(bytes.NewReader(big), int64(len(big)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := w.Append([]byte("after")); err != nil {
+		t.Fatal(err)
+	}
+	// the crc of the second large entry does not match
+	if _, err := w.file.WriteAt([]byte{'!'}, byteOffset(corrupted)+largeHeaderSize+30000); err != nil {
+		t.Fatal(err)
+	}
+	w.Close()
+
+	stats, err := Rebuild(src, dst, 16, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.Entries != 2 || !stats.Schema || stats.LargeEntries != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+
+	r, err := NewReader(dst, 4096)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	schema, ok, err := r.Schema()
+	if err != nil || !ok || string(schema) != `{"codec":"json"}` {
+		t.Fatalf("unexpected schema %q %v %v", schema, ok, err)
+	}
+	entries := []string{}
+	large := []uint32{}
+	opts := ScanOptions{OnLargeEntry: func(offset, next uint32) error {
+		large = append(large, offset)
+		return nil
+	}}
+	errs := 0
+	opts.onSkip = func(from, to uint32) { errs++ }
+	err = r.ScanWithOptions(0, opts, func(data []byte, offset, next uint32) error {
+		entries = append(entries, string(data))
+		return nil
+	})
+	if err != nil || errs != 0 || fmt.Sprint(entries) != "[before after]" || len(large) != 1 {
+		t.Fatalf("unexpected %v %d %v %v", entries, len(large), errs, err)
+	}
+	copied := bytes.NewBuffer(nil)
+	if _, err := r.WriteEntryTo(large[0], copied); err != nil || !bytes.Equal(copied.Bytes(), big) {
+		t.Fatalf("unexpected large entry %d %v", copied.Len(), err)
+	}
+}
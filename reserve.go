@@ -0,0 +1,26 @@
+package pen
+
+// Append placeholder for entry with length bytes of data, and return its offset and fill, which writes the data into it later.
+// Until it is filled, the placeholder is padding entry (PADDING_MAGIC) that Scan skips, and Read returns EBADSLT for it,
+// at the end of the file it looks like torn tail (TailState counts it as garbage, RecoverFile truncates it), so every reserved entry must eventually be filled.
+// fill must get exactly length bytes (otherwise EINVAL), and can be called from any goroutine.
+// The placeholder is overwritten in place, so it returns EINVAL with O_APPEND, MultiProcess, FileCRC, FixedSize, Transforms, MaxSegmentBytes or OnAppend.
+func (fw *Writer) AppendReserved(length uint32) (uint32, func([]byte) error, error) {
+	if fw.appendMode || fw.fileCRC || fw.fixedSize > 0 || len(fw.opts.Transforms) > 0 || fw.opts.MaxSegmentBytes > 0 || fw.opts.OnAppend != nil {
+		return 0, nil, EINVAL
+	}
+
+	offset, _, err := fw.appendBlob(entryBlob(make([]byte, length), PADDING_MAGIC))
+	if err != nil {
+		return 0, nil, err
+	}
+	file := fw.file
+	fill := func(data []byte) error {
+		if len(data) != int(length) {
+			return EINVAL
+		}
+		_, err := file.WriteAt(entryBlob(data, MAGIC), byteOffset(offset))
+		return err
+	}
+	return offset, fill, nil
+}
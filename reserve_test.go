@@ -0,0 +1,90 @@
+package pen
+
+import (
+	"bytes"
+	"path"
+	"testing"
+)
+
+func TestAppendReserved(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	first, _, err := fw.Append([]byte("first"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	reserved, fill, err := fw.AppendReserved(100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last, _, err := fw.Append([]byte("last"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if last != nextOffset(reserved, 100) {
+		t.Fatalf("expected %d got %d", nextOffset(reserved, 100), last)
+	}
+
+	scan := func() []uint32 {
+		got := []uint32{}
+		errs, err := reader.ScanCollectErrors(0, func(data []byte, offset, next uint32) error {
+			got = append(got, offset)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(errs) != 0 {
+			t.Fatalf("unexpected corruption %v", errs)
+		}
+		return got
+	}
+
+	if got := scan(); len(got) != 2 || got[0] != first || got[1] != last {
+		t.Fatalf("expected the placeholder to be skipped got %v", got)
+	}
+	if _, _, err := reader.Read(reserved); err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+
+	if err := fill(make([]byte, 99)); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+	data := bytes.Repeat([]byte("x"), 100)
+	if err := fill(data); err != nil {
+		t.Fatal(err)
+	}
+	got, _, err := reader.Read(reserved)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("unexpected data %q", got)
+	}
+	if offsets := scan(); len(offsets) != 3 || offsets[1] != reserved {
+		t.Fatalf("expected the filled entry got %v", offsets)
+	}
+
+	// unfilled at the end is torn tail
+	_, _, err = fw.AppendReserved(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lastGood, garbage, err := reader.TailState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastGood != nextOffset(last, 4) || garbage == 0 {
+		t.Fatalf("unexpected tail state %d %d", lastGood, garbage)
+	}
+
+	fixed, err := NewWriterWithOptions(path.Join(path.Dir(reader.file.Name()), "fixed"), WriterOptions{FixedSize: 8})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fixed.Close()
+	if _, _, err := fixed.AppendReserved(8); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+}
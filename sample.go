@@ -0,0 +1,53 @@
+package pen
+
+import (
+	"math/rand"
+	"sort"
+)
+
+// Call cb for uniform random sample of k entries (or all of them if the file has less), in the order they are in the file.
+// It is reservoir sampling over one full Scan keeping only the offsets of the sample (4 bytes per entry), and then the k sampled entries are read again,
+// so the I/O cost is one pass over the whole file plus k reads. The same seed on the same file gives the same sample.
+func (ar *Reader) ScanSample(k int, seed int64, cb func([]byte, uint32, uint32) error) error {
+	if k <= 0 {
+		return nil
+	}
+
+	rnd := rand.New(rand.NewSource(seed))
+	// every entry takes at least one PAD, so a huge k does not allocate more than the file can have, append grows it if the file is appended to
+	capacity := int64(k)
+	if size, err := ar.size(); err != nil {
+		capacity = 0
+	} else if entries := (size + int64(PAD) - 1) / int64(PAD); entries < capacity {
+		capacity = entries
+	}
+	sample := make([]uint32, 0, capacity)
+	seen := int64(0)
+	err := ar.ScanNoCopy(0, func(data []byte, offset, next uint32) error {
+		seen++
+		if len(sample) < k {
+			sample = append(sample, offset)
+		} else if j := rnd.Int63n(seen); j < int64(k) {
+			sample[j] = offset
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	sort.Slice(sample, func(i, j int) bool {
+		return sample[i] < sample[j]
+	})
+	for _, offset := range sample {
+		data, next, err := ar.Read(offset)
+		if err != nil {
+			return err
+		}
+		err = cb(data, offset, next)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
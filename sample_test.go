@@ -0,0 +1,71 @@
+package pen
+
+import (
+	"fmt"
+	"math"
+	"testing"
+)
+
+func TestScanSample(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	for i := 0; i < 1000; i++ {
+		_, _, err := fw.Append([]byte(fmt.Sprintf("%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	sample := func(k int, seed int64) []string {
+		out := []string{}
+		prev := int64(-1)
+		err := reader.ScanSample(k, seed, func(data []byte, offset, next uint32) error {
+			if int64(offset) <= prev {
+				return fmt.Errorf("not in file order %d after %d", offset, prev)
+			}
+			prev = int64(offset)
+			out = append(out, string(data))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return out
+	}
+
+	a := sample(10, 1)
+	if len(a) != 10 {
+		t.Fatalf("expected 10 got %d", len(a))
+	}
+	if fmt.Sprint(a) != fmt.Sprint(sample(10, 1)) {
+		t.Fatalf("same seed gave different samples")
+	}
+	if fmt.Sprint(a) == fmt.Sprint(sample(10, 2)) {
+		t.Fatalf("different seeds gave the same sample")
+	}
+	if n := len(sample(2000, 1)); n != 1000 {
+		t.Fatalf("expected all 1000 got %d", n)
+	}
+	// the sample is not preallocated for k
+	if n := len(sample(math.MaxInt32, 1)); n != 1000 {
+		t.Fatalf("expected all 1000 got %d", n)
+	}
+	if n := len(sample(0, 1)); n != 0 {
+		t.Fatalf("expected nothing got %d", n)
+	}
+
+	// every entry should be picked roughly k/n of the time
+	counts := map[string]int{}
+	for seed := int64(0); seed < 200; seed++ {
+		for _, s := range sample(100, seed) {
+			counts[s]++
+		}
+	}
+	for _, i := range []int{0, 500, 999} {
+		c := counts[fmt.Sprintf("%d", i)]
+		if c < 5 || c > 45 {
+			t.Fatalf("entry %d sampled %d times, expected about 20", i, c)
+		}
+	}
+}
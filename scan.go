@@ -0,0 +1,439 @@
+package pen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+)
+
+// how often ScanOptions.Progress is called
+var progressInterval = 200 * time.Millisecond
+
+// returned by the callbacks of the scan helpers to stop the underlying scan without error
+var errStopScan = errors.New("stop scan")
+
+// the callback did not return within ScanOptions.PerEntryTimeout, the error has the offset of the entry
+var ErrCallbackTimeout = errors.New("callback timeout")
+
+// Options for ScanWithOptions and ScanFromReaderWithOptions, the zero value is the same as Scan
+type ScanOptions struct {
+	// do not call the callback for entries with zero length data (e.g. heartbeats), they are still valid entries, so the next offset
+	// passed to the callback still points after them
+	SkipEmpty bool
+
+	// return ErrTruncated if the scan ends with incomplete entry or garbage at the end of the file, instead of just stopping at the last complete entry
+	ReportTruncated bool
+
+	// if there is corruption and there are less than blockSize bytes until the end of the file, stop the scan instead of trying to resync
+	// (e.g. the padding or torn entry after a crash), corruption before that is skipped as usual
+	StopOnTailCorruption bool
+
+	// call the callback also for the schema entry written by Writer.SetSchema, by default Scan skips it
+	IncludeSchema bool
+
+	// called at most every 200ms during the scan (and at the start, and once more when the scan returns, for any reason) with the position of the scan and the size of the file
+	// when the scan started (0 if it is not known), the position can be bigger than the size if the file is appended to during the scan
+	Progress func(bytesRead, totalBytes int64)
+
+	// compare the data checksum of the entries, nil is the default true (so the zero ScanOptions still verifies everything like Scan).
+	// If it points to false, the data is still read and delivered, but only the header checksum and the magic are verified, so corruption of
+	// the header (which would break the offsets) is still skipped, but corrupted data is delivered as it is. Compact and fixed size entries are always fully verified.
+	VerifyPayload *bool
+
+	// called for the large entries written by Writer.AppendFrom (Scan skips them, because their data can be too big for memory), read them with Reader.WriteEntryTo
+	OnLargeEntry func(offset, next uint32) error
+
+	// abort the scan with ErrCallbackTimeout if a callback does not return within it, every callback runs in a goroutine and the scan waits on a timer.
+	// The timed out callback *may still be running* after the scan returned, so the callbacks must be cancellation aware or idempotent.
+	PerEntryTimeout time.Duration
+
+	// called with every corrupted region [from, to) that was skipped
+	onSkip func(from, to uint32)
+}
+
+// Same as ScanFromReader but with options
+func ScanFromReaderWithOptions(reader io.ReaderAt, offset uint32, blockSize int, opts ScanOptions, cb func([]byte, uint32, uint32) error) error {
+	return readerAt(reader, blockSize).ScanWithOptions(offset, opts, cb)
+}
+
+// Same as Scan but with options
+func (ar *Reader) ScanWithOptions(offset uint32, opts ScanOptions, cb func([]byte, uint32, uint32) error) error {
+	read := ar.read
+	if opts.VerifyPayload != nil && !*opts.VerifyPayload && ar.opts.FixedSize == 0 {
+		ropts := ar.opts
+		ropts.skipPayloadChecksum = true
+		read = func(offset uint32) ([]byte, uint32, error) {
+			return ar.readEntryAt(offset, make([]byte, ar.blockSize), &ropts)
+		}
+	}
+	if opts.PerEntryTimeout > 0 {
+		cb = withTimeout(opts.PerEntryTimeout, cb)
+	}
+	return ar.scanWithOptions(offset, opts, read, cb)
+}
+
+// run every cb in a goroutine, returning ErrCallbackTimeout if it does not finish in time
+func withTimeout(timeout time.Duration, cb func([]byte, uint32, uint32) error) func([]byte, uint32, uint32) error {
+	return func(data []byte, offset, next uint32) error {
+		done := make(chan error, 1)
+		go func() {
+			done <- cb(data, offset, next)
+		}()
+		t := time.NewTimer(timeout)
+		defer t.Stop()
+		select {
+		case err := <-done:
+			return err
+		case <-t.C:
+			return fmt.Errorf("pen: callback at offset %d: %w", offset, ErrCallbackTimeout)
+		}
+	}
+}
+
+// Scan until the total length of the delivered data would exceed maxBytes, returns the offset to continue from.
+// The first entry is always delivered even if it is bigger than maxBytes, so looping over ScanBudget always makes progress.
+// example:
+//	offset := uint32(0)
+//	for {
+//		next, err := r.ScanBudget(offset, 64*1024*1024, process)
+//		if err != nil {
+//			panic(err)
+//		}
+//		if next == offset {
+//			break // nothing more to read
+//		}
+//		checkpoint(next)
+//		offset = next
+//	}
+func (ar *Reader) ScanBudget(offset uint32, maxBytes uint64, cb func([]byte, uint32, uint32) error) (uint32, error) {
+	resume := offset
+	used := uint64(0)
+	delivered := false
+	err := ar.Scan(offset, func(data []byte, offset, next uint32) error {
+		if delivered && used+uint64(len(data)) > maxBytes {
+			return errStopScan
+		}
+		err := cb(data, offset, next)
+		if err != nil {
+			return err
+		}
+		used += uint64(len(data))
+		delivered = true
+		resume = next
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		return resume, err
+	}
+	return resume, nil
+}
+
+// Scan delivering sliding windows of the last k entries, the callback is called once per entry with the window ending with it (oldest first).
+// If partial is true, the first k-1 entries are delivered with partial windows, otherwise the callback is called only when the window is full.
+// The window and offsets slices are reused between calls, so they are only valid during the callback, the data inside them is owned by the caller.
+func (ar *Reader) ScanWindow(offset uint32, k int, partial bool, cb func(window [][]byte, offsets []uint32) error) error {
+	if k <= 0 {
+		return EINVAL
+	}
+	window := make([][]byte, 0, k)
+	offsets := make([]uint32, 0, k)
+	return ar.Scan(offset, func(data []byte, offset, next uint32) error {
+		if len(window) == k {
+			copy(window, window[1:])
+			copy(offsets, offsets[1:])
+			window = window[:k-1]
+			offsets = offsets[:k-1]
+		}
+		window = append(window, data)
+		offsets = append(offsets, offset)
+		if !partial && len(window) < k {
+			return nil
+		}
+		return cb(window, offsets)
+	})
+}
+
+// Scan delivering the entries in batches of batchSize (e.g. for bulk inserts), the callback is called once per full batch,
+// and once more with the last partial batch at the end of the file (not at all for empty file). Every batch has new payloads and offsets slices,
+// and every payload is copied to its own exact size slice (not the blockSize read buffer), so the batch can be kept after the callback.
+func (ar *Reader) ScanBatch(offset uint32, batchSize int, cb func(payloads [][]byte, offsets []uint32) error) error {
+	if batchSize <= 0 {
+		return EINVAL
+	}
+	// batchSize can be much bigger than the file, so the first batch grows by append, the next ones are allocated with its size,
+	// because a full batch already fit in memory
+	var payloads [][]byte
+	var offsets []uint32
+	err := ar.ScanNoCopy(offset, func(data []byte, offset, next uint32) error {
+		payloads = append(payloads, append([]byte{}, data...))
+		offsets = append(offsets, offset)
+		if len(payloads) < batchSize {
+			return nil
+		}
+		err := cb(payloads, offsets)
+		payloads = make([][]byte, 0, batchSize)
+		offsets = make([]uint32, 0, batchSize)
+		return err
+	})
+	if err != nil || len(payloads) == 0 {
+		return err
+	}
+	return cb(payloads, offsets)
+}
+
+// Scan and call save(next) after every successful callback, so the job can be restarted from the last saved offset.
+// If save returns error the scan stops with it.
+// example:
+//	ow, err := NewOffsetWriter(checkpointFilename)
+//	if err != nil {
+//		panic(err)
+//	}
+//	err = r.ScanResumable(uint32(ow.ReadOrDefault(0)), func(next uint32) error {
+//		return ow.SetOffset(int64(next))
+//	}, process)
+func (ar *Reader) ScanResumable(offset uint32, save func(uint32) error, cb func([]byte, uint32, uint32) error) error {
+	return ar.Scan(offset, func(data []byte, offset, next uint32) error {
+		err := cb(data, offset, next)
+		if err != nil {
+			return err
+		}
+		return save(next)
+	})
+}
+
+// Scan until the first entry for which stop returns true, the callback is not called for it, and its offset is returned so it can be inspected or the scan resumed from it.
+// If no entry stops the scan, it returns the offset after the last entry and io.EOF.
+func (ar *Reader) ScanUntil(offset uint32, stop func([]byte) bool, cb func([]byte, uint32, uint32) error) (uint32, error) {
+	resume := offset
+	err := ar.Scan(offset, func(data []byte, offset, next uint32) error {
+		if stop(data) {
+			resume = offset
+			return errStopScan
+		}
+		err := cb(data, offset, next)
+		if err != nil {
+			return err
+		}
+		resume = next
+		return nil
+	})
+	if err == errStopScan {
+		return resume, nil
+	}
+	if err != nil {
+		return resume, err
+	}
+	return resume, io.EOF
+}
+
+// Scan reading at most bytesPerSec bytes (header and data) per second on average, so background scans (e.g. verification) do not starve other I/O.
+// It is a token bucket allowing bursts of 1/10th of a second, the callback time counts towards the rate.
+func (ar *Reader) ScanThrottled(offset uint32, bytesPerSec int64, cb func([]byte, uint32, uint32) error) error {
+	if bytesPerSec <= 0 {
+		return EINVAL
+	}
+	bucket := newTokenBucket(bytesPerSec)
+	return ar.Scan(offset, func(data []byte, offset, next uint32) error {
+		bucket.take(16 + len(data))
+		return cb(data, offset, next)
+	})
+}
+
+// token bucket of bytes per second allowing bursts of 1/10th of a second
+type tokenBucket struct {
+	rate   float64
+	burst  float64
+	tokens float64
+	last   time.Time
+}
+
+func newTokenBucket(bytesPerSec int64) *tokenBucket {
+	rate := float64(bytesPerSec)
+	return &tokenBucket{rate: rate, burst: rate / 10, tokens: rate / 10, last: time.Now()}
+}
+
+// take n bytes, returns how long to sleep until the bucket has them
+func (b *tokenBucket) delay(n int) time.Duration {
+	now := time.Now()
+	b.tokens += b.rate * now.Sub(b.last).Seconds()
+	if b.tokens > b.burst {
+		b.tokens = b.burst
+	}
+	b.last = now
+
+	b.tokens -= float64(n)
+	if b.tokens < 0 {
+		return time.Duration(-b.tokens / b.rate * float64(time.Second))
+	}
+	return 0
+}
+
+func (b *tokenBucket) take(n int) {
+	if d := b.delay(n); d > 0 {
+		time.Sleep(d)
+	}
+}
+
+// Same as Scan (corruption is skipped), but returns every skipped corrupted region as ChecksumError with Offset and End, adjacent bad offsets are one region.
+// Corruption at the end of the file is included, an incomplete entry at the end of the file (ErrTruncated) is not checksum error, check Reader.TailState for it.
+// The corruption found before the callback returned error is returned with the error.
+func (ar *Reader) ScanCollectErrors(offset uint32, cb func([]byte, uint32, uint32) error) ([]ChecksumError, error) {
+	errs := []ChecksumError{}
+	opts := ScanOptions{
+		onSkip: func(from, to uint32) {
+			errs = append(errs, ChecksumError{Offset: from, End: to})
+		},
+	}
+	err := ar.ScanWithOptions(offset, opts, cb)
+	return errs, err
+}
+
+// Result of ScanWithRecovery
+type RecoveryReport struct {
+	// number of entries delivered to the callback, and the total length of their data
+	Entries int
+	Bytes   int64
+
+	// the corrupted regions that were skipped, same as ScanCollectErrors
+	Corrupt []ChecksumError
+
+	// the scan ended with incomplete entry or garbage at the end of the file (same as ScanOptions.ReportTruncated)
+	Truncated bool
+}
+
+// Scan delivering every good entry, and report what could not be read: the corrupted regions that were skipped and if the end of the file is truncated.
+// A truncated tail is not an error, it is only reported. If the callback returns error, the scan stops and the report has what was found until then.
+func (ar *Reader) ScanWithRecovery(offset uint32, cb func([]byte, uint32, uint32) error) (RecoveryReport, error) {
+	report := RecoveryReport{Corrupt: []ChecksumError{}}
+	opts := ScanOptions{
+		ReportTruncated: true,
+		onSkip: func(from, to uint32) {
+			report.Corrupt = append(report.Corrupt, ChecksumError{Offset: from, End: to})
+		},
+	}
+	err := ar.ScanWithOptions(offset, opts, func(data []byte, offset, next uint32) error {
+		err := cb(data, offset, next)
+		if err != nil {
+			return err
+		}
+		report.Entries++
+		report.Bytes += int64(len(data))
+		return nil
+	})
+	if err == ErrTruncated {
+		report.Truncated = true
+		err = nil
+	}
+	return report, err
+}
+
+// Scan calling the callback only when the data is different from the previous delivered entry, to collapse runs of identical records.
+// The entries are compared by uint32(Hash(data)) of the delivered data (the same value the header stores for the plain entries, but computed again so
+// it also works for the transformed and compact entries), so very rarely (1 in 2^32 for consecutive different entries) a changed entry can be
+// suppressed because of collision, use ScanDedupExact if that is not acceptable.
+func (ar *Reader) ScanDedup(offset uint32, cb func([]byte, uint32, uint32) error) error {
+	return ar.scanDedup(offset, false, cb)
+}
+
+// Same as ScanDedup, but when the checksums match the data is also compared byte by byte, so there are no false duplicates.
+func (ar *Reader) ScanDedupExact(offset uint32, cb func([]byte, uint32, uint32) error) error {
+	return ar.scanDedup(offset, true, cb)
+}
+
+func (ar *Reader) scanDedup(offset uint32, exact bool, cb func([]byte, uint32, uint32) error) error {
+	delivered := false
+	var prev []byte
+	prevChecksum := uint32(0)
+	return ar.Scan(offset, func(data []byte, offset, next uint32) error {
+		checksum := uint32(Hash(data))
+		if delivered && checksum == prevChecksum && (!exact || bytes.Equal(data, prev)) {
+			return nil
+		}
+		delivered = true
+		prevChecksum = checksum
+		if exact {
+			prev = data
+		}
+		return cb(data, offset, next)
+	})
+}
+
+// Scan calling cb only for the entries that are new or changed since the baseline (offset -> uint32(Hash(data)), e.g. PayloadChecksum of a previous run).
+// For the normal entries only the header is read, and the data is read only if the stored data checksum is different from the baseline or the offset is not in it.
+// Compact entries, corruption and the reserved entries are handled by Scan, so they read the data as usual.
+func (ar *Reader) ScanModified(baseline map[uint32]uint32, cb func([]byte, uint32, uint32) error) error {
+	offset := uint32(0)
+	for {
+		checksum, next, err := ar.PayloadChecksum(offset)
+		if err == io.EOF {
+			return nil
+		}
+		if old, ok := baseline[offset]; ok && err == nil && old == checksum {
+			offset = next
+			continue
+		}
+
+		// one entry the same way as Scan, it could resync after offset
+		found := false
+		err = ar.Scan(offset, func(data []byte, o, next uint32) error {
+			found = true
+			offset = next
+			if old, ok := baseline[o]; ok && old == uint32(Hash(data)) {
+				return errStopScan
+			}
+			err := cb(data, o, next)
+			if err != nil {
+				return err
+			}
+			return errStopScan
+		})
+		if err != nil && err != errStopScan {
+			return err
+		}
+		if !found {
+			return nil
+		}
+	}
+}
+
+// returns func that calls progress with the position of offset at most every progressInterval, and always when end is set (the scan returns)
+func (ar *Reader) progressReporter(progress func(int64, int64)) func(offset uint32, end bool) {
+	total, _ := ar.size()
+	last := time.Time{}
+	return func(offset uint32, end bool) {
+		now := time.Now()
+		if !end && now.Sub(last) < progressInterval {
+			return
+		}
+		last = now
+		pos := byteOffset(offset)
+		if end && pos > total && total > 0 {
+			// the last entry is not padded
+			pos = total
+		}
+		progress(pos, total)
+	}
+}
+
+// Scan dispatching every entry by its first byte (type tag) to the handler for it, entries with unknown tag are passed to fallback (if nil they are skipped).
+// The handlers get the whole data including the tag. Empty entries have no tag, they are passed to fallback with tag 0 and empty data,
+// which is different from entry with tag 0 (its data has at least the tag).
+func (ar *Reader) ScanTyped(offset uint32, handlers map[byte]func([]byte, uint32) error, fallback func(byte, []byte, uint32) error) error {
+	return ar.Scan(offset, func(data []byte, offset, next uint32) error {
+		if len(data) > 0 {
+			if h, ok := handlers[data[0]]; ok {
+				return h(data, offset)
+			}
+		}
+		if fallback == nil {
+			return nil
+		}
+		tag := byte(0)
+		if len(data) > 0 {
+			tag = data[0]
+		}
+		return fallback(tag, data, offset)
+	})
+}
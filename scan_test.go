@@ -0,0 +1,1029 @@
+package pen
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+)
+
+// creates writer and reader on a new file, the returned function closes them and removes the file
+func newTestWriterReader(t testing.TB, blockSize int) (*Writer, *Reader, func()) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn := path.Join(dir, "forward")
+	fw, err := NewWriter(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewReader(fn, blockSize)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return fw, reader, func() {
+		reader.Close()
+		fw.Close()
+		os.RemoveAll(dir)
+	}
+}
+
+func TestScanBudget(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	for i := 0; i < 100; i++ {
+		_, _, err := fw.Append(make([]byte, 10))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, _, err := fw.Append(make([]byte, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offset := uint32(0)
+	batches := []int{}
+	for {
+		n := 0
+		next, err := reader.ScanBudget(offset, 95, func(data []byte, offset, next uint32) error {
+			n++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if next == offset {
+			break
+		}
+		batches = append(batches, n)
+		offset = next
+	}
+	// 9 entries of 10 fit in 95, the last 1000 bytes entry is alone but still delivered
+	expected := []int{9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 9, 1, 1}
+	if len(batches) != len(expected) {
+		t.Fatalf("expected %v got %v", expected, batches)
+	}
+	for i := range expected {
+		if batches[i] != expected[i] {
+			t.Fatalf("expected %v got %v", expected, batches)
+		}
+	}
+}
+
+func TestScanSkipEmpty(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	for i := 0; i < 100; i++ {
+		_, _, err := fw.Append([]byte(RandStringRunes(i % 3)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, skip := range []bool{false, true} {
+		n := 0
+		prevNext := uint32(0)
+		err := reader.ScanWithOptions(0, ScanOptions{SkipEmpty: skip}, func(data []byte, offset, next uint32) error {
+			if skip && len(data) == 0 {
+				t.Fatal("unexpected empty entry")
+			}
+			if next <= prevNext {
+				t.Fatalf("next %d did not advance", next)
+			}
+			prevNext = next
+			n++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if skip && n != 66 || !skip && n != 100 {
+			t.Fatalf("skip: %v, unexpected count %d", skip, n)
+		}
+	}
+}
+
+func TestScanWindow(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	err := reader.ScanWindow(0, 0, false, func(window [][]byte, offsets []uint32) error {
+		return nil
+	})
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+
+	expectedOffsets := []uint32{}
+	for i := 0; i < 10; i++ {
+		off, _, err := fw.Append([]byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expectedOffsets = append(expectedOffsets, off)
+	}
+
+	for _, partial := range []bool{false, true} {
+		calls := 0
+		err := reader.ScanWindow(0, 3, partial, func(window [][]byte, offsets []uint32) error {
+			last := int(window[len(window)-1][0])
+			if !partial && len(window) != 3 {
+				t.Fatalf("expected full window got %d", len(window))
+			}
+			for i := range window {
+				j := last - len(window) + 1 + i
+				if int(window[i][0]) != j || offsets[i] != expectedOffsets[j] {
+					t.Fatalf("unexpected window %v %v", window, offsets)
+				}
+			}
+			calls++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if partial && calls != 10 || !partial && calls != 8 {
+			t.Fatalf("partial: %v, unexpected calls %d", partial, calls)
+		}
+	}
+}
+
+func TestScanResumable(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	for i := 0; i < 10; i++ {
+		_, _, err := fw.Append([]byte{byte(i)})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	crash := errors.New("crash")
+	saved := uint32(0)
+	seen := []byte{}
+	crashed := false
+	process := func(data []byte, offset, next uint32) error {
+		if data[0] == 5 && !crashed {
+			crashed = true
+			return crash
+		}
+		seen = append(seen, data[0])
+		return nil
+	}
+	save := func(next uint32) error {
+		saved = next
+		return nil
+	}
+
+	err := reader.ScanResumable(saved, save, process)
+	if err != crash {
+		t.Fatalf("expected crash got %v", err)
+	}
+	err = reader.ScanResumable(saved, save, process)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(seen) != 10 {
+		t.Fatalf("expected 10 got %v", seen)
+	}
+	for i := range seen {
+		if int(seen[i]) != i {
+			t.Fatalf("unexpected %v", seen)
+		}
+	}
+}
+
+func TestScanUntil(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	var end, last uint32
+	for i := 0; i < 10; i++ {
+		data := []byte("DATA")
+		if i == 5 {
+			data = []byte("END")
+		}
+		off, next, err := fw.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i == 5 {
+			end = off
+		}
+		last = next
+	}
+
+	stop := func(data []byte) bool {
+		return string(data) == "END"
+	}
+	n := 0
+	count := func(data []byte, offset, next uint32) error {
+		n++
+		return nil
+	}
+	stopped, err := reader.ScanUntil(0, stop, count)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stopped != end || n != 5 {
+		t.Fatalf("expected stop at %d after 5, got %d after %d", end, stopped, n)
+	}
+
+	n = 0
+	_, next, err := reader.Read(stopped)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stopped, err = reader.ScanUntil(next, stop, count)
+	if err != io.EOF {
+		t.Fatalf("expected EOF got %v", err)
+	}
+	if stopped != last || n != 4 {
+		t.Fatalf("expected end at %d after 4, got %d after %d", last, stopped, n)
+	}
+}
+
+type countingReaderAt struct {
+	r     io.ReaderAt
+	reads int
+}
+
+func (c *countingReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	c.reads++
+	return c.r.ReadAt(p, off)
+}
+
+func TestScanStopOnTailCorruption(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	offsets := []uint32{}
+	for i := 0; i < 100; i++ {
+		off, _, err := fw.Append(make([]byte, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	// corrupt entry in the middle of the file, and garbage at the end
+	_, err := fw.file.WriteAt([]byte{1}, byteOffset(offsets[3])+20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	off, _, err := fw.Append(make([]byte, 2000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fw.file.WriteAt([]byte{1}, byteOffset(off)+20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reads := map[bool]int{}
+	for _, stop := range []bool{false, true} {
+		r := &countingReaderAt{r: reader.file}
+		n := 0
+		err := ScanFromReaderWithOptions(r, 0, 4096, ScanOptions{StopOnTailCorruption: stop}, func(data []byte, offset, next uint32) error {
+			n++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != 99 {
+			t.Fatalf("stop: %v, expected 99 got %d", stop, n)
+		}
+		reads[stop] = r.reads
+	}
+	if reads[true] >= reads[false] {
+		t.Fatalf("expected less reads when stopping on tail corruption, got %v", reads)
+	}
+}
+
+func TestScanThrottled(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	for i := 0; i < 100; i++ {
+		_, _, err := fw.Append(make([]byte, 84))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if reader.ScanThrottled(0, 0, nil) != EINVAL {
+		t.Fatal("expected EINVAL")
+	}
+
+	// 10000 bytes at 50000 bytes per second, minus the 5000 bytes burst
+	start := time.Now()
+	n := 0
+	err := reader.ScanThrottled(0, 50000, func(data []byte, offset, next uint32) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 100 {
+		t.Fatalf("expected 100 got %d", n)
+	}
+	took := time.Since(start)
+	if took < 90*time.Millisecond || took > 2*time.Second {
+		t.Fatalf("expected ~100ms, took %s", took)
+	}
+}
+
+func BenchmarkScanThrottled(b *testing.B) {
+	fw, reader, done := newTestWriterReader(b, 0)
+	defer done()
+
+	for i := 0; i < 1000; i++ {
+		_, _, err := fw.Append(make([]byte, 1008))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	// the first 1/10th of a second is burst, so expect ~1.1
+	limit := int64(1024 * 1024)
+	b.ResetTimer()
+	start := time.Now()
+	total := int64(0)
+	for i := 0; i < b.N; i++ {
+		err := reader.ScanThrottled(0, limit, func(data []byte, offset, next uint32) error {
+			total += int64(16 + len(data))
+			return nil
+		})
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	b.ReportMetric(float64(total)/time.Since(start).Seconds()/float64(limit), "rate/limit")
+}
+
+func TestScanCollectErrors(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	offsets := []uint32{}
+	for i := 0; i < 20; i++ {
+		off, _, err := fw.Append(make([]byte, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	for _, i := range []int{3, 4, 10, 19} {
+		_, err := fw.file.WriteAt([]byte{1}, byteOffset(offsets[i])+20)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n := 0
+	errs, err := reader.ScanCollectErrors(0, func(data []byte, offset, next uint32) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 16 {
+		t.Fatalf("expected 16 got %d", n)
+	}
+	expected := []ChecksumError{
+		{Offset: offsets[3], End: offsets[5]},
+		{Offset: offsets[10], End: offsets[11]},
+		{Offset: offsets[19], End: nextOffset(offsets[19], 100)},
+	}
+	if len(errs) != len(expected) {
+		t.Fatalf("expected %v got %v", expected, errs)
+	}
+	for i := range expected {
+		if errs[i] != expected[i] {
+			t.Fatalf("expected %v got %v", expected, errs)
+		}
+		if !errors.Is(errs[i], EBADSLT) {
+			t.Fatalf("expected EBADSLT got %v", errs[i])
+		}
+	}
+
+	stop := errors.New("stop")
+	errs, err = reader.ScanCollectErrors(0, func(data []byte, offset, next uint32) error {
+		if offset == offsets[11] {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || len(errs) != 2 {
+		t.Fatalf("unexpected %v %v", errs, err)
+	}
+}
+
+func TestScanWithRecovery(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	offsets := []uint32{}
+	for i := 0; i < 20; i++ {
+		off, _, err := fw.Append(make([]byte, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	for _, i := range []int{3, 4, 10} {
+		_, err := fw.file.WriteAt([]byte{1}, byteOffset(offsets[i])+20)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func() RecoveryReport {
+		n := 0
+		report, err := reader.ScanWithRecovery(0, func(data []byte, offset, next uint32) error {
+			n++
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != report.Entries {
+			t.Fatalf("delivered %d, reported %d", n, report.Entries)
+		}
+		return report
+	}
+
+	report := scan()
+	if report.Entries != 17 || report.Bytes != 1700 || report.Truncated || len(report.Corrupt) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if report.Corrupt[0] != (ChecksumError{Offset: offsets[3], End: offsets[5]}) || report.Corrupt[1] != (ChecksumError{Offset: offsets[10], End: offsets[11]}) {
+		t.Fatalf("unexpected corruption %v", report.Corrupt)
+	}
+
+	err := os.Truncate(reader.file.Name(), byteOffset(offsets[19])+50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	report = scan()
+	if report.Entries != 16 || report.Bytes != 1600 || !report.Truncated || len(report.Corrupt) != 2 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	stop := errors.New("stop")
+	report, err = reader.ScanWithRecovery(0, func(data []byte, offset, next uint32) error {
+		if offset == offsets[11] {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || report.Entries != 8 || len(report.Corrupt) != 2 {
+		t.Fatalf("unexpected %+v %v", report, err)
+	}
+}
+
+func TestScanDedup(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	input := []string{"a", "a", "a", "b", "a", "", "", "c", "c"}
+	for _, s := range input {
+		_, _, err := fw.Append([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, scan := range []func(uint32, func([]byte, uint32, uint32) error) error{reader.ScanDedup, reader.ScanDedupExact} {
+		got := []string{}
+		err := scan(0, func(data []byte, offset, next uint32) error {
+			got = append(got, string(data))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprintf("%q", got) != fmt.Sprintf("%q", []string{"a", "b", "a", "", "c"}) {
+			t.Fatalf("unexpected %q", got)
+		}
+	}
+}
+
+func TestScanProgress(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	for i := 0; i < 1000; i++ {
+		_, _, err := fw.Append(make([]byte, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	size, err := reader.size()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer func(interval time.Duration) {
+		progressInterval = interval
+	}(progressInterval)
+	progressInterval = time.Millisecond
+
+	calls := [][2]int64{}
+	err = reader.ScanWithOptions(0, ScanOptions{Progress: func(bytesRead, totalBytes int64) {
+		calls = append(calls, [2]int64{bytesRead, totalBytes})
+	}}, func(data []byte, offset, next uint32) error {
+		if offset%100 == 0 {
+			time.Sleep(2 * time.Millisecond)
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) < 3 || len(calls) > 1000 {
+		t.Fatalf("unexpected amount of calls %d", len(calls))
+	}
+	if calls[0][0] != 0 || calls[len(calls)-1][0] != size {
+		t.Fatalf("unexpected first or last call %v", calls)
+	}
+	for i, c := range calls {
+		if c[1] != size || (i > 0 && c[0] < calls[i-1][0]) {
+			t.Fatalf("unexpected calls %v", calls)
+		}
+	}
+}
+
+func TestScanProgressLastCall(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 4096)
+	defer done()
+
+	offsets := []uint32{}
+	for i := 0; i < 10; i++ {
+		off, _, err := fw.Append(make([]byte, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	torn, _, err := fw.Append(make([]byte, 100))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fw.file.WriteAt([]byte{1}, byteOffset(torn)+20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// only the first and the last call
+	defer func(interval time.Duration) {
+		progressInterval = interval
+	}(progressInterval)
+	progressInterval = time.Hour
+
+	stop := errors.New("stop")
+	for _, c := range []struct {
+		opts ScanOptions
+		stop uint32
+		err  error
+		last int64
+	}{
+		// the corrupted entry is in the last blockSize bytes
+		{opts: ScanOptions{StopOnTailCorruption: true}, last: byteOffset(torn)},
+		{stop: offsets[5], err: stop, last: byteOffset(offsets[5])},
+	} {
+		calls := []int64{}
+		c.opts.Progress = func(bytesRead, totalBytes int64) {
+			calls = append(calls, bytesRead)
+		}
+		err := reader.ScanWithOptions(0, c.opts, func(data []byte, offset, next uint32) error {
+			if c.err != nil && offset == c.stop {
+				return c.err
+			}
+			return nil
+		})
+		if err != c.err {
+			t.Fatalf("expected %v got %v", c.err, err)
+		}
+		if len(calls) != 2 || calls[0] != 0 || calls[1] != c.last {
+			t.Fatalf("unexpected calls %v, expected last %d", calls, c.last)
+		}
+	}
+}
+
+func TestScanTyped(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	for _, s := range []string{"aone", "btwo", "", "athree", "cfour", "\x00zero"} {
+		_, _, err := fw.Append([]byte(s))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	got := []string{}
+	handler := func(data []byte, offset uint32) error {
+		got = append(got, "handler:"+string(data))
+		return nil
+	}
+	handlers := map[byte]func([]byte, uint32) error{'a': handler, 'b': handler}
+	err := reader.ScanTyped(0, handlers, func(tag byte, data []byte, offset uint32) error {
+		got = append(got, fmt.Sprintf("fallback:%d:%q", tag, data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := `[handler:aone handler:btwo fallback:0:"" handler:athree fallback:99:"cfour" fallback:0:"\x00zero"]`
+	if fmt.Sprintf("%v", got) != expected {
+		t.Fatalf("expected %s got %v", expected, got)
+	}
+
+	got = got[:0]
+	err = reader.ScanTyped(0, handlers, nil)
+	if err != nil || len(got) != 3 {
+		t.Fatalf("unexpected %v %v", got, err)
+	}
+}
+
+func TestScanVerifyPayload(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	offsets := []uint32{}
+	for i := 0; i < 10; i++ {
+		off, _, err := fw.Append(make([]byte, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	// payload of 3 and header of 6
+	for _, pos := range []int64{byteOffset(offsets[3]) + 20, byteOffset(offsets[6]) + 1} {
+		_, err := fw.file.WriteAt([]byte{1}, pos)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	scan := func(opts ScanOptions) []uint32 {
+		got := []uint32{}
+		err := reader.ScanWithOptions(0, opts, func(data []byte, offset, next uint32) error {
+			if offset == offsets[3] && data[4] != 1 {
+				return fmt.Errorf("expected the corrupted data")
+			}
+			got = append(got, offset)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+
+	if got := scan(ScanOptions{}); len(got) != 8 {
+		t.Fatalf("expected 8 entries got %v", got)
+	}
+	verify := true
+	if got := scan(ScanOptions{VerifyPayload: &verify}); len(got) != 8 {
+		t.Fatalf("expected 8 entries got %v", got)
+	}
+	verify = false
+	got := scan(ScanOptions{VerifyPayload: &verify})
+	if len(got) != 9 || got[3] != offsets[3] || got[6] != offsets[7] {
+		t.Fatalf("expected 9 entries with the corrupted payload got %v", got)
+	}
+}
+
+func benchmarkScanVerify(b *testing.B, mode string) {
+	fw, reader, done := newTestWriterReader(b, 4096+16)
+	defer done()
+
+	for i := 0; i < 1000; i++ {
+		_, _, err := fw.Append(make([]byte, 4096))
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+	verify := false
+	b.SetBytes(1000 * 4096)
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var err error
+		switch mode {
+		case "full":
+			err = reader.Scan(0, func(data []byte, offset, next uint32) error { return nil })
+		case "header":
+			err = reader.ScanWithOptions(0, ScanOptions{VerifyPayload: &verify}, func(data []byte, offset, next uint32) error { return nil })
+		case "headers-only":
+			// header walk without reading the data at all
+			offset := uint32(0)
+			for {
+				_, next, err := reader.PayloadChecksum(offset)
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					b.Fatal(err)
+				}
+				offset = next
+			}
+		}
+		if err != nil {
+			b.Fatal(err)
+		}
+	}
+}
+
+func BenchmarkScanVerifyFull(b *testing.B) {
+	benchmarkScanVerify(b, "full")
+}
+
+func BenchmarkScanVerifyHeader(b *testing.B) {
+	benchmarkScanVerify(b, "header")
+}
+
+func BenchmarkScanHeadersOnly(b *testing.B) {
+	benchmarkScanVerify(b, "headers-only")
+}
+
+func TestScanModified(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+	fn := reader.file.Name()
+
+	compact, err := NewWriterWithOptions(fn, WriterOptions{CompactHeader: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	offsets := []uint32{}
+	for i := 0; i < 20; i++ {
+		size := 10
+		if i%2 == 0 {
+			// not compact
+			size = 20000
+		}
+		off, _, err := compact.Append(make([]byte, size))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	if err := compact.Overwrite(offsets[4], []byte("changed")); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+	compact.Close()
+	// plain writer after the compact entries
+	fw.Close()
+	fw, err = NewWriter(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer fw.Close()
+
+	baseline := map[uint32]uint32{}
+	err = reader.Scan(0, func(data []byte, offset, next uint32) error {
+		baseline[offset] = uint32(Hash(data))
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	modified := func() []uint32 {
+		got := []uint32{}
+		err := reader.ScanModified(baseline, func(data []byte, offset, next uint32) error {
+			got = append(got, offset)
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		return got
+	}
+	if got := modified(); len(got) != 0 {
+		t.Fatalf("expected nothing got %v", got)
+	}
+
+	if err := fw.Overwrite(offsets[4], []byte("changed")); err != nil {
+		t.Fatal(err)
+	}
+	added, _, err := fw.Append([]byte("new"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := modified()
+	if len(got) != 2 || got[0] != offsets[4] || got[1] != added {
+		t.Fatalf("expected %d %d got %v", offsets[4], added, got)
+	}
+
+	got = []uint32{}
+	err = reader.ScanModified(nil, func(data []byte, offset, next uint32) error {
+		got = append(got, offset)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != 21 {
+		t.Fatalf("expected all 21 got %d", len(got))
+	}
+}
+
+func TestScanSparseHole(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+	fn := reader.file.Name()
+
+	for i := 0; i < 10; i++ {
+		_, _, err := fw.Append([]byte(RandStringRunes(100)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	fw.Close()
+
+	// 1GB hole, resyncing through it one PAD at a time would take minutes
+	s, err := os.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hole := s.Size() + 1024*1024*1024
+	err = os.Truncate(fn, hole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	start, _, err := nextData(reader.file, s.Size()+int64(PAD)*1024)
+	if err == nil && start < hole {
+		t.Skip("the filesystem does not support SEEK_DATA")
+	}
+
+	fw, err = NewWriter(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	after, _, err := fw.Append([]byte("after the hole"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := reader.file.Seek(123, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	started := time.Now()
+	n := 0
+	var last uint32
+	errs, err := reader.ScanCollectErrors(0, func(data []byte, offset, next uint32) error {
+		n++
+		last = offset
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 11 || last != after {
+		t.Fatalf("expected 11 entries ending at %d got %d at %d", after, n, last)
+	}
+	if len(errs) != 1 || errs[0].End != after {
+		t.Fatalf("expected the hole as one skipped region got %v", errs)
+	}
+	if took := time.Since(started); took > 5*time.Second {
+		t.Fatalf("scan through the hole took %v", took)
+	}
+	if position, err := reader.file.Seek(0, io.SeekCurrent); err != nil || position != 123 {
+		t.Fatalf("the scan moved the file position to %d %v", position, err)
+	}
+
+	// hole at the end
+	err = os.Truncate(fn, byteOffset(nextOffset(after, 14))+hole)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n = 0
+	err = reader.Scan(0, func(data []byte, offset, next uint32) error {
+		n++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 11 {
+		t.Fatalf("expected 11 got %d", n)
+	}
+}
+
+func TestScanPerEntryTimeout(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	offsets := []uint32{}
+	for i := 0; i < 10; i++ {
+		off, _, err := fw.Append([]byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+
+	release := make(chan struct{})
+	defer close(release)
+	n := 0
+	err := reader.ScanWithOptions(0, ScanOptions{PerEntryTimeout: 20 * time.Millisecond}, func(data []byte, offset, next uint32) error {
+		n++
+		if n == 5 {
+			<-release
+		}
+		return nil
+	})
+	if !errors.Is(err, ErrCallbackTimeout) || !strings.Contains(err.Error(), fmt.Sprintf("offset %d", offsets[4])) {
+		t.Fatalf("expected timeout at %d got %v", offsets[4], err)
+	}
+
+	stop := errors.New("stop")
+	err = reader.ScanWithOptions(0, ScanOptions{PerEntryTimeout: time.Second}, func(data []byte, offset, next uint32) error {
+		if offset == offsets[3] {
+			return stop
+		}
+		return nil
+	})
+	if err != stop {
+		t.Fatalf("expected stop got %v", err)
+	}
+}
+
+func TestScanBatch(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 4096)
+	defer done()
+
+	if err := reader.ScanBatch(0, 0, nil); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+	err := reader.ScanBatch(0, 3, func(payloads [][]byte, offsets []uint32) error {
+		t.Fatal("unexpected batch")
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	offsets := []uint32{}
+	for i := 0; i < 10; i++ {
+		off, _, err := fw.Append([]byte(fmt.Sprintf("%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+
+	batches := [][][]byte{}
+	err = reader.ScanBatch(0, 3, func(payloads [][]byte, o []uint32) error {
+		if len(payloads) != len(o) || o[0] != offsets[3*len(batches)] {
+			t.Fatalf("unexpected offsets %v", o)
+		}
+		for _, p := range payloads {
+			// copied out of the 4096 byte block
+			if cap(p) > 64 {
+				t.Fatalf("payload pins %d bytes", cap(p))
+			}
+		}
+		batches = append(batches, payloads)
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := fmt.Sprintf("%s", batches); got != "[[0 1 2] [3 4 5] [6 7 8] [9]]" {
+		t.Fatalf("unexpected batches %s", got)
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = reader.ScanBatch(0, 5, func(payloads [][]byte, o []uint32) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Fatalf("expected stop after one batch got %d %v", n, err)
+	}
+
+	// does not allocate for batchSize entries up front
+	err = reader.ScanBatch(0, math.MaxInt, func(payloads [][]byte, o []uint32) error {
+		if len(payloads) != 10 {
+			t.Fatalf("unexpected batch %d", len(payloads))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
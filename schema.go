@@ -0,0 +1,73 @@
+package pen
+
+import (
+	"bytes"
+	"errors"
+	"io"
+)
+
+// magic of the schema entry written by Writer.SetSchema, it is different from MAGIC so Scan skips the schema (unless ScanOptions.IncludeSchema is set)
+var SCHEMA_MAGIC = []byte{0x5, 0xc, 0xe, 0xa}
+
+// Write self describing schema (e.g. JSON with the payload format) as the first entry of the file, tools can read it with Reader.Schema.
+// It returns EINVAL if the file is not empty, or with WriterOptions.FixedSize or MultiProcess (the other processes can append before it).
+// The check and the write are atomic with the concurrent Appends, so either the schema is the first entry or it is not written at all.
+func (fw *Writer) SetSchema(schema []byte) error {
+	if fw.fixedSize > 0 || fw.opts.MultiProcess {
+		return EINVAL
+	}
+	_, _, err := fw.appendBlobAt(entryBlob(schema, SCHEMA_MAGIC), true)
+	return err
+}
+
+// Read the schema written with Writer.SetSchema, returns false if there is no schema (e.g. the file is empty, or starts with normal entry),
+// and EBADSLT if the schema is corrupted.
+func (ar *Reader) Schema() ([]byte, bool, error) {
+	header := make([]byte, 16)
+	_, err := readFullAt(ar.reader, header, 0)
+	if err == io.EOF {
+		return nil, false, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+	if !bytes.Equal(header[8:12], SCHEMA_MAGIC) {
+		return nil, false, nil
+	}
+	data, _, _, err := ar.readReserved(0)
+	if err != nil {
+		return nil, false, err
+	}
+	return data, true, nil
+}
+
+// returned by readEntry64 instead of EBADSLT if the header has the magic of a reserved entry, so Scan checks only them with readReserved,
+// the exported functions return EBADSLT for it
+var errReservedMagic = errors.New("reserved entry")
+
+func reservedMagic(magic []byte) bool {
+	return bytes.Equal(magic, SCHEMA_MAGIC) || bytes.Equal(magic, TRAILER_MAGIC) || bytes.Equal(magic, PADDING_MAGIC)
+}
+
+// Read valid entry with the magic of the schema, the file crc trailer or the alignment padding at offset, Scan skips them, instead of treating them as corruption.
+// Returns the data, the magic, next offset, and EBADSLT if there is no valid reserved entry.
+func (ar *Reader) readReserved(offset uint32) ([]byte, []byte, uint32, error) {
+	header := make([]byte, 16)
+	_, err := readFullAt(ar.reader, header, byteOffset(offset))
+	if err != nil {
+		return nil, nil, 0, EBADSLT
+	}
+	magic := header[8:12]
+	if !reservedMagic(magic) {
+		return nil, nil, 0, EBADSLT
+	}
+	opts := ar.opts
+	opts.SkipMagic = true
+	// they are always written with the data checksum in the header
+	opts.TrailingDataChecksum = false
+	data, err := readFromReader64(ar.reader, uint64(byteOffset(offset)), header, &opts)
+	if err != nil {
+		return nil, nil, 0, EBADSLT
+	}
+	return data, magic, nextOffset(offset, len(data)), nil
+}
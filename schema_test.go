@@ -0,0 +1,166 @@
+package pen
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"sync"
+	"testing"
+)
+
+func TestSchema(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	_, ok, err := reader.Schema()
+	if ok || err != nil {
+		t.Fatalf("unexpected %v %v", ok, err)
+	}
+
+	err = fw.SetSchema([]byte(`{"codec":"json"}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, garbage, err := reader.TailState()
+	if err != nil || garbage != 0 {
+		t.Fatalf("unexpected %d %v", garbage, err)
+	}
+	for i := 0; i < 10; i++ {
+		_, _, err := fw.Append([]byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	err = fw.SetSchema([]byte("again"))
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+
+	schema, ok, err := reader.Schema()
+	if !ok || err != nil || string(schema) != `{"codec":"json"}` {
+		t.Fatalf("unexpected %s %v %v", schema, ok, err)
+	}
+
+	for _, include := range []bool{false, true} {
+		n := 0
+		errs, err := reader.ScanCollectErrors(0, func(data []byte, offset, next uint32) error {
+			n++
+			return nil
+		})
+		if err != nil || len(errs) != 0 || n != 10 {
+			t.Fatalf("unexpected %d %v %v", n, errs, err)
+		}
+
+		entries := []string{}
+		err = reader.ScanWithOptions(0, ScanOptions{IncludeSchema: include}, func(data []byte, offset, next uint32) error {
+			entries = append(entries, string(data))
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := 10
+		if include {
+			expected = 11
+			if entries[0] != string(schema) {
+				t.Fatalf("expected schema first got %v", entries)
+			}
+		}
+		if len(entries) != expected {
+			t.Fatalf("expected %d got %d", expected, len(entries))
+		}
+	}
+
+	_, err = fw.file.WriteAt([]byte{0}, 20)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, ok, err = reader.Schema()
+	if ok || err != EBADSLT {
+		t.Fatalf("unexpected %v %v", ok, err)
+	}
+}
+
+func TestSchemaConcurrentAppend(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for i, opts := range []WriterOptions{{}, {FileCRC: true}, {OpenFlags: os.O_APPEND}} {
+		for j := 0; j < 20; j++ {
+			fn := path.Join(dir, "forward")
+			os.Remove(fn)
+			fw, err := NewWriterWithOptions(fn, opts)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var wg sync.WaitGroup
+			for k := 0; k < 4; k++ {
+				wg.Add(1)
+				go func() {
+					defer wg.Done()
+					for n := 0; n < 10; n++ {
+						if _, _, err := fw.Append([]byte("hello")); err != nil {
+							t.Error(err)
+						}
+					}
+				}()
+			}
+			schemaErr := fw.SetSchema([]byte("schema"))
+			wg.Wait()
+			fw.Close()
+			if schemaErr != nil && schemaErr != EINVAL {
+				t.Fatal(schemaErr)
+			}
+
+			reader, err := NewReader(fn, 0)
+			if err != nil {
+				t.Fatal(err)
+			}
+			schema, ok, err := reader.Schema()
+			if err != nil || ok != (schemaErr == nil) || (ok && string(schema) != "schema") {
+				t.Fatalf("options %d: unexpected %q %v %v after %v", i, schema, ok, err, schemaErr)
+			}
+			n := 0
+			errs, err := reader.ScanCollectErrors(0, func(data []byte, offset, next uint32) error {
+				n++
+				return nil
+			})
+			reader.Close()
+			if err != nil || len(errs) != 0 || n != 40 {
+				t.Fatalf("options %d: unexpected %d %v %v", i, n, errs, err)
+			}
+		}
+	}
+}
+
+func TestScanResyncReads(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	for _, size := range []int{1, 3000, 1} {
+		if _, _, err := fw.Append(make([]byte, size)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the header of the big entry, the scan resyncs through its 48 offsets
+	if _, err := fw.file.WriteAt([]byte{0xff}, byteOffset(1)+12); err != nil {
+		t.Fatal(err)
+	}
+	counting := &countingReaderAt{r: reader.reader}
+	reader.reader = counting
+	n := 0
+	err := reader.Scan(0, func(data []byte, offset, next uint32) error {
+		n++
+		return nil
+	})
+	if err != nil || n != 2 {
+		t.Fatalf("unexpected %d %v", n, err)
+	}
+	// one read per corrupted offset, the reserved magic is checked from it
+	if counting.reads > 60 {
+		t.Fatalf("expected about 50 reads got %d", counting.reads)
+	}
+}
@@ -0,0 +1,92 @@
+package pen
+
+import (
+	"context"
+	"io/ioutil"
+	"sync/atomic"
+	"time"
+)
+
+// Verify the checksums of every entry (including the large entries from Writer.AppendFrom) reading at most bytesPerSec bytes per second,
+// for background detection of bit rot before a read in the serving path finds it. Every corrupted region is passed to onCorruption (if not nil), the scrub does not stop on it,
+// and the bytes read to resync through it count towards bytesPerSec as well.
+// It is one pass from where the previous Scrub of this Reader stopped, when it reaches the end of the file it returns nil and the next Scrub starts from the beginning,
+// so run it in a loop to scrub continuously. If ctx is done it returns ctx.Err(), and the next Scrub continues from the entry after the last verified one,
+// use ScrubOffset and SetScrubOffset to keep the position across restarts. Do not run Scrub concurrently on the same Reader.
+func (ar *Reader) Scrub(ctx context.Context, bytesPerSec int64, onCorruption func(ChecksumError)) error {
+	if bytesPerSec <= 0 {
+		return EINVAL
+	}
+	if onCorruption == nil {
+		onCorruption = func(ChecksumError) {}
+	}
+	bucket := newTokenBucket(bytesPerSec)
+	wait := func(n int) error {
+		d := bucket.delay(n)
+		if d <= 0 {
+			return ctx.Err()
+		}
+		t := time.NewTimer(d)
+		defer t.Stop()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-t.C:
+			return nil
+		}
+	}
+
+	// onSkip can not stop the scan, so ctx.Err() from its wait is returned after it
+	var skipErr error
+	opts := ScanOptions{
+		onSkip: func(from, to uint32) {
+			onCorruption(ChecksumError{Offset: from, End: to})
+			if skipErr == nil {
+				skipErr = wait(int(byteOffset(to) - byteOffset(from)))
+			}
+		},
+		OnLargeEntry: func(offset, next uint32) error {
+			err := wait(int(byteOffset(next - offset)))
+			if err != nil {
+				return err
+			}
+			_, err = ar.WriteEntryTo(offset, ioutil.Discard)
+			if err == EBADSLT {
+				onCorruption(ChecksumError{Offset: offset, End: next})
+			} else if err != nil {
+				return err
+			}
+			atomic.StoreUint32(&ar.scrubOffset, next)
+			return nil
+		},
+	}
+	err := ar.ScanWithOptions(atomic.LoadUint32(&ar.scrubOffset), opts, func(data []byte, offset, next uint32) error {
+		if skipErr != nil {
+			return skipErr
+		}
+		err := wait(16 + len(data))
+		if err != nil {
+			return err
+		}
+		atomic.StoreUint32(&ar.scrubOffset, next)
+		return nil
+	})
+	if err == nil {
+		err = skipErr
+	}
+	if err != nil {
+		return err
+	}
+	atomic.StoreUint32(&ar.scrubOffset, 0)
+	return nil
+}
+
+// Offset where the next Scrub starts
+func (ar *Reader) ScrubOffset() uint32 {
+	return atomic.LoadUint32(&ar.scrubOffset)
+}
+
+// Set the offset where the next Scrub starts (e.g. ScrubOffset saved before a restart), it must be an entry offset
+func (ar *Reader) SetScrubOffset(offset uint32) {
+	atomic.StoreUint32(&ar.scrubOffset, offset)
+}
@@ -0,0 +1,103 @@
+package pen
+
+import (
+	"bytes"
+	"context"
+	"testing"
+	"time"
+)
+
+func TestScrub(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	offsets := []uint32{}
+	for i := 0; i < 20; i++ {
+		off, _, err := fw.Append(make([]byte, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	large, _, err := fw.AppendFrom(bytes.NewReader(make([]byte, 1000)), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, pos := range []int64{byteOffset(offsets[3]) + 20, byteOffset(offsets[15]) + 20, byteOffset(large) + 100} {
+		_, err := fw.file.WriteAt([]byte{1}, pos)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if err := reader.Scrub(context.Background(), 0, nil); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+
+	// slow enough to be cancelled after the burst
+	found := []ChecksumError{}
+	onCorruption := func(e ChecksumError) {
+		found = append(found, e)
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 20*time.Millisecond)
+	defer cancel()
+	err = reader.Scrub(ctx, 10000, onCorruption)
+	if err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline got %v", err)
+	}
+	resume := reader.ScrubOffset()
+	if resume <= offsets[3] || resume > offsets[15] {
+		t.Fatalf("unexpected resume offset %d", resume)
+	}
+	if len(found) != 1 || found[0].Offset != offsets[3] {
+		t.Fatalf("unexpected corruption %v", found)
+	}
+
+	err = reader.Scrub(context.Background(), 1<<30, onCorruption)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reader.ScrubOffset() != 0 {
+		t.Fatalf("expected to start again from 0 got %d", reader.ScrubOffset())
+	}
+	if len(found) != 3 || found[1] != (ChecksumError{Offset: offsets[15], End: offsets[16]}) || found[2].Offset != large {
+		t.Fatalf("unexpected corruption %v", found)
+	}
+
+	reader.SetScrubOffset(offsets[16])
+	found = found[:0]
+	err = reader.Scrub(context.Background(), 1<<30, onCorruption)
+	if err != nil || len(found) != 1 || found[0].Offset != large {
+		t.Fatalf("unexpected corruption %v %v", found, err)
+	}
+}
+
+func TestScrubThrottlesCorruption(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	if _, _, err := fw.Append(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+	// 20KB of garbage, at 10KB per second the resync through it takes 2 seconds
+	garbage, _, err := fw.Append(make([]byte, 20000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := fw.file.WriteAt([]byte{1}, byteOffset(garbage)+20); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := fw.Append(make([]byte, 100)); err != nil {
+		t.Fatal(err)
+	}
+
+	// nil onCorruption just ignores the corruption
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	if err := reader.Scrub(ctx, 10000, nil); err != context.DeadlineExceeded {
+		t.Fatalf("expected deadline got %v", err)
+	}
+	if err := reader.Scrub(context.Background(), 1<<30, nil); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,53 @@
+package pen
+
+import (
+	"io"
+	"sync"
+)
+
+// io.ReaderAt on top of io.ReadSeeker, every ReadAt is Seek+Read under a mutex
+type seekerReaderAt struct {
+	lock sync.Mutex
+	rs   io.ReadSeeker
+}
+
+func (s *seekerReaderAt) ReadAt(p []byte, off int64) (int, error) {
+	if off < 0 {
+		return 0, EINVAL
+	}
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	if _, err := s.rs.Seek(off, io.SeekStart); err != nil {
+		return 0, err
+	}
+	n, err := io.ReadFull(s.rs, p)
+	if err == io.ErrUnexpectedEOF {
+		err = io.EOF
+	}
+	return n, err
+}
+
+// size from seeking to the end, 0 if the seek fails
+func (s *seekerReaderAt) Size() int64 {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	size, err := s.rs.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0
+	}
+	return size
+}
+
+func (s *seekerReaderAt) Close() error {
+	if c, ok := s.rs.(io.Closer); ok {
+		return c.Close()
+	}
+	return nil
+}
+
+// Same as NewReaderFromReaderAt but for backends that only implement io.ReadSeeker, the size is known by seeking to the end
+// and Close calls its Close if it has one. Reads are serialized by an internal mutex (seek+read), so unlike the io.ReaderAt path
+// concurrent Read/Scan calls do not run in parallel, and nothing else must use the io.ReadSeeker while the Reader is in use.
+func NewReaderFromSeeker(rs io.ReadSeeker, blockSize int, opts ReaderOptions) (*Reader, error) {
+	return NewReaderFromReaderAt(&seekerReaderAt{rs: rs}, blockSize, opts)
+}
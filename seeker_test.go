@@ -0,0 +1,88 @@
+package pen
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"sync"
+	"testing"
+)
+
+// hides the ReadAt of bytes.Reader
+type onlySeeker struct {
+	io.ReadSeeker
+	closed bool
+}
+
+func (s *onlySeeker) Close() error {
+	s.closed = true
+	return nil
+}
+
+func TestNewReaderFromSeeker(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	var offsets []uint32
+	for i := 0; i < 100; i++ {
+		off, _, err := fw.Append([]byte(RandStringRunes(i * 3)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	b, err := ioutil.ReadFile(reader.file.Name())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	rs := &onlySeeker{ReadSeeker: bytes.NewReader(b)}
+	sr, err := NewReaderFromSeeker(rs, 64, ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReaderFromSeeker(rs, 8, ReaderOptions{}); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+
+	var wg sync.WaitGroup
+	for w := 0; w < 4; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i, off := range offsets {
+				expected, _, err := reader.Read(off)
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				data, _, err := sr.Read(off)
+				if err != nil || !bytes.Equal(data, expected) {
+					t.Errorf("entry %d mismatch: %v", i, err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	n := 0
+	err = sr.Scan(0, func(data []byte, offset, next uint32) error {
+		if offset != offsets[n] {
+			t.Fatalf("expected %d got %d", offsets[n], offset)
+		}
+		n++
+		return nil
+	})
+	if err != nil || n != len(offsets) {
+		t.Fatalf("scanned %d err %v", n, err)
+	}
+
+	empty, err := sr.IsEmpty()
+	if err != nil || empty {
+		t.Fatalf("expected not empty got %v %v", empty, err)
+	}
+	if err := sr.Close(); err != nil || !rs.closed {
+		t.Fatalf("expected close got %v", err)
+	}
+}
@@ -0,0 +1,231 @@
+package pen
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync/atomic"
+)
+
+// Sync and close the current file, and continue writing to the next segment, which is opened with the same WriterOptions (and O_EXCL, so an existing segment is never appended to).
+// The next segment has the same name with the trailing number incremented (keeping the zero padding), e.g. log.0009 is followed by log.0010, and log by log.1.
+// The offsets are per segment and start from 0 in the new one, so to address an entry globally keep the segment path (or number) together with the offset,
+// and scan the segments in order with ScanDir.
+// If the new segment can not be created, or the current file can not be synced (or its crc trailer written), the error is returned and the Writer
+// keeps appending to the current file. If only closing the old file fails after that, the Writer already continues with the new segment, and both are returned.
+// It is not safe to call concurrently with Append, unless MaxSegmentBytes is set.
+func (fw *Writer) Rotate() (string, error) {
+	fw.segmentLock.Lock()
+	defer fw.segmentLock.Unlock()
+	return fw.rotate()
+}
+
+// must be called with segmentLock, so there are no appends in progress
+func (fw *Writer) rotate() (string, error) {
+	name := nextSegmentName(fw.file.Name())
+	opts := fw.opts
+	opts.Exclusive = true
+	next, err := NewWriterWithOptions(name, opts)
+	if err != nil {
+		return "", err
+	}
+
+	// finish the old segment without closing it, so it is still usable if anything fails
+	err = fw.file.Sync()
+	if err == nil && fw.fileCRC {
+		err = fw.writeTrailer()
+		if err == nil {
+			err = fw.file.Sync()
+		}
+	}
+	if err != nil {
+		next.Close()
+		// the next rotate creates it again with O_EXCL
+		os.Remove(name)
+		return "", err
+	}
+
+	fw.appendLock.Lock()
+	old := fw.file
+	fw.file = next.file
+	atomic.StoreUint32(&fw.offset, next.offset)
+	fw.written.reset(next.offset)
+	atomic.StoreUint32(&fw.durable, next.offset)
+	fw.end = next.end
+	fw.crc = next.crc
+	fw.appendLock.Unlock()
+	return name, old.Close()
+}
+
+// rotate if appending data with this length would make the file bigger than MaxSegmentBytes, must be called with segmentLock
+func (fw *Writer) rotateIfFull(dataLen int) error {
+	offset := atomic.LoadUint32(&fw.offset)
+	current := byteOffset(offset)
+	size := int64(nextOffset(0, dataLen)) * int64(PAD)
+	if fw.fixedSize > 0 {
+		current = int64(offset) * fixedRecordSize(fw.fixedSize)
+		size = fixedRecordSize(fw.fixedSize)
+	}
+	if current == 0 || current+size <= fw.opts.MaxSegmentBytes {
+		return nil
+	}
+	_, err := fw.rotate()
+	return err
+}
+
+func nextSegmentName(name string) string {
+	dir, base := filepath.Split(name)
+	prefix := strings.TrimRight(base, "0123456789")
+	digits := base[len(prefix):]
+	if digits == "" {
+		return filepath.Join(dir, base+".1")
+	}
+	n, err := strconv.ParseUint(digits, 10, 64)
+	if err != nil {
+		// too many digits
+		return filepath.Join(dir, base+".1")
+	}
+	next := strconv.FormatUint(n+1, 10)
+	if len(next) < len(digits) {
+		next = strings.Repeat("0", len(digits)-len(next)) + next
+	}
+	return filepath.Join(dir, prefix+next)
+}
+
+// Position of an entry in rotated log, Segment is the number at the end of the segment file name
+type GlobalPos struct {
+	Segment int
+	Offset  uint32
+}
+
+// error with the segment that could not be read (missing in the sequence, or failed to open or scan)
+type SegmentError struct {
+	Segment int
+	Err     error
+}
+
+func (e *SegmentError) Error() string {
+	return fmt.Sprintf("segment %d: %v", e.Segment, e.Err)
+}
+
+func (e *SegmentError) Unwrap() error {
+	return e.Err
+}
+
+// Options for ScanDirWithOptions, the zero value is the same as ScanDir
+type ScanDirOptions struct {
+	// stop on the first bad segment, instead of continuing with the next one
+	StopOnError bool
+
+	// called for every bad segment (missing number in the sequence, or failed to open or scan)
+	OnError func(*SegmentError)
+}
+
+// Scan all segments written by Writer.Rotate (files ending with number, e.g. log.0001, log.0002) in dir in order, as one stream of entries.
+// The directory is listed once at the start, segments created during the scan are not scanned, and it should contain the segments of only one log.
+// Bad segments are skipped, and the first one is returned as *SegmentError after all the others are scanned, if the callback returns error the scan stops with it.
+// If the first segment is not numbered (the writer was created with log, and rotated to log.1), it is scanned as segment 0.
+func ScanDir(dir string, blockSize int, cb func([]byte, GlobalPos) error) error {
+	return ScanDirWithOptions(dir, blockSize, ScanDirOptions{}, cb)
+}
+
+// Same as ScanDir but with options
+func ScanDirWithOptions(dir string, blockSize int, opts ScanDirOptions, cb func([]byte, GlobalPos) error) error {
+	segments, err := listSegments(dir)
+	if err != nil {
+		return err
+	}
+
+	var first *SegmentError
+	bad := func(segment int, err error) bool {
+		e := &SegmentError{Segment: segment, Err: err}
+		if opts.OnError != nil {
+			opts.OnError(e)
+		}
+		if first == nil {
+			first = e
+		}
+		return opts.StopOnError
+	}
+
+	for i, s := range segments {
+		if i > 0 {
+			for missing := segments[i-1].number + 1; missing < s.number; missing++ {
+				if bad(missing, os.ErrNotExist) {
+					return first
+				}
+			}
+		}
+
+		var cbErr error
+		err := scanSegment(filepath.Join(dir, s.name), blockSize, func(data []byte, offset, next uint32) error {
+			cbErr = cb(data, GlobalPos{Segment: s.number, Offset: offset})
+			return cbErr
+		})
+		if cbErr != nil {
+			return cbErr
+		}
+		if err != nil && bad(s.number, err) {
+			return first
+		}
+	}
+	if first != nil {
+		return first
+	}
+	return nil
+}
+
+func scanSegment(filename string, blockSize int, cb func([]byte, uint32, uint32) error) error {
+	r, err := NewReader(filename, blockSize)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+	return r.Scan(0, cb)
+}
+
+type segmentFile struct {
+	name   string
+	number int
+}
+
+// files in dir ending with number, sorted by it, and the file without number that Rotate continued as name.1, name.2.. as segment 0
+func listSegments(dir string) ([]segmentFile, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	segments := []segmentFile{}
+	unnumbered := map[string]bool{}
+	first := ""
+	hasZero := false
+	for _, e := range entries {
+		if e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		prefix := strings.TrimRight(name, "0123456789")
+		n, err := strconv.Atoi(name[len(prefix):])
+		if err != nil {
+			if prefix == name {
+				unnumbered[name] = true
+			}
+			continue
+		}
+		hasZero = hasZero || n == 0
+		if strings.HasSuffix(prefix, ".") {
+			first = strings.TrimSuffix(prefix, ".")
+		}
+		segments = append(segments, segmentFile{name: name, number: n})
+	}
+	if !hasZero && unnumbered[first] {
+		segments = append(segments, segmentFile{name: first, number: 0})
+	}
+	sort.Slice(segments, func(i, j int) bool {
+		return segments[i].number < segments[j].number
+	})
+	return segments, nil
+}
@@ -0,0 +1,309 @@
+package pen
+
+import (
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestNextSegmentName(t *testing.T) {
+	cases := map[string]string{
+		"log":         "log.1",
+		"/a/log.1":    "/a/log.2",
+		"/a/log.0009": "/a/log.0010",
+		"/a/log.99":   "/a/log.100",
+		"/a/0":        "/a/1",
+	}
+	for in, expected := range cases {
+		if got := nextSegmentName(in); got != expected {
+			t.Fatalf("%s: expected %s got %s", in, expected, got)
+		}
+	}
+}
+
+func TestRotate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriterWithOptions(path.Join(dir, "log.000"), WriterOptions{MaxSegmentBytes: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	segments := []string{path.Join(dir, "log.000")}
+	counts := []int{0}
+	for i := 0; i < 100; i++ {
+		off, _, err := w.Append(make([]byte, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if off == 0 && i > 0 {
+			segments = append(segments, w.file.Name())
+			counts = append(counts, 0)
+		}
+		counts[len(counts)-1]++
+	}
+	name, err := w.Rotate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	off, _, err := w.Append([]byte("hello"))
+	if err != nil || off != 0 {
+		t.Fatalf("unexpected %d %v", off, err)
+	}
+	w.Close()
+
+	// 128 bytes per entry, 7 fit in 1000 bytes
+	if len(segments) != 15 {
+		t.Fatalf("expected 15 segments got %v", segments)
+	}
+	if segments[1] != path.Join(dir, "log.001") || name != path.Join(dir, "log.015") {
+		t.Fatalf("unexpected names %v %s", segments, name)
+	}
+	for i, fn := range segments {
+		s, err := os.Stat(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if s.Size() > 1000 {
+			t.Fatalf("%s: too big %d", fn, s.Size())
+		}
+		r, err := NewReader(fn, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		n := 0
+		err = r.Scan(0, func(data []byte, offset, next uint32) error {
+			n++
+			return nil
+		})
+		r.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if n != counts[i] {
+			t.Fatalf("%s: expected %d got %d", fn, counts[i], n)
+		}
+	}
+
+	// the next segment must not exist
+	w, err = NewWriter(path.Join(dir, "log.014"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	_, err = w.Rotate()
+	if !os.IsExist(err) {
+		t.Fatalf("expected exist error got %v", err)
+	}
+	_, _, err = w.Append([]byte("still works"))
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestRotateTrailerError(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "log.0")
+
+	w, err := NewWriterWithOptions(fn, WriterOptions{FileCRC: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer w.Close()
+	if _, _, err := w.Append([]byte("first")); err != nil {
+		t.Fatal(err)
+	}
+
+	// the crc trailer can not be written to read only file
+	file := w.file
+	readOnly, err := os.Open(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.file = readOnly
+	if _, err := w.Rotate(); err == nil {
+		t.Fatal("expected error")
+	}
+	if w.file != readOnly {
+		t.Fatal("expected the old file")
+	}
+	if _, err := readOnly.Stat(); err != nil {
+		t.Fatalf("the old file was closed %v", err)
+	}
+	if _, err := os.Stat(path.Join(dir, "log.1")); !os.IsNotExist(err) {
+		t.Fatalf("expected the new segment to be removed got %v", err)
+	}
+	readOnly.Close()
+	w.file = file
+
+	if _, _, err := w.Append([]byte("second")); err != nil {
+		t.Fatal(err)
+	}
+	name, err := w.Rotate()
+	if err != nil || name != path.Join(dir, "log.1") {
+		t.Fatalf("unexpected %s %v", name, err)
+	}
+	r, err := NewReader(fn, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer r.Close()
+	if err := r.VerifyFileCRC(); err != nil {
+		t.Fatal(err)
+	}
+	n := 0
+	if err := r.Scan(0, func(data []byte, offset, next uint32) error { n++; return nil }); err != nil || n != 2 {
+		t.Fatalf("expected 2 entries got %d %v", n, err)
+	}
+}
+
+func TestScanDir(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriterWithOptions(path.Join(dir, "log.08"), WriterOptions{MaxSegmentBytes: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{}
+	bySegment := map[int][]string{}
+	segment := 8
+	for i := 0; i < 50; i++ {
+		data := fmt.Sprintf("%d", i)
+		off, _, err := w.Append([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if off == 0 && i > 0 {
+			segment++
+		}
+		e := fmt.Sprintf("%s@%v", data, GlobalPos{Segment: segment, Offset: off})
+		expected = append(expected, e)
+		bySegment[segment] = append(bySegment[segment], e)
+	}
+	w.Close()
+	if segment != 11 {
+		t.Fatalf("expected 4 segments, last %d", segment)
+	}
+	// not a segment
+	err = ioutil.WriteFile(path.Join(dir, "README"), []byte("hello"), 0600)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scan := func(opts ScanDirOptions) ([]string, []*SegmentError, error) {
+		got := []string{}
+		bad := []*SegmentError{}
+		opts.OnError = func(e *SegmentError) {
+			bad = append(bad, e)
+		}
+		err := ScanDirWithOptions(dir, 0, opts, func(data []byte, pos GlobalPos) error {
+			got = append(got, fmt.Sprintf("%s@%v", data, pos))
+			return nil
+		})
+		return got, bad, err
+	}
+
+	got, bad, err := scan(ScanDirOptions{})
+	if err != nil || len(bad) != 0 {
+		t.Fatalf("unexpected %v %v", bad, err)
+	}
+	if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", expected) {
+		t.Fatalf("expected %v got %v", expected, got)
+	}
+
+	// missing segment is reported, the rest is still scanned unless StopOnError
+	err = os.Remove(path.Join(dir, "log.09"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	withoutNine := append(append(append([]string{}, bySegment[8]...), bySegment[10]...), bySegment[11]...)
+	for _, stop := range []bool{false, true} {
+		got, bad, err = scan(ScanDirOptions{StopOnError: stop})
+		var serr *SegmentError
+		if !errors.As(err, &serr) || serr.Segment != 9 || !errors.Is(err, os.ErrNotExist) || len(bad) != 1 {
+			t.Fatalf("unexpected %v %v", bad, err)
+		}
+		want := withoutNine
+		if stop {
+			want = bySegment[8]
+		}
+		if fmt.Sprintf("%v", got) != fmt.Sprintf("%v", want) {
+			t.Fatalf("stop %v: expected %v got %v", stop, want, got)
+		}
+	}
+
+	stop := errors.New("stop")
+	n := 0
+	err = ScanDir(dir, 0, func(data []byte, pos GlobalPos) error {
+		n++
+		return stop
+	})
+	if err != stop || n != 1 {
+		t.Fatalf("unexpected %d %v", n, err)
+	}
+}
+
+func TestScanDirUnnumberedFirstSegment(t *testing.T) {
+	dir, err := ioutil.TempDir("", "forward")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	w, err := NewWriter(path.Join(dir, "log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{}
+	for segment := 0; segment < 3; segment++ {
+		off, _, err := w.Append([]byte(fmt.Sprintf("%d", segment)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, fmt.Sprintf("%d@%v", segment, GlobalPos{Segment: segment, Offset: off}))
+		if segment < 2 {
+			if _, err := w.Rotate(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	w.Close()
+
+	scan := func() ([]string, error) {
+		got := []string{}
+		err := ScanDir(dir, 0, func(data []byte, pos GlobalPos) error {
+			got = append(got, fmt.Sprintf("%s@%v", data, pos))
+			return nil
+		})
+		return got, err
+	}
+	got, err := scan()
+	if err != nil || fmt.Sprintf("%v", got) != fmt.Sprintf("%v", expected) {
+		t.Fatalf("expected %v got %v %v", expected, got, err)
+	}
+
+	// the first segment is still found without log.1, which is reported missing
+	err = os.Remove(path.Join(dir, "log.1"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, err = scan()
+	var serr *SegmentError
+	if !errors.As(err, &serr) || serr.Segment != 1 || fmt.Sprintf("%v", got) != fmt.Sprintf("%v", []string{expected[0], expected[2]}) {
+		t.Fatalf("unexpected %v %v", got, err)
+	}
+}
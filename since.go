@@ -0,0 +1,71 @@
+package pen
+
+import (
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"io"
+)
+
+// returned by ScanSince when the acked entry is not in the file anymore (the file was replaced, truncated or rewritten)
+var ErrLogRewritten = errors.New("log was rewritten")
+
+// Resumable scan for incremental consumers, token identifies the last acked entry by its offset and data checksum (empty token starts from the beginning).
+// ScanSince checks that the entry at the token offset still has the same data before it continues after it, otherwise it returns ErrLogRewritten
+// (so a replaced file is not consumed from a random offset), EINVAL for malformed token.
+// cb returns the new ack token for the entry it processed, SinceToken(data, offset) is the token of the entry, persist it and pass it to the next ScanSince.
+// Return empty ack to not acknowledge the entry, a malformed ack stops the scan with EINVAL so it is not persisted by mistake.
+func (ar *Reader) ScanSince(token string, cb func([]byte, uint32, uint32) (ack string, err error)) error {
+	offset := uint32(0)
+	if token != "" {
+		acked, checksum, err := decodeSinceToken(token)
+		if err != nil {
+			return err
+		}
+		data, next, err := ar.Read(acked)
+		if err == nil && uint32(Hash(data)) != checksum {
+			err = ErrLogRewritten
+		}
+		if err == EBADSLT || err == ErrTruncated || err == io.EOF {
+			err = ErrLogRewritten
+		}
+		if err != nil {
+			return err
+		}
+		offset = next
+	}
+
+	return ar.Scan(offset, func(data []byte, offset, next uint32) error {
+		ack, err := cb(data, offset, next)
+		if err != nil {
+			return err
+		}
+		if ack != "" {
+			if _, _, err := decodeSinceToken(ack); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Returns the ScanSince ack token of the entry with this data at offset.
+func SinceToken(data []byte, offset uint32) string {
+	return encodeSinceToken(offset, uint32(Hash(data)))
+}
+
+func encodeSinceToken(offset, checksum uint32) string {
+	b := make([]byte, 12)
+	binary.LittleEndian.PutUint32(b, offset)
+	binary.LittleEndian.PutUint32(b[4:], checksum)
+	binary.LittleEndian.PutUint32(b[8:], uint32(Hash(b[:8])))
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func decodeSinceToken(token string) (uint32, uint32, error) {
+	b, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(b) != 12 || binary.LittleEndian.Uint32(b[8:]) != uint32(Hash(b[:8])) {
+		return 0, 0, EINVAL
+	}
+	return binary.LittleEndian.Uint32(b), binary.LittleEndian.Uint32(b[4:]), nil
+}
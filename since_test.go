@@ -0,0 +1,77 @@
+package pen
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestScanSince(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	for i := 0; i < 10; i++ {
+		_, _, err := fw.Append([]byte(fmt.Sprintf("entry %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	stop := errors.New("stop")
+	seen := []string{}
+	consume := func(token string, limit int) (string, error) {
+		err := reader.ScanSince(token, func(data []byte, offset, next uint32) (string, error) {
+			if len(seen) == limit {
+				return "", stop
+			}
+			seen = append(seen, string(data))
+			token = SinceToken(data, offset)
+			return token, nil
+		})
+		return token, err
+	}
+	token, err := consume("", 5)
+	if err != stop || len(seen) != 5 || token == "" {
+		t.Fatalf("unexpected %v %v", seen, err)
+	}
+	token, err = consume(token, 100)
+	if err != nil || len(seen) != 10 || seen[5] != "entry 5" || seen[9] != "entry 9" {
+		t.Fatalf("unexpected %v %v", seen, err)
+	}
+
+	// nothing new
+	again, err := consume(token, 100)
+	if err != nil || again != token || len(seen) != 10 {
+		t.Fatalf("unexpected %v %v", seen, err)
+	}
+
+	if err := reader.ScanSince("not a token", nil); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+	err = reader.ScanSince("", func(data []byte, offset, next uint32) (string, error) {
+		return "bad ack", nil
+	})
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+
+	// rewrite the file with different entries at the same offsets
+	if err := fw.TruncateTo(0); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		_, _, err := fw.Append([]byte(fmt.Sprintf("other %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := consume(token, 100); err != ErrLogRewritten {
+		t.Fatalf("expected ErrLogRewritten got %v", err)
+	}
+	if err := fw.TruncateTo(0); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := consume(token, 100); err != ErrLogRewritten {
+		t.Fatalf("expected ErrLogRewritten got %v", err)
+	}
+}
@@ -0,0 +1,103 @@
+package pen
+
+import (
+	"hash/crc32"
+	"io"
+)
+
+type payloadStream struct {
+	r       *Reader
+	offset  uint32
+	current []byte
+	err     error
+
+	// the large entry being streamed, its data is read directly into p instead of into memory
+	large      int64
+	largeStart int64
+	largeCRC   uint32
+	computed   uint32
+	largeAt    uint32
+}
+
+// Returns io.Reader of all the data from offset until the end of the file concatenated (without the headers), the entries are read lazily.
+// By design the boundaries between the entries are lost. The schema, the file crc trailer and the padding entries are skipped as Scan skips them,
+// the data of large entries (Writer.AppendFrom) is streamed in chunks, same as WriteEntryTo.
+// Unlike Scan, corruption is not skipped, on the first corrupted entry Read returns ChecksumError.
+// example:
+//	_, err = io.Copy(gzipWriter, r.PayloadStream(0))
+func (ar *Reader) PayloadStream(offset uint32) io.Reader {
+	return &payloadStream{r: ar, offset: offset}
+}
+
+func (s *payloadStream) Read(p []byte) (int, error) {
+	if s.large > 0 {
+		return s.readLarge(p)
+	}
+	for len(s.current) == 0 {
+		if s.err != nil {
+			return 0, s.err
+		}
+		data, next, err := s.r.Read(s.offset)
+		if err == ErrLargeEntry {
+			length, crc, next, err := readLargeHeader(s.r.reader, s.offset)
+			if err == nil && !s.r.afterHighWater(s.offset, next) {
+				s.large = length
+				s.largeStart = byteOffset(s.offset) + largeHeaderSize
+				s.largeCRC = crc
+				s.computed = 0
+				s.largeAt = s.offset
+				s.offset = next
+				if s.large == 0 {
+					continue
+				}
+				return s.readLarge(p)
+			}
+			err = EBADSLT
+		}
+		if err == EBADSLT && s.r.opts.FixedSize == 0 {
+			// the reserved entries are valid, they just do not have payload
+			_, _, next, rerr := s.r.readReserved(s.offset)
+			if rerr == nil && !s.r.afterHighWater(s.offset, next) {
+				s.offset = next
+				continue
+			}
+		}
+		if err == EBADSLT {
+			s.err = ChecksumError{Offset: s.offset}
+			continue
+		}
+		if err != nil {
+			s.err = err
+			continue
+		}
+		s.current = data
+		s.offset = next
+	}
+
+	n := copy(p, s.current)
+	s.current = s.current[n:]
+	return n, nil
+}
+
+func (s *payloadStream) readLarge(p []byte) (int, error) {
+	if int64(len(p)) > s.large {
+		p = p[:s.large]
+	}
+	n, err := readFullAt(s.r.reader, p, s.largeStart)
+	if n < len(p) {
+		if err == io.EOF {
+			err = ErrTruncated
+		}
+		s.large = 0
+		s.err = readError(s.largeAt, err)
+		return n, s.err
+	}
+	s.computed = crc32.Update(s.computed, crc32.IEEETable, p)
+	s.largeStart += int64(n)
+	s.large -= int64(n)
+	if s.large == 0 && s.computed != s.largeCRC {
+		s.err = ChecksumError{Offset: s.largeAt}
+		return n, s.err
+	}
+	return n, nil
+}
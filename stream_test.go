@@ -0,0 +1,132 @@
+package pen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestPayloadStream(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	expected := []byte{}
+	for i := 0; i < 100; i++ {
+		data := []byte(RandStringRunes(i))
+		_, _, err := fw.Append(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, data...)
+	}
+
+	data, err := ioutil.ReadAll(reader.PayloadStream(0))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Fatal("data mismatch")
+	}
+
+	off, _, err := fw.Append([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fw.file.WriteAt([]byte("j"), byteOffset(off)+16)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err = ioutil.ReadAll(reader.PayloadStream(0))
+	if !errors.Is(err, EBADSLT) {
+		t.Fatalf("expected checksum error got %v", err)
+	}
+	var cerr ChecksumError
+	if !errors.As(err, &cerr) || cerr.Offset != off {
+		t.Fatalf("expected checksum error at %d got %v", off, err)
+	}
+	if !bytes.Equal(data, expected) {
+		t.Fatal("data mismatch")
+	}
+}
+
+func TestPayloadStreamSkipsReservedEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "stream")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	for _, opts := range []WriterOptions{{}, {FileCRC: true}} {
+		fn := path.Join(dir, fmt.Sprintf("stream_%v", opts.FileCRC))
+		w, err := NewWriterWithOptions(fn, opts)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = w.SetSchema([]byte("schema"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		expected := []byte{}
+		for i := 0; i < 20; i++ {
+			data := []byte(RandStringRunes(i * 7))
+			if _, _, err := w.Append(data); err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected, data...)
+			if i == 10 && !opts.FileCRC {
+				if _, _, err := w.AppendReserved(100); err != nil {
+					t.Fatal(err)
+				}
+			}
+			if i == 15 && !opts.FileCRC {
+				// AppendReserved and AppendFrom do not work with FileCRC
+				large := bytes.Repeat([]byte("large"), 1000)
+				if _, _, err := w.AppendFrom(bytes.NewReader(large), int64(len(large))); err != nil {
+					t.Fatal(err)
+				}
+				expected = append(expected, large...)
+			}
+		}
+		if err := w.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		r, err := NewReader(fn, 0)
+		if err != nil {
+			t.Fatal(err)
+		}
+		// ReadAll starts with small buffers, so the large entry is streamed in parts
+		data, err := ioutil.ReadAll(r.PayloadStream(0))
+		r.Close()
+		if err != nil {
+			t.Fatalf("file crc %v: %v", opts.FileCRC, err)
+		}
+		if !bytes.Equal(data, expected) {
+			t.Fatalf("file crc %v: data mismatch %d %d", opts.FileCRC, len(data), len(expected))
+		}
+	}
+}
+
+func TestPayloadStreamLargeEntryCorruption(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	large := bytes.Repeat([]byte("large"), 1000)
+	off, _, err := fw.AppendFrom(bytes.NewReader(large), int64(len(large)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = fw.file.WriteAt([]byte("j"), byteOffset(off)+largeHeaderSize+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, err = ioutil.ReadAll(reader.PayloadStream(0))
+	var cerr ChecksumError
+	if !errors.As(err, &cerr) || cerr.Offset != off {
+		t.Fatalf("expected checksum error at %d got %v", off, err)
+	}
+}
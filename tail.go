@@ -0,0 +1,95 @@
+package pen
+
+import (
+	"errors"
+	"os"
+)
+
+// returned by RecoverFile when the file is not empty, but there is no valid entry in it (e.g. it is not a pen file, or it was opened with the wrong options)
+var ErrNoValidEntry = errors.New("no valid entry in the file")
+
+// Find the end of the last valid entry, and how many bytes there are after it (torn entry from crashed writer, garbage).
+// returns the next offset after the last valid entry (0 if there are none), the amount of garbage bytes after it, and error.
+// To make the file clean again truncate it to lastGoodOffset (Writer.TruncateTo).
+func (ar *Reader) TailState() (uint32, int64, error) {
+	size, err := ar.size()
+	if err != nil {
+		return 0, 0, err
+	}
+
+	lastGood := uint32(0)
+	opts := ScanOptions{
+		IncludeSchema: true,
+		OnLargeEntry: func(offset, next uint32) error {
+			lastGood = next
+			return nil
+		},
+	}
+	err = ar.ScanWithOptions(0, opts, func(data []byte, offset, next uint32) error {
+		lastGood = next
+		return nil
+	})
+	if err != nil {
+		return 0, 0, err
+	}
+
+	// the last entry is not padded, so the file usually ends before byteOffset(lastGood)
+	garbage := size - ar.endByte(lastGood)
+	if garbage < 0 || (ar.opts.FixedSize == 0 && ar.trailerAt(lastGood)) {
+		// the file crc trailer is not garbage
+		garbage = 0
+	}
+	return lastGood, garbage, nil
+}
+
+// position in bytes of offset, the fixed size records are not PAD aligned
+func (ar *Reader) endByte(offset uint32) int64 {
+	if ar.opts.FixedSize > 0 {
+		return int64(offset) * fixedRecordSize(ar.opts.FixedSize)
+	}
+	return byteOffset(offset)
+}
+
+// Recover a file after a crash: open it read-write, find the end of the last valid entry (TailState) and truncate the torn entry or garbage after it,
+// so a Writer can continue appending after the last good entry. Returns the next offset after the last valid entry and how many bytes were truncated,
+// if the file is already clean it is not modified and truncatedBytes is 0. Do not call it while a Writer has the file open.
+// opts must be the options the file is read with (FixedSize, TrailingDataChecksum, SkipMagic..), otherwise the valid entries look like garbage,
+// so if there is no valid entry but the file is not empty it returns ErrNoValidEntry and does not touch the file.
+func RecoverFile(filename string, blockSize int, opts ReaderOptions) (lastGoodOffset uint32, truncatedBytes int64, err error) {
+	if blockSize == 0 {
+		blockSize = 16
+	}
+	if blockSize < 16 {
+		return 0, 0, EINVAL
+	}
+
+	fd, err := os.OpenFile(filename, os.O_RDWR, 0600)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer fd.Close()
+
+	// the garbage is what we are here to remove
+	opts.CheckTail = false
+	ar, err := newReader(fd, fd, blockSize, opts)
+	if err != nil {
+		return 0, 0, err
+	}
+	lastGood, garbage, err := ar.TailState()
+	if err != nil || garbage == 0 {
+		return lastGood, 0, err
+	}
+	if lastGood == 0 {
+		return 0, 0, ErrNoValidEntry
+	}
+
+	err = fd.Truncate(ar.endByte(lastGood))
+	if err != nil {
+		return 0, 0, err
+	}
+	err = fd.Sync()
+	if err != nil {
+		return 0, 0, err
+	}
+	return lastGood, garbage, nil
+}
@@ -0,0 +1,469 @@
+package pen
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+)
+
+func TestTailState(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	lastGood, garbage, err := reader.TailState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastGood != 0 || garbage != 0 {
+		t.Fatalf("unexpected tail state %d %d", lastGood, garbage)
+	}
+
+	var next uint32
+	for i := 0; i < 10; i++ {
+		_, next, err = fw.Append([]byte(RandStringRunes(i * 10)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	checked, err := NewReaderWithOptions(reader.file.Name(), 0, ReaderOptions{CheckTail: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	checked.Close()
+
+	torn, _, err := fw.Append(make([]byte, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, cut := range []int64{500, 5} {
+		err = os.Truncate(reader.file.Name(), byteOffset(torn)+cut)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, _, err = reader.Read(torn)
+		if err != ErrTruncated {
+			t.Fatalf("expected ErrTruncated got %v", err)
+		}
+
+		lastGood, garbage, err = reader.TailState()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if lastGood != next || garbage != cut {
+			t.Fatalf("unexpected tail state %d %d, expected %d %d", lastGood, garbage, next, cut)
+		}
+
+		n := 0
+		err = reader.Scan(0, func(data []byte, offset, next uint32) error {
+			n++
+			return nil
+		})
+		if err != nil || n != 10 {
+			t.Fatalf("unexpected scan result %d %v", n, err)
+		}
+
+		err = reader.ScanWithOptions(0, ScanOptions{ReportTruncated: true}, func(data []byte, offset, next uint32) error {
+			return nil
+		})
+		if err != ErrTruncated {
+			t.Fatalf("expected ErrTruncated got %v", err)
+		}
+
+		_, err = NewReaderWithOptions(reader.file.Name(), 0, ReaderOptions{CheckTail: true})
+		if err != ErrTruncated {
+			t.Fatalf("expected ErrTruncated got %v", err)
+		}
+	}
+}
+
+func TestReportTruncatedGarbage(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	var next uint32
+	var err error
+	for i := 0; i < 10; i++ {
+		_, next, err = fw.Append([]byte(RandStringRunes(i * 10)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	// the garbage starts where the next entry would be written
+	clean := byteOffset(next)
+	for _, size := range []int{8, 15, 16, 40, 64, 100, 128, 200, 1000} {
+		err = os.Truncate(reader.file.Name(), clean)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = fw.file.WriteAt([]byte(RandStringRunes(size)), clean)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		lastGood, garbage, err := reader.TailState()
+		if err != nil || lastGood != next || garbage != int64(size) {
+			t.Fatalf("%d: unexpected tail state %d %d %v", size, lastGood, garbage, err)
+		}
+		n := 0
+		err = reader.ScanWithOptions(0, ScanOptions{ReportTruncated: true}, func(data []byte, offset, next uint32) error {
+			n++
+			return nil
+		})
+		if err != ErrTruncated || n != 10 {
+			t.Fatalf("%d: expected ErrTruncated after 10 entries got %d %v", size, n, err)
+		}
+		report, err := reader.ScanWithRecovery(0, func(data []byte, offset, next uint32) error {
+			return nil
+		})
+		if err != nil || !report.Truncated || report.Entries != 10 {
+			t.Fatalf("%d: unexpected report %+v %v", size, report, err)
+		}
+	}
+}
+
+func TestTruncateTo(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	for i := 0; i < 10; i++ {
+		_, _, err := fw.Append([]byte(RandStringRunes(i * 10)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	torn, _, err := fw.Append(make([]byte, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Truncate(reader.file.Name(), byteOffset(torn)+500)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lastGood, _, err := reader.TailState()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = fw.TruncateTo(lastGood + 1000)
+	if err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+
+	err = fw.TruncateTo(lastGood)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_, garbage, err := reader.TailState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if garbage != 0 {
+		t.Fatalf("expected no garbage got %d", garbage)
+	}
+
+	off, _, err := fw.Append([]byte("hello"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if off != lastGood {
+		t.Fatalf("expected %d got %d", lastGood, off)
+	}
+	data, _, err := reader.Read(off)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(data) != "hello" {
+		t.Fatalf("expected hello got %s", data)
+	}
+}
+
+func TestEmptyFile(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	empty, err := reader.IsEmpty()
+	if err != nil || !empty {
+		t.Fatalf("expected empty got %v %v", empty, err)
+	}
+	_, _, err = reader.Read(0)
+	if err != io.EOF {
+		t.Fatalf("expected io.EOF got %v", err)
+	}
+	for _, opts := range []ScanOptions{{}, {ReportTruncated: true}, {StopOnTailCorruption: true}} {
+		err = reader.ScanWithOptions(0, opts, func(data []byte, offset, next uint32) error {
+			t.Fatal("unexpected entry")
+			return nil
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	lastGood, garbage, err := reader.TailState()
+	if err != nil || lastGood != 0 || garbage != 0 {
+		t.Fatalf("unexpected %d %d %v", lastGood, garbage, err)
+	}
+	last, _, err := reader.LastN(10)
+	if err != nil || len(last) != 0 {
+		t.Fatalf("unexpected %v %v", last, err)
+	}
+
+	// a valid empty entry is not the same as empty file
+	_, _, err = fw.Append(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	empty, err = reader.IsEmpty()
+	if err != nil || empty {
+		t.Fatalf("expected not empty got %v %v", empty, err)
+	}
+	data, next, err := reader.Read(0)
+	if err != nil || data == nil || len(data) != 0 || next != 1 {
+		t.Fatalf("unexpected %v %d %v", data, next, err)
+	}
+}
+
+func TestWatchSize(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	defer func(interval time.Duration) {
+		watchInterval = interval
+	}(watchInterval)
+	watchInterval = time.Millisecond
+
+	ctx, cancel := context.WithCancel(context.Background())
+	seen := make(chan uint32, 100)
+	result := make(chan error)
+	go func() {
+		result <- reader.WatchSize(ctx, func(hw uint32) {
+			seen <- hw
+		})
+	}()
+	// let it read the initial size
+	time.Sleep(50 * time.Millisecond)
+
+	for i := 0; i < 3; i++ {
+		_, next, err := fw.Append([]byte("hello"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case hw := <-seen:
+			if hw != next {
+				t.Fatalf("expected %d got %d", next, hw)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	cancel()
+	if err := <-result; err != context.Canceled {
+		t.Fatalf("expected context.Canceled got %v", err)
+	}
+}
+
+func TestScanReverseFollow(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	defer func(interval time.Duration) {
+		watchInterval = interval
+	}(watchInterval)
+	watchInterval = time.Millisecond
+
+	for i := 0; i < 10; i++ {
+		_, _, err := fw.Append([]byte(fmt.Sprintf("%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	seen := make(chan string, 100)
+	result := make(chan error)
+	go func() {
+		result <- reader.ScanReverseFollow(ctx, 3, func(data []byte, offset, next uint32) error {
+			seen <- string(data)
+			return nil
+		})
+	}()
+	expect := func(expected string) {
+		select {
+		case got := <-seen:
+			if got != expected {
+				t.Fatalf("expected %s got %s", expected, got)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatal("timeout")
+		}
+	}
+	for _, e := range []string{"9", "8", "7"} {
+		expect(e)
+	}
+	for i := 10; i < 14; i++ {
+		_, _, err := fw.Append([]byte(fmt.Sprintf("%d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i%2 == 1 {
+			expect(fmt.Sprintf("%d", i-1))
+			expect(fmt.Sprintf("%d", i))
+		}
+	}
+	cancel()
+	if err := <-result; err != context.Canceled {
+		t.Fatalf("expected context.Canceled got %v", err)
+	}
+
+	stop := errors.New("stop")
+	err := reader.ScanReverseFollow(context.Background(), 100, func(data []byte, offset, next uint32) error {
+		return stop
+	})
+	if err != stop {
+		t.Fatalf("expected stop got %v", err)
+	}
+}
+
+func TestRecoverFile(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+	fn := reader.file.Name()
+
+	var next uint32
+	var err error
+	for i := 0; i < 10; i++ {
+		_, next, err = fw.Append([]byte(RandStringRunes(i * 10)))
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+	s, err := os.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lastGood, truncated, err := RecoverFile(fn, 0, ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastGood != next || truncated != 0 {
+		t.Fatalf("unexpected recover %d %d, expected %d 0", lastGood, truncated, next)
+	}
+	after, err := os.Stat(fn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if after.Size() != s.Size() {
+		t.Fatalf("clean file was modified %d %d", s.Size(), after.Size())
+	}
+
+	torn, _, err := fw.Append(make([]byte, 1000))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = os.Truncate(fn, byteOffset(torn)+500)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lastGood, truncated, err = RecoverFile(fn, 0, ReaderOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lastGood != next || truncated != byteOffset(torn)+500-byteOffset(next) {
+		t.Fatalf("unexpected recover %d %d", lastGood, truncated)
+	}
+	_, garbage, err := reader.TailState()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if garbage != 0 {
+		t.Fatalf("expected clean file, got %d garbage", garbage)
+	}
+
+	if _, _, err := RecoverFile(fn+".missing", 0, ReaderOptions{}); !os.IsNotExist(err) {
+		t.Fatalf("expected not exist got %v", err)
+	}
+}
+
+func TestRecoverFileOptions(t *testing.T) {
+	dir, err := ioutil.TempDir("", "recover")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	size := func(fn string) int64 {
+		s, err := os.Stat(fn)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return s.Size()
+	}
+
+	fixed := path.Join(dir, "fixed")
+	w, err := NewWriterWithOptions(fixed, WriterOptions{FixedSize: 32})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 10; i++ {
+		if _, _, err := w.Append(make([]byte, 32)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	w.Close()
+	clean := size(fixed)
+	lastGood, truncated, err := RecoverFile(fixed, 0, ReaderOptions{FixedSize: 32})
+	if err != nil || lastGood != 10 || truncated != 0 || size(fixed) != clean {
+		t.Fatalf("clean fixed file was modified %d %d %v, size %d", lastGood, truncated, err, size(fixed))
+	}
+
+	// torn record at the end
+	if err := os.Truncate(fixed, clean+10); err != nil {
+		t.Fatal(err)
+	}
+	lastGood, truncated, err = RecoverFile(fixed, 0, ReaderOptions{FixedSize: 32, CheckTail: true})
+	if err != nil || lastGood != 10 || truncated != 10 || size(fixed) != clean {
+		t.Fatalf("unexpected recover %d %d %v, size %d", lastGood, truncated, err, size(fixed))
+	}
+
+	// with the wrong options there is no valid entry, the file must not be wiped
+	if _, _, err := RecoverFile(fixed, 0, ReaderOptions{}); err != ErrNoValidEntry || size(fixed) != clean {
+		t.Fatalf("expected ErrNoValidEntry got %v, size %d", err, size(fixed))
+	}
+
+	trailing := path.Join(dir, "trailing")
+	file := append(trailingBlob([]byte("a")), trailingBlob([]byte("b"))...)
+	if err := ioutil.WriteFile(trailing, file, 0600); err != nil {
+		t.Fatal(err)
+	}
+	lastGood, truncated, err = RecoverFile(trailing, 0, ReaderOptions{TrailingDataChecksum: true})
+	if err != nil || lastGood != 2 || truncated != 0 || size(trailing) != int64(len(file)) {
+		t.Fatalf("clean trailing file was modified %d %d %v, size %d", lastGood, truncated, err, size(trailing))
+	}
+
+	garbage := path.Join(dir, "garbage")
+	if err := ioutil.WriteFile(garbage, []byte(RandStringRunes(300)), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := RecoverFile(garbage, 0, ReaderOptions{}); err != ErrNoValidEntry || size(garbage) != 300 {
+		t.Fatalf("expected ErrNoValidEntry got %v, size %d", err, size(garbage))
+	}
+
+	empty := path.Join(dir, "empty")
+	if err := ioutil.WriteFile(empty, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if lastGood, truncated, err := RecoverFile(empty, 0, ReaderOptions{}); err != nil || lastGood != 0 || truncated != 0 {
+		t.Fatalf("unexpected recover of empty file %d %d %v", lastGood, truncated, err)
+	}
+}
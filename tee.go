@@ -0,0 +1,18 @@
+package pen
+
+// Scan from offset, appending every valid entry to dst and then calling cb with it, so processing and replication are one pass.
+// The entries are the ones Scan delivers, so the corruption is skipped and not replicated, and the schema and the large entries are not copied.
+// Returns the offset after the last replicated entry (e.g. to continue the replication from), if dst.Append fails the entry is not replicated
+// and cb is not called for it, if cb returns error the entry passed to it is already replicated, and the error is returned.
+func (ar *Reader) Tee(offset uint32, dst *Writer, cb func([]byte, uint32, uint32) error) (uint32, error) {
+	resume := offset
+	err := ar.Scan(offset, func(data []byte, offset, next uint32) error {
+		_, _, err := dst.Append(data)
+		if err != nil {
+			return err
+		}
+		resume = next
+		return cb(data, offset, next)
+	})
+	return resume, err
+}
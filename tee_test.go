@@ -0,0 +1,69 @@
+package pen
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"testing"
+)
+
+func TestTee(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+	dst, dstReader, dstDone := newTestWriterReader(t, 0)
+	defer dstDone()
+
+	offsets := []uint32{}
+	for i := 0; i < 20; i++ {
+		off, _, err := fw.Append([]byte(fmt.Sprintf("entry %d", i)))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	_, err := fw.file.WriteAt([]byte{0}, byteOffset(offsets[5])+20)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	stop := errors.New("stop")
+	seen := 0
+	resume, err := reader.Tee(0, dst, func(data []byte, offset, next uint32) error {
+		seen++
+		if offset == offsets[10] {
+			return stop
+		}
+		return nil
+	})
+	if err != stop || resume != offsets[11] || seen != 10 {
+		t.Fatalf("unexpected %d %d %v", resume, seen, err)
+	}
+
+	resume, err = reader.Tee(resume, dst, func(data []byte, offset, next uint32) error {
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, next, _ := reader.Read(offsets[19]); resume != next {
+		t.Fatalf("expected %d got %d", next, resume)
+	}
+
+	replicated := [][]byte{}
+	err = dstReader.Scan(0, func(data []byte, offset, next uint32) error {
+		replicated = append(replicated, data)
+		return nil
+	})
+	if err != nil || len(replicated) != 19 {
+		t.Fatalf("expected 19 entries got %d %v", len(replicated), err)
+	}
+	for i, j := 0, 0; i < 20; i++ {
+		if i == 5 {
+			continue
+		}
+		if !bytes.Equal(replicated[j], []byte(fmt.Sprintf("entry %d", i))) {
+			t.Fatalf("entry %d: unexpected %q", i, replicated[j])
+		}
+		j++
+	}
+}
@@ -0,0 +1,99 @@
+package pen
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+// entry of the trailing checksum layout, padded to PAD
+func trailingBlob(data []byte) []byte {
+	blob := make([]byte, 16+len(data)+4)
+	binary.LittleEndian.PutUint32(blob, uint32(len(data)))
+	copy(blob[8:], MAGIC)
+	binary.LittleEndian.PutUint32(blob[12:], uint32(Hash(blob[:12])))
+	copy(blob[16:], data)
+	binary.LittleEndian.PutUint32(blob[16+len(data):], uint32(Hash(data)))
+	return append(blob, make([]byte, (int(PAD)-len(blob)%int(PAD))%int(PAD))...)
+}
+
+func TestTrailingDataChecksum(t *testing.T) {
+	dir, err := ioutil.TempDir("", "trailing")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "trailing")
+
+	// 45 bytes of data fit in 64 with the header but not with the trailer
+	entries := [][]byte{[]byte("a"), bytes.Repeat([]byte("b"), 45), {}, bytes.Repeat([]byte("c"), 1000)}
+	file := []byte{}
+	offsets := []uint32{}
+	for _, e := range entries {
+		offsets = append(offsets, uint32(len(file))/PAD)
+		file = append(file, trailingBlob(e)...)
+	}
+	if err := ioutil.WriteFile(fn, file, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if offsets[2]-offsets[1] != 2 {
+		t.Fatalf("unexpected offsets %v", offsets)
+	}
+
+	if _, err := NewReaderWithOptions(fn, 64, ReaderOptions{TrailingDataChecksum: true, FixedSize: 8}); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+	for _, blockSize := range []int{16, 64, 4096} {
+		reader, err := NewReaderWithOptions(fn, blockSize, ReaderOptions{TrailingDataChecksum: true})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i, off := range offsets {
+			data, next, err := reader.Read(off)
+			if err != nil || !bytes.Equal(data, entries[i]) {
+				t.Fatalf("entry %d: unexpected %q %v", i, data, err)
+			}
+			if i+1 < len(offsets) && next != offsets[i+1] {
+				t.Fatalf("entry %d: expected next %d got %d", i, offsets[i+1], next)
+			}
+			checksum, pnext, err := reader.PayloadChecksum(off)
+			if err != nil || checksum != uint32(Hash(entries[i])) || pnext != next {
+				t.Fatalf("entry %d: unexpected checksum %x %d %v", i, checksum, pnext, err)
+			}
+			_, payload, headerValid, dataValid, rnext, err := reader.ReadRaw(off)
+			if err != nil || !headerValid || !dataValid || rnext != next || !bytes.Equal(payload, entries[i]) {
+				t.Fatalf("entry %d: unexpected raw %v %v %d %v", i, headerValid, dataValid, rnext, err)
+			}
+			same, _, err := reader.CompareAt(off, entries[i])
+			if err != nil || !same {
+				t.Fatalf("entry %d: expected same got %v %v", i, same, err)
+			}
+		}
+		reader.Close()
+	}
+
+	// corrupt the trailing checksum of the second entry
+	file[int(offsets[1]*PAD)+16+45] ^= 1
+	if err := ioutil.WriteFile(fn, file, 0600); err != nil {
+		t.Fatal(err)
+	}
+	reader, err := NewReaderWithOptions(fn, 64, ReaderOptions{TrailingDataChecksum: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+	if _, _, err := reader.Read(offsets[1]); err != EBADSLT {
+		t.Fatalf("expected EBADSLT got %v", err)
+	}
+	seen := []uint32{}
+	err = reader.Scan(0, func(data []byte, offset, next uint32) error {
+		seen = append(seen, offset)
+		return nil
+	})
+	if err != nil || len(seen) != 3 || seen[1] != offsets[2] {
+		t.Fatalf("unexpected scan %v %v", seen, err)
+	}
+}
@@ -0,0 +1,61 @@
+package pen
+
+import (
+	"errors"
+)
+
+// magic of the entries written with WriterOptions.Transforms, the first byte of their data is the flags of the transforms that were applied
+var TRANSFORM_MAGIC = []byte{0x7, 0xa, 0x5, 0xf}
+
+// returned when reading an entry that was encoded with a transform that is not in ReaderOptions.Transforms
+var ErrUnknownTransform = errors.New("entry is encoded with unknown transform")
+
+// max number of transforms, one bit per transform in the flags byte
+const maxTransforms = 8
+
+// Transform of the payload (e.g. compression or encryption), see WriterOptions.Transforms.
+// Encode and Decode must not modify the input, it can be reused by the caller.
+type Transform interface {
+	Encode(in []byte) ([]byte, error)
+	Decode(in []byte) ([]byte, error)
+}
+
+// apply all transforms in order, returns the flags byte followed by the encoded data
+func encodeTransforms(data []byte, transforms []Transform) ([]byte, error) {
+	flags := byte(0)
+	var err error
+	for i, t := range transforms {
+		data, err = t.Encode(data)
+		if err != nil {
+			return nil, err
+		}
+		flags |= 1 << i
+	}
+	out := make([]byte, 1+len(data))
+	out[0] = flags
+	copy(out[1:], data)
+	return out, nil
+}
+
+// decode with the transforms that have bit in the flags byte, in reverse order
+func decodeTransforms(data []byte, transforms []Transform) ([]byte, error) {
+	if len(data) < 1 {
+		return nil, EBADSLT
+	}
+	flags := data[0]
+	data = data[1:]
+	if int(flags)>>len(transforms) != 0 {
+		return nil, ErrUnknownTransform
+	}
+	var err error
+	for i := len(transforms) - 1; i >= 0; i-- {
+		if flags&(1<<i) == 0 {
+			continue
+		}
+		data, err = transforms[i].Decode(data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return data, nil
+}
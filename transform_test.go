@@ -0,0 +1,156 @@
+package pen
+
+import (
+	"bytes"
+	"compress/flate"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+type flateTransform struct{}
+
+func (flateTransform) Encode(in []byte) ([]byte, error) {
+	var b bytes.Buffer
+	w, _ := flate.NewWriter(&b, flate.BestSpeed)
+	if _, err := w.Write(in); err != nil {
+		return nil, err
+	}
+	if err := w.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+func (flateTransform) Decode(in []byte) ([]byte, error) {
+	return ioutil.ReadAll(flate.NewReader(bytes.NewReader(in)))
+}
+
+type xorTransform byte
+
+func (x xorTransform) Encode(in []byte) ([]byte, error) {
+	out := make([]byte, len(in))
+	for i := range in {
+		out[i] = in[i] ^ byte(x)
+	}
+	return out, nil
+}
+
+func (x xorTransform) Decode(in []byte) ([]byte, error) {
+	return x.Encode(in)
+}
+
+func TestTransforms(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "transform")
+
+	transforms := []Transform{flateTransform{}, xorTransform(0x5a)}
+	expected := [][]byte{}
+	offsets := []uint32{}
+	// mixed file: plain entries, compressed entries, and compressed and xored entries
+	for _, n := range []int{0, 1, 2} {
+		fw, err := NewWriterWithOptions(fn, WriterOptions{Transforms: transforms[:n]})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; i < 100; i++ {
+			d := bytes.Repeat([]byte(RandStringRunes(i%10+1)), i)
+			off, _, err := fw.Append(d)
+			if err != nil {
+				t.Fatal(err)
+			}
+			expected = append(expected, d)
+			offsets = append(offsets, off)
+		}
+		if n > 0 {
+			if err := fw.Overwrite(offsets[0], []byte("x")); err != EINVAL {
+				t.Fatalf("expected EINVAL got %v", err)
+			}
+		}
+		fw.Close()
+	}
+
+	reader, err := NewReaderWithOptions(fn, 64, ReaderOptions{Transforms: transforms})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reader.Close()
+
+	for i, off := range offsets {
+		data, _, err := reader.Read(off)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(data, expected[i]) {
+			t.Fatalf("entry %d mismatch", i)
+		}
+	}
+	i := 0
+	err = reader.ScanNoCopy(0, func(data []byte, offset, next uint32) error {
+		if offset != offsets[i] || !bytes.Equal(data, expected[i]) {
+			t.Fatalf("entry %d mismatch", i)
+		}
+		i++
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if i != len(expected) {
+		t.Fatalf("expected %d entries got %d", len(expected), i)
+	}
+	for _, i := range []int{5, 150, 250} {
+		same, _, err := reader.CompareAt(offsets[i], expected[i])
+		if err != nil || !same {
+			t.Fatalf("entry %d: expected same got %v %v", i, same, err)
+		}
+		same, _, err = reader.CompareAt(offsets[i], append(expected[i], 'x'))
+		if err != nil || same {
+			t.Fatalf("entry %d: expected different got %v %v", i, same, err)
+		}
+	}
+
+	// missing the xor transform
+	short, err := NewReaderWithOptions(fn, 64, ReaderOptions{Transforms: transforms[:1]})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer short.Close()
+	if _, _, err := short.Read(offsets[250]); !errors.Is(err, ErrUnknownTransform) {
+		t.Fatalf("expected ErrUnknownTransform got %v", err)
+	}
+	if _, _, err := short.Read(offsets[150]); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestTransformsInvalid(t *testing.T) {
+	dir, err := ioutil.TempDir("", "transform")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	fn := path.Join(dir, "transform")
+
+	for _, opts := range []WriterOptions{
+		{Transforms: []Transform{xorTransform(1)}, FixedSize: 8},
+		{Transforms: []Transform{xorTransform(1)}, CompactHeader: true},
+		{Transforms: make([]Transform, 9)},
+	} {
+		if _, err := NewWriterWithOptions(fn, opts); err != EINVAL {
+			t.Fatalf("expected EINVAL got %v", err)
+		}
+	}
+	if err := ioutil.WriteFile(fn, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewReaderWithOptions(fn, 64, ReaderOptions{Transforms: make([]Transform, 9)}); err != EINVAL {
+		t.Fatalf("expected EINVAL got %v", err)
+	}
+}
@@ -6,3 +6,9 @@ import "github.com/dgryski/go-metro"
 func Hash(s []byte) uint64 {
 	return metro.Hash64(s, 0)
 }
+
+// Name of the algorithm used by Hash (64 bit MetroHash with seed 0), the headers store the lower 32 bits of it.
+// It is part of the on-disk format, so it does not change.
+func HashName() string {
+	return "metro64"
+}
@@ -0,0 +1,35 @@
+package pen
+
+import (
+	"fmt"
+	"testing"
+)
+
+func TestHashName(t *testing.T) {
+	if HashName() != "metro64" {
+		t.Fatalf("unexpected hash name %s", HashName())
+	}
+	// the format depends on it, it must never change
+	if h := Hash([]byte("hello")); h != 0x3f6fea196d1f90fc {
+		t.Fatalf("unexpected hash of hello %#x", h)
+	}
+}
+
+func TestHashEmpty(t *testing.T) {
+	// the empty entries store it as data checksum, nil and empty slices must be the same
+	if Hash(nil) != Hash([]byte{}) || Hash(nil) != 0x705fb008071e967d {
+		t.Fatalf("unexpected hash of empty %#x %#x", Hash(nil), Hash([]byte{}))
+	}
+}
+
+func BenchmarkHash(b *testing.B) {
+	for _, size := range []int{16, 64, 256, 4096, 64 * 1024, 1024 * 1024} {
+		data := make([]byte, size)
+		b.Run(fmt.Sprintf("%d", size), func(b *testing.B) {
+			b.SetBytes(int64(size))
+			for i := 0; i < b.N; i++ {
+				Hash(data)
+			}
+		})
+	}
+}
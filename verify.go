@@ -0,0 +1,67 @@
+package pen
+
+import "io/ioutil"
+
+// Result of VerifyRange
+type VerifyResult struct {
+	// number of valid entries in the range, and the total length of their data
+	Entries int
+	Bytes   int64
+
+	// the corrupted regions found in the range, same as ScanCollectErrors
+	Corrupt []ChecksumError
+}
+
+// Verify the checksums of the entries starting in [startOffset, endOffset) (including the large entries from Writer.AppendFrom), e.g. around a reported bad sector,
+// without scanning the whole file. It resyncs to the first valid entry at or after startOffset like ScanRange, so startOffset does not have to be an entry offset,
+// but then corruption between startOffset and that entry is not reported (it could be the rest of the previous entry), pass the exact offset of an entry to check it too.
+// A corrupted region that starts in the range is reported whole, even if it ends after endOffset.
+func (ar *Reader) VerifyRange(startOffset, endOffset uint32) (VerifyResult, error) {
+	result := VerifyResult{Corrupt: []ChecksumError{}}
+	if startOffset >= endOffset {
+		return result, nil
+	}
+	first, err := ar.firstEntryFrom(startOffset)
+	if err != nil {
+		return result, err
+	}
+	if first >= endOffset {
+		return result, nil
+	}
+
+	opts := ScanOptions{
+		onSkip: func(from, to uint32) {
+			if from < endOffset {
+				result.Corrupt = append(result.Corrupt, ChecksumError{Offset: from, End: to})
+			}
+		},
+		OnLargeEntry: func(offset, next uint32) error {
+			if offset >= endOffset {
+				return errStopScan
+			}
+			n, err := ar.WriteEntryTo(offset, ioutil.Discard)
+			if err == EBADSLT {
+				result.Corrupt = append(result.Corrupt, ChecksumError{Offset: offset, End: next})
+				return nil
+			}
+			if err != nil {
+				return err
+			}
+			result.Entries++
+			result.Bytes += n
+			return nil
+		},
+	}
+	err = ar.ScanWithOptions(first, opts, func(data []byte, offset, next uint32) error {
+		if offset >= endOffset {
+			return errStopScan
+		}
+		result.Entries++
+		result.Bytes += int64(len(data))
+		return nil
+	})
+	if err != nil && err != errStopScan {
+		return result, err
+	}
+	return result, nil
+}
@@ -0,0 +1,58 @@
+package pen
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestVerifyRange(t *testing.T) {
+	fw, reader, done := newTestWriterReader(t, 0)
+	defer done()
+
+	offsets := []uint32{}
+	for i := 0; i < 30; i++ {
+		off, _, err := fw.Append(make([]byte, 100))
+		if err != nil {
+			t.Fatal(err)
+		}
+		offsets = append(offsets, off)
+	}
+	large, _, err := fw.AppendFrom(bytes.NewReader(make([]byte, 1000)), 1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, i := range []int{3, 12, 13, 25} {
+		_, err := fw.file.WriteAt([]byte{1}, byteOffset(offsets[i])+20)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// starts in the middle of entry 9
+	result, err := reader.VerifyRange(offsets[9]+1, offsets[20])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Entries != 8 || result.Bytes != 800 || len(result.Corrupt) != 1 || result.Corrupt[0] != (ChecksumError{Offset: offsets[12], End: offsets[14]}) {
+		t.Fatalf("unexpected %+v", result)
+	}
+
+	result, err = reader.VerifyRange(offsets[24], offsets[24])
+	if err != nil || result.Entries != 0 || len(result.Corrupt) != 0 {
+		t.Fatalf("unexpected %+v %v", result, err)
+	}
+
+	result, err = reader.VerifyRange(offsets[20], large+1)
+	if err != nil || result.Entries != 10 || result.Bytes != 1900 || len(result.Corrupt) != 1 || result.Corrupt[0].Offset != offsets[25] {
+		t.Fatalf("unexpected %+v %v", result, err)
+	}
+
+	_, err = fw.file.WriteAt([]byte{1}, byteOffset(large)+100)
+	if err != nil {
+		t.Fatal(err)
+	}
+	result, err = reader.VerifyRange(offsets[29], large+1)
+	if err != nil || result.Entries != 1 || len(result.Corrupt) != 1 || result.Corrupt[0].Offset != large {
+		t.Fatalf("unexpected %+v %v", result, err)
+	}
+}
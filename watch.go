@@ -0,0 +1,84 @@
+package pen
+
+import (
+	"context"
+	"time"
+)
+
+// how often WatchSize checks the size of the file
+var watchInterval = 100 * time.Millisecond
+
+// Poll the size of the file every 100ms and call cb with the new high water offset (the offset of the next Append) whenever it grows,
+// until ctx is done, then it returns ctx.Err(). The growth between two polls is reported once, so bursts of appends are debounced.
+// It is polling (no fsnotify), so cb is called up to 100ms after the append, scan from the previous high water offset to get the new entries.
+func (ar *Reader) WatchSize(ctx context.Context, cb func(newHighWater uint32)) error {
+	size, err := ar.size()
+	if err != nil {
+		return err
+	}
+	highWater := highWaterOffset(size)
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		size, err := ar.size()
+		if err != nil {
+			return err
+		}
+		if hw := highWaterOffset(size); hw > highWater {
+			highWater = hw
+			cb(hw)
+		}
+	}
+}
+
+// offset after the end of file of this size, the last entry is not padded
+func highWaterOffset(size int64) uint32 {
+	return uint32((size + int64(PAD) - 1) / int64(PAD))
+}
+
+// Live tail newest first (e.g. log viewer): first cb is called for the last initial entries newest first (like ScanReverseN),
+// then every 100ms the entries appended after them are delivered oldest first as they arrive, until ctx is done (returns ctx.Err()) or cb returns an error.
+// So the offsets decrease during the initial batch, and after it every entry is new, with offset bigger than all the entries delivered before.
+func (ar *Reader) ScanReverseFollow(ctx context.Context, initial int, cb func([]byte, uint32, uint32) error) error {
+	index, from, err := ar.offsets()
+	if err != nil {
+		return err
+	}
+	for i := len(index) - 1; i >= 0 && i >= len(index)-initial; i-- {
+		data, next, err := ar.Read(index[i])
+		if err != nil {
+			return err
+		}
+		err = cb(data, index[i], next)
+		if err != nil {
+			return err
+		}
+	}
+
+	ticker := time.NewTicker(watchInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+		err := ar.Scan(from, func(data []byte, offset, next uint32) error {
+			err := cb(data, offset, next)
+			if err != nil {
+				return err
+			}
+			from = next
+			return nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+}
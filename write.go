@@ -1,14 +1,22 @@
 package pen
 
 import (
+	"context"
 	"encoding/binary"
 	"errors"
+	"fmt"
+	"hash/crc32"
 	"os"
+	"sync"
 	"sync/atomic"
+	"time"
 )
 
 var EOVERFLOW = errors.New("you can only overwrite with smaller or equal size")
 
+// returned by NewWriterWithOptions with WriterOptions.Lock if another writer holds the lock
+var ErrLocked = errors.New("file is locked by another writer")
+
 // the offsets are 32 bit, but usually you want to store more than 4gb of data
 // so we just pad things to minimum 64 byte chunks
 var PAD = uint32(64)
@@ -19,6 +27,99 @@ var MAGIC = []byte{0xb, 0xe, 0xe, 0xf}
 type Writer struct {
 	file   *os.File
 	offset uint32
+
+	// O_APPEND mode, the file position is decided by the kernel so the writes must be serialized
+	appendMode bool
+	appendLock sync.Mutex
+	end        int64
+
+	// running crc32 of the file, the writes are serialized to compute it in file order
+	fileCRC bool
+	crc     uint32
+
+	// fixed size records without header, offsets are record indexes
+	fixedSize int
+
+	// used to open the next segment on Rotate, the appends are serialized with segmentLock if MaxSegmentBytes is set
+	opts        WriterOptions
+	segmentLock sync.Mutex
+
+	// the appends waiting for fsync with GroupCommitWindow
+	group groupCommit
+
+	// the completely written prefix of the file, and the part of it that is synced
+	written writtenTracker
+	durable uint32
+}
+
+// Options used to open the writer's file
+type WriterOptions struct {
+	// the file mode used if the file is created, 0 means 0600
+	FileMode os.FileMode
+
+	// fail with os.ErrExist if the file already exists (O_EXCL)
+	Exclusive bool
+
+	// extra flags passed to os.OpenFile, os.O_RDWR|os.O_CREATE are always used
+	// if os.O_APPEND is set, the entries are written with Write instead of WriteAt
+	// and the padding is written explicitly, in that mode Overwrite returns EINVAL
+	// (O_APPEND ignores the write offset, so it can not overwrite).
+	OpenFlags int
+
+	// keep running crc32 over the whole file, and on Close write a trailer with it, so Reader.VerifyFileCRC() can check the whole file.
+	// The existing data is read once when opening, Overwrite returns EINVAL and the appends are serialized.
+	// The trailer is written with TRAILER_MAGIC instead of MAGIC, so Scan skips it, if the file is opened again the new entries are written after it.
+	FileCRC bool
+
+	// write fixed size records in the FixedWriteAt format (8 byte checksum and the data, no length and no padding), so the offset of record N is N.
+	// Append and Overwrite return EINVAL if the data is not exactly FixedSize bytes, read it with ReaderOptions.FixedSize.
+	// The formats can not be mixed, do not use it on a file with variable length entries (or the other way around), and it can not be combined with O_APPEND, FileCRC or CompactHeader.
+	FixedSize int
+
+	// Rotate before the Append that would make the file bigger than MaxSegmentBytes (a single entry bigger than it still gets its own segment),
+	// the appends are serialized. The offsets start from 0 in every segment, so an Append that returns offset 0 wrote to a new segment, check Writer.Rotate.
+	MaxSegmentBytes int64
+
+	// take advisory exclusive lock on the file (flock on unix, LockFileEx on windows) until Close, and fail with ErrLocked if another writer
+	// (in this or another process) holds it, so a misconfigured second writer can not corrupt the file. On other platforms it does nothing.
+	// It is advisory, it does not stop writers that do not use it, and the readers are not affected. On windows, where the locks are mandatory,
+	// it locks only one byte at offset 2^64-2 (never part of the data), the same byte Lock of every writer uses.
+	Lock bool
+
+	// called synchronously by Append after the entry is written and synced (fsync of every Append), so an index maintained by it is never ahead of the disk,
+	// the appends are serialized. If the sync or the callback fails, the entry is truncated from the file and Append returns the error, so the file and the index
+	// stay consistent. AppendBatch appends the entries one by one with it (one sync each). AppendContext returning ctx.Err() does not wait for it,
+	// Append still calls it in the background. It can not be combined with GroupCommitWindow (EINVAL), the serialized appends could not share the fsync.
+	OnAppend func(data []byte, offset, next uint32) error
+
+	// write the entries up to 16KB with compact header (2 bytes COMPACT_MAGIC, varint length, and 4 byte checksum of all of it after the data),
+	// so tiny entries have 7 bytes overhead instead of 16, the bigger ones are written as usual. The readers detect the format of every entry,
+	// but it only saves space if the entry fits in less PAD units (e.g. with PAD 64, 50 bytes take 1 unit instead of 2), and Overwrite returns EINVAL.
+	// ReadRaw and PayloadChecksum understand only the normal header and return ErrCompactEntry for them (CompareAt and FindByChecksum fall back to Read).
+	CompactHeader bool
+
+	// encode the data with the transforms in order (e.g. compression and then encryption), the readers decode it in reverse order with ReaderOptions.Transforms.
+	// The entries are written with TRANSFORM_MAGIC and the first byte of their data has one bit per transform that was applied (so up to 8 transforms),
+	// so a file can have entries written with and without transforms, but the reader must have the same transforms in the same order (new ones can be appended).
+	// It can not be combined with FixedSize or CompactHeader, and Overwrite returns EINVAL. ReadRaw and PayloadChecksum see the encoded data.
+	Transforms []Transform
+
+	// make Append return only after the entry is synced to disk, the appends from all goroutines during the window (which starts with the first of them)
+	// share one fsync, so the durable appends have at most GroupCommitWindow (plus the fsync) latency instead of one fsync each.
+	// If the fsync fails, every Append of the group returns the error (the entries are already written, but may not be on disk). It can not be combined with OnAppend.
+	GroupCommitWindow time.Duration
+
+	// allow multiple processes to append to the same file: the file is opened with O_APPEND, every entry is written padded with one write(2),
+	// so the kernel decides where each entry goes, and the offset is the file position after the write. The offsets are not known before the write,
+	// and the next offset returned is only the end of this entry (the other processes could have written after it). See AtomicAppendSize for the size limit.
+	// All the writers of the file must use it, so the file is always multiple of PAD (opening a file that is not returns EINVAL),
+	// and it can not be combined with FileCRC, MaxSegmentBytes or OnAppend.
+	MultiProcess bool
+
+	// fill the padding after every entry with PadByte (e.g. 0xfe) instead of leaving it zero, so in a hex editor it can not be confused with a hole or truncation.
+	// The padding is then written with the entry (so the last entry is also padded), the readers never look at it, they find the entries by MAGIC and the checksums.
+	// The data of the large entries from AppendFrom is not padded.
+	PadByte byte
 }
 
 // Creates new writer and seeks to the end
@@ -47,11 +148,77 @@ type Writer struct {
 //	log.Printf("%s",string(data))
 //
 func NewWriter(filename string) (*Writer, error) {
-	fd, err := os.OpenFile(filename, os.O_RDWR|os.O_CREATE, 0600)
+	return NewWriterWithOptions(filename, WriterOptions{})
+}
+
+// Creates new writer with the given options, NewWriter(filename) is the same as NewWriterWithOptions(filename, WriterOptions{})
+func NewWriterWithOptions(filename string, opts WriterOptions) (*Writer, error) {
+	mode := opts.FileMode
+	if mode == 0 {
+		mode = 0600
+	}
+	flags := os.O_RDWR | os.O_CREATE | opts.OpenFlags
+	if opts.Exclusive {
+		flags |= os.O_EXCL
+	}
+	if opts.MultiProcess {
+		// OnAppend truncates the failed entry, but other processes could have appended after it
+		if opts.FileCRC || opts.MaxSegmentBytes > 0 || opts.OnAppend != nil {
+			return nil, EINVAL
+		}
+		flags |= os.O_APPEND
+	}
+
+	if opts.OnAppend != nil && opts.GroupCommitWindow > 0 {
+		return nil, EINVAL
+	}
+
+	if opts.FixedSize < 0 || (opts.FixedSize > 0 && (flags&os.O_APPEND != 0 || opts.FileCRC || opts.CompactHeader)) {
+		return nil, EINVAL
+	}
+	if len(opts.Transforms) > maxTransforms || (len(opts.Transforms) > 0 && (opts.FixedSize > 0 || opts.CompactHeader)) {
+		return nil, EINVAL
+	}
+
+	fd, err := os.OpenFile(filename, flags, mode)
+	if err != nil {
+		return nil, err
+	}
+	if opts.Lock {
+		err = lockFile(fd)
+		if err != nil {
+			fd.Close()
+			return nil, err
+		}
+	}
+	w, err := NewWriterFromFile(fd)
 	if err != nil {
+		fd.Close()
 		return nil, err
 	}
-	return NewWriterFromFile(fd)
+	w.opts = opts
+	if opts.FixedSize > 0 {
+		w.fixedSize = opts.FixedSize
+		w.offset = uint32(w.end / fixedRecordSize(w.fixedSize))
+		w.written.reset(w.offset)
+		w.durable = w.offset
+	}
+	if flags&os.O_APPEND != 0 {
+		w.appendMode = true
+	}
+	if opts.MultiProcess && w.end%int64(PAD) != 0 {
+		fd.Close()
+		return nil, EINVAL
+	}
+	if opts.FileCRC {
+		w.fileCRC = true
+		w.crc, err = fileCRC(fd, w.end)
+		if err != nil {
+			fd.Close()
+			return nil, err
+		}
+	}
+	return w, nil
 }
 
 func NewWriterFromFile(fd *os.File) (*Writer, error) {
@@ -60,18 +227,30 @@ func NewWriterFromFile(fd *os.File) (*Writer, error) {
 		return nil, err
 	}
 
-	return &Writer{
-		file:   fd,
-		offset: uint32((off + int64(PAD) - 1) / int64(PAD)),
-	}, nil
+	offset := uint32((off + int64(PAD) - 1) / int64(PAD))
+	w := &Writer{
+		file:    fd,
+		offset:  offset,
+		end:     off,
+		durable: offset,
+	}
+	w.written.reset(offset)
+	return w, nil
 }
 
 func (fw *Writer) Close() error {
+	if fw.fileCRC {
+		err := fw.writeTrailer()
+		if err != nil {
+			fw.file.Close()
+			return err
+		}
+	}
 	return fw.file.Close()
 }
 
 func (fw *Writer) Sync() error {
-	return fw.file.Sync()
+	return fw.syncFile(fw.file)
 }
 
 // Append bytes to the end of file
@@ -91,28 +270,262 @@ func (fw *Writer) Sync() error {
 //
 // it returns the addressable offset that you can use ReadFromReader() on
 func (fw *Writer) Append(encoded []byte) (uint32, uint32, error) {
-	blobSize := 16 + len(encoded)
-	blob := make([]byte, blobSize)
+	r, err := fw.AppendWithInfo(encoded)
+	if err != nil {
+		return 0, 0, err
+	}
+	return r.Offset, r.Next, nil
+}
+
+// Result of Writer.AppendWithInfo
+type AppendResult struct {
+	Offset uint32
+	Next   uint32
+
+	// uint32 of Hash of the stored data, the same as Reader.PayloadChecksum(Offset) returns (so with WriterOptions.Transforms it is the checksum of the encoded data),
+	// entries without the 16 byte header (CompactHeader) do not store it, for them it is computed from the data
+	DataChecksum uint32
+
+	// length of the data passed to AppendWithInfo
+	Length uint32
+}
+
+// Same as Append, but returns also the data checksum it stored, so an external index does not have to compute Hash(data) again
+func (fw *Writer) AppendWithInfo(encoded []byte) (AppendResult, error) {
+	r, err := fw.append(encoded)
+	if err != nil || fw.opts.GroupCommitWindow <= 0 {
+		return r, err
+	}
+	// outside of segmentLock, so the serialized appends can still share the fsync
+	err = fw.waitGroupCommit()
+	if err != nil {
+		return AppendResult{}, err
+	}
+	return r, nil
+}
+
+func (fw *Writer) append(encoded []byte) (AppendResult, error) {
+	if fw.opts.MaxSegmentBytes > 0 || fw.opts.OnAppend != nil {
+		fw.segmentLock.Lock()
+		defer fw.segmentLock.Unlock()
+	}
+	if fw.opts.MaxSegmentBytes > 0 {
+		err := fw.rotateIfFull(len(encoded))
+		if err != nil {
+			return AppendResult{}, err
+		}
+	}
+
+	r := AppendResult{Length: uint32(len(encoded))}
+	var err error
+	if fw.fixedSize > 0 {
+		r.Offset, r.Next, r.DataChecksum, err = fw.appendFixed(encoded)
+	} else if fw.opts.CompactHeader && len(encoded) <= compactMaxLen {
+		r.DataChecksum = uint32(Hash(encoded))
+		r.Offset, r.Next, err = fw.appendBlob(compactBlob(encoded))
+	} else {
+		magic, stored := MAGIC, encoded
+		if len(fw.opts.Transforms) > 0 {
+			magic = TRANSFORM_MAGIC
+			stored, err = encodeTransforms(encoded, fw.opts.Transforms)
+			if err != nil {
+				return AppendResult{}, err
+			}
+		}
+		blob := entryBlob(stored, magic)
+		r.DataChecksum = binary.LittleEndian.Uint32(blob[4:])
+		r.Offset, r.Next, err = fw.appendBlob(blob)
+	}
+	if err != nil {
+		return AppendResult{}, err
+	}
+	if fw.opts.OnAppend == nil {
+		return r, nil
+	}
+
+	// the hook must not see entries that could still be lost
+	if atomic.LoadUint32(&fw.durable) < r.Next {
+		err = fw.Sync()
+	}
+	if err == nil {
+		err = fw.opts.OnAppend(encoded, r.Offset, r.Next)
+	}
+	if err != nil {
+		// the appends are serialized, so it is still the last entry
+		terr := fw.TruncateTo(r.Offset)
+		if terr != nil {
+			return AppendResult{}, fmt.Errorf("pen: OnAppend: %w, truncate: %v", err, terr)
+		}
+		return AppendResult{}, err
+	}
+	return r, nil
+}
+
+// Same as Append, but returns ctx.Err() if the context is done before the write finishes (e.g. hung network mount).
+// The write itself can not be cancelled, it continues in the background, so after ctx.Err() the entry may still be written completely,
+// and retrying the Append blindly can store it twice (make the entries idempotent, or check the tail before retrying).
+// If the write is left partial, the checksums detect it: the offset is still allocated, so the next Appends land after the torn entry,
+// and Scan skips it as corruption and continues with them (Reader.TailState reports it only if it is the last one).
+func (fw *Writer) AppendContext(ctx context.Context, encoded []byte) (uint32, uint32, error) {
+	err := ctx.Err()
+	if err != nil {
+		return 0, 0, err
+	}
+	type result struct {
+		offset, next uint32
+		err          error
+	}
+	done := make(chan result, 1)
+	go func() {
+		offset, next, err := fw.Append(encoded)
+		done <- result{offset, next, err}
+	}()
+	select {
+	case r := <-done:
+		return r.offset, r.next, r.err
+	case <-ctx.Done():
+		return 0, 0, ctx.Err()
+	}
+}
+
+// header and data of an entry, with the given magic
+func entryBlob(encoded []byte, magic []byte) []byte {
+	blob := make([]byte, 16+len(encoded))
 	copy(blob[16:], encoded)
-	binary.LittleEndian.PutUint32(blob[0:], uint32(len(encoded)))
-	binary.LittleEndian.PutUint32(blob[4:], uint32(Hash(encoded)))
-	copy(blob[8:], MAGIC)
-	binary.LittleEndian.PutUint32(blob[12:], uint32(Hash(blob[:12])))
+	putHeader(blob, encoded, magic)
+	return blob
+}
 
-	padded := ((uint32(blobSize) + PAD - 1) / PAD)
+// write the 16 byte header of encoded into header
+func putHeader(header []byte, encoded []byte, magic []byte) {
+	binary.LittleEndian.PutUint32(header[0:], uint32(len(encoded)))
+	binary.LittleEndian.PutUint32(header[4:], uint32(Hash(encoded)))
+	copy(header[8:], magic)
+	binary.LittleEndian.PutUint32(header[12:], uint32(Hash(header[:12])))
+}
+
+func (fw *Writer) appendBlob(blob []byte) (uint32, uint32, error) {
+	return fw.appendBlobAt(blob, false)
+}
+
+// if first is true the blob is written only if the file is empty (EINVAL otherwise), the check is done together with the offset allocation
+func (fw *Writer) appendBlobAt(blob []byte, first bool) (uint32, uint32, error) {
+	padded := ((uint32(len(blob)) + PAD - 1) / PAD)
+	if fw.opts.PadByte != 0 {
+		blob = padBlob(blob, int(padded*PAD), fw.opts.PadByte)
+	}
 
-	current := atomic.AddUint32(&fw.offset, padded)
-	current -= uint32(padded)
+	if fw.opts.MultiProcess {
+		return fw.appendMultiProcess(blob, padded)
+	}
+	if fw.appendMode {
+		return fw.appendSerialized(blob, padded, first)
+	}
+	if fw.fileCRC {
+		return fw.appendCRC(blob, padded, first)
+	}
 
-	_, err := fw.file.WriteAt(blob, int64(current*PAD))
+	current := uint32(0)
+	if first {
+		if !atomic.CompareAndSwapUint32(&fw.offset, 0, padded) {
+			return 0, 0, EINVAL
+		}
+	} else {
+		current = atomic.AddUint32(&fw.offset, padded)
+		current -= uint32(padded)
+	}
+
+	_, err := fw.file.WriteAt(blob, byteOffset(current))
+	fw.written.finish(current, current+padded)
 	if err != nil {
 		return 0, 0, err
 	}
 	return uint32(current), current + padded, nil
 }
 
+// blob extended to size with pad bytes
+func padBlob(blob []byte, size int, pad byte) []byte {
+	out := make([]byte, size)
+	copy(out, blob)
+	for i := len(blob); i < size; i++ {
+		out[i] = pad
+	}
+	return out
+}
+
+// in O_APPEND mode we can not choose where to write, so the offset allocation and the write are done under lock
+// the blob is written together with its padding (and the padding of the previous tail if the file was not aligned)
+func (fw *Writer) appendSerialized(blob []byte, padded uint32, first bool) (uint32, uint32, error) {
+	fw.appendLock.Lock()
+	defer fw.appendLock.Unlock()
+	if first && fw.end != 0 {
+		return 0, 0, EINVAL
+	}
+
+	// always start from the real end of file, even if a previous write was partial
+	current := uint32((fw.end + int64(PAD) - 1) / int64(PAD))
+	gap := int64(current)*int64(PAD) - fw.end
+
+	out := make([]byte, gap+int64(padded*PAD))
+	copy(out[gap:], blob)
+	if fw.opts.PadByte != 0 {
+		// the gap is the padding of the previous entry
+		for i := range out[:gap] {
+			out[i] = fw.opts.PadByte
+		}
+	}
+
+	n, err := fw.file.Write(out)
+	fw.end += int64(n)
+	if fw.fileCRC {
+		fw.crc = crc32.Update(fw.crc, crc32.IEEETable, out[:n])
+	}
+	if err != nil {
+		return 0, 0, err
+	}
+	atomic.StoreUint32(&fw.offset, current+padded)
+	fw.written.reset(current + padded)
+	return current, current + padded, nil
+}
+
+// serialized append that keeps the running crc of the file, including the zero padding between the entries
+func (fw *Writer) appendCRC(blob []byte, padded uint32, first bool) (uint32, uint32, error) {
+	fw.appendLock.Lock()
+	defer fw.appendLock.Unlock()
+
+	current := atomic.LoadUint32(&fw.offset)
+	if first && current != 0 {
+		return 0, 0, EINVAL
+	}
+	start := byteOffset(current)
+	_, err := fw.file.WriteAt(blob, start)
+	if err != nil {
+		// we dont know how much was written, so start over from the file
+		fw.end = start + int64(len(blob))
+		fw.crc, _ = fileCRC(fw.file, fw.end)
+		atomic.StoreUint32(&fw.offset, current+padded)
+		fw.written.reset(current + padded)
+		return 0, 0, err
+	}
+	fw.crc = crc32.Update(fw.crc, crc32.IEEETable, make([]byte, start-fw.end))
+	fw.crc = crc32.Update(fw.crc, crc32.IEEETable, blob)
+	fw.end = start + int64(len(blob))
+	atomic.StoreUint32(&fw.offset, current+padded)
+	fw.written.reset(current + padded)
+	return current, current + padded, nil
+}
+
 // Overwrite specific offset, if the new data is bigger than old data it will return EOVERFLOW
 func (fw *Writer) Overwrite(offset uint32, encoded []byte) error {
+	if fw.appendMode || fw.fileCRC || fw.opts.CompactHeader || len(fw.opts.Transforms) > 0 {
+		return EINVAL
+	}
+	if fw.fixedSize > 0 {
+		if len(encoded) != fw.fixedSize {
+			return EINVAL
+		}
+		return FixedWriteAt(fw.file, uint64(offset), encoded)
+	}
 	data, _, err := ReadFromReader(fw.file, offset, 16)
 	if err != nil {
 		return err
@@ -121,17 +534,50 @@ func (fw *Writer) Overwrite(offset uint32, encoded []byte) error {
 		return EOVERFLOW
 	}
 
-	blobSize := 16 + len(encoded)
-	blob := make([]byte, blobSize)
-	copy(blob[16:], encoded)
-	binary.LittleEndian.PutUint32(blob[0:], uint32(len(encoded)))
-	binary.LittleEndian.PutUint32(blob[4:], uint32(Hash(encoded)))
-	copy(blob[8:], MAGIC)
-	binary.LittleEndian.PutUint32(blob[12:], uint32(Hash(blob[:12])))
+	_, err = fw.file.WriteAt(entryBlob(encoded, MAGIC), byteOffset(offset))
+	if err != nil {
+		return err
+	}
+	return nil
+}
 
-	_, err = fw.file.WriteAt(blob, int64(offset*PAD))
+// Truncate the file to offset (e.g. the lastGoodOffset from Reader.TailState()), and the next Append will write at offset.
+// It returns EINVAL if offset is after the current end of the writer.
+// It is not safe to call it concurrently with Append.
+func (fw *Writer) TruncateTo(offset uint32) error {
+	fw.appendLock.Lock()
+	defer fw.appendLock.Unlock()
+
+	if offset > atomic.LoadUint32(&fw.offset) {
+		return EINVAL
+	}
+
+	s, err := fw.file.Stat()
 	if err != nil {
 		return err
 	}
+	// the last entry is not padded, so the file could already be shorter
+	size := byteOffset(offset)
+	if fw.fixedSize > 0 {
+		size = int64(offset) * fixedRecordSize(fw.fixedSize)
+	}
+	if s.Size() > size {
+		err = fw.file.Truncate(size)
+		if err != nil {
+			return err
+		}
+	} else {
+		size = s.Size()
+	}
+
+	atomic.StoreUint32(&fw.offset, offset)
+	fw.resetDurable(offset)
+	fw.end = size
+	if fw.fileCRC {
+		fw.crc, err = fileCRC(fw.file, fw.end)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }